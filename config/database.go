@@ -38,7 +38,19 @@ func ConnectDB() {
 
 	fmt.Println("Connection to database: OK")
 
-	err = DB.AutoMigrate(
+	if err := Migrate(); err != nil {
+		fmt.Println("Migration failed:", err)
+	} else {
+		fmt.Println("Migrations: OK")
+	}
+}
+
+// Migrate brings the schema of DB up to date with the models and sets up
+// what search and older wallet and product rows rely on.
+func Migrate() error {
+	hadSoldOut := DB.Migrator().HasColumn(&models.Product{}, "sold_out")
+
+	err := DB.AutoMigrate(
 		&models.Admin{},
 		&models.User{},
 		&models.Course{},
@@ -49,21 +61,121 @@ func ConnectDB() {
 		&models.Cart{},
 		&models.Semester{},
 		&models.SellerRating{},
+		&models.SellerRatingHistory{},
+		&models.ProductReview{},
 		&models.Subject{},
 		&models.WhishList{},
 		&models.Payment{},
+		&models.WebhookEvent{},
+		&models.Refund{},
 		&models.UserWallet{},
 		&models.SellerWallet{},
+		&models.LedgerAccount{},
+		&models.JournalEntry{},
+		&models.LedgerPosting{},
+		&models.AuthSession{},
+		&models.PasswordReset{},
+		&models.EmailOutbox{},
+		&models.WalletTopUp{},
+		&models.CommissionRule{},
+		&models.PayoutAccount{},
+		&models.Payout{},
+		&models.PayoutBatch{},
 		&models.CouponInventory{},
 		&models.CouponUsage{},
 		&models.UserReferralHistory{},
 		&models.Note{},
+		&models.Checkout{},
 		&models.Order{},
 		&models.OrderItem{},
+		&models.OrderStatusHistory{},
+		&models.ReturnRequest{},
 	)
 	if err != nil {
-		fmt.Println("Migration failed:", err)
-	} else {
-		fmt.Println("Migrations: OK")
+		return err
+	}
+
+	setupProductSearch()
+	normalizeWalletEntryTypes()
+	if !hadSoldOut {
+		markSoldOutProducts()
+	}
+	return nil
+}
+
+// productSearchVector weights the product name above its category and seller,
+// and those above the free-text description. It is kept in
+// products.search_vector by triggers so full-text search can use an index.
+const productSearchVector = `setweight(to_tsvector('english', coalesce(NEW.name, '')), 'A') ||
+	setweight(to_tsvector('english', coalesce((SELECT name FROM categories WHERE id = NEW.category_id), '')), 'B') ||
+	setweight(to_tsvector('english', coalesce((SELECT user_name FROM sellers WHERE id = NEW.seller_id), '')), 'B') ||
+	setweight(to_tsvector('english', coalesce(NEW.description, '')), 'C')`
+
+// setupProductSearch maintains the indexed search_vector of products used by
+// full-text search, and enables trigram matching used by its typo-tolerant
+// fallback. Renaming a category or seller touches its products so their
+// vectors pick up the new name.
+func setupProductSearch() {
+	statements := []string{
+		"CREATE EXTENSION IF NOT EXISTS pg_trgm",
+		"CREATE INDEX IF NOT EXISTS idx_products_name_trgm ON products USING GIN (name gin_trgm_ops)",
+		"ALTER TABLE products ADD COLUMN IF NOT EXISTS search_vector tsvector",
+		`CREATE OR REPLACE FUNCTION products_search_vector_update() RETURNS trigger AS $$
+BEGIN
+	NEW.search_vector := ` + productSearchVector + `;
+	RETURN NEW;
+END
+$$ LANGUAGE plpgsql`,
+		"DROP TRIGGER IF EXISTS products_search_vector_update ON products",
+		`CREATE TRIGGER products_search_vector_update BEFORE INSERT OR UPDATE OF name, description, category_id, seller_id
+	ON products FOR EACH ROW EXECUTE FUNCTION products_search_vector_update()`,
+		`CREATE OR REPLACE FUNCTION categories_search_vector_update() RETURNS trigger AS $$
+BEGIN
+	UPDATE products SET name = name WHERE category_id = NEW.id;
+	RETURN NULL;
+END
+$$ LANGUAGE plpgsql`,
+		"DROP TRIGGER IF EXISTS categories_search_vector_update ON categories",
+		`CREATE TRIGGER categories_search_vector_update AFTER UPDATE OF name ON categories
+	FOR EACH ROW WHEN (OLD.name IS DISTINCT FROM NEW.name) EXECUTE FUNCTION categories_search_vector_update()`,
+		`CREATE OR REPLACE FUNCTION sellers_search_vector_update() RETURNS trigger AS $$
+BEGIN
+	UPDATE products SET name = name WHERE seller_id = NEW.id;
+	RETURN NULL;
+END
+$$ LANGUAGE plpgsql`,
+		"DROP TRIGGER IF EXISTS sellers_search_vector_update ON sellers",
+		`CREATE TRIGGER sellers_search_vector_update AFTER UPDATE OF user_name ON sellers
+	FOR EACH ROW WHEN (OLD.user_name IS DISTINCT FROM NEW.user_name) EXECUTE FUNCTION sellers_search_vector_update()`,
+		// fills in products written before the trigger existed
+		"UPDATE products SET name = name WHERE search_vector IS NULL",
+		"CREATE INDEX IF NOT EXISTS idx_products_search_vector ON products USING GIN (search_vector)",
+	}
+
+	for _, statement := range statements {
+		if err := DB.Exec(statement).Error; err != nil {
+			log.Printf("failed to set up product search: %v", err)
+			return
+		}
+	}
+}
+
+// markSoldOutProducts flags the products that ran out of stock before the
+// sold_out column existed, so releasing stock makes them available again.
+func markSoldOutProducts() {
+	if err := DB.Model(&models.Product{}).
+		Where("availability = ? AND stock_quantity = 0", false).
+		Update("sold_out", true).Error; err != nil {
+		log.Printf("failed to mark sold out products: %v", err)
+	}
+}
+
+// normalizeWalletEntryTypes upper-cases user wallet entries written before
+// the type constants were used for them, so filtering by type finds them.
+func normalizeWalletEntryTypes() {
+	if err := DB.Model(&models.UserWallet{}).
+		Where("type IN ?", []string{"incoming", "outgoing"}).
+		Update("type", gorm.Expr("UPPER(type)")).Error; err != nil {
+		log.Printf("failed to normalize wallet entry types: %v", err)
 	}
 }
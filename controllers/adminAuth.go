@@ -4,10 +4,10 @@ import (
 	"errors"
 	"knowledgeMart/config"
 	"knowledgeMart/models"
-	"knowledgeMart/utils"
 	"net/http"
 
 	"github.com/gin-gonic/gin"
+	"github.com/go-playground/validator/v10"
 	"gorm.io/gorm"
 )
 
@@ -47,7 +47,7 @@ func AdminLogin(c *gin.Context) {
 		})
 		return
 	}
-	token, err := utils.GenerateJWT(admin.ID, "admin")
+	token, refreshToken, err := StartSession(models.RoleAdmin, admin.ID)
 	if token == "" || err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{
 			"status":  "failed",
@@ -57,8 +57,81 @@ func AdminLogin(c *gin.Context) {
 	}
 
 	c.JSON(http.StatusOK, gin.H{
-		"token":   token,
+		"token":         token,
+		"refresh_token": refreshToken,
+		"role":          admin.Role,
+		"status":        "success",
+		"message":       "login success",
+	})
+}
+
+func UpdateAdminRole(c *gin.Context) {
+	adminID, exists := c.Get("adminID")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{
+			"status":  "failed",
+			"message": "not authorized ",
+		})
+		return
+	}
+
+	adminIDUint, ok := adminID.(uint)
+	if !ok {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"status":  "failed",
+			"message": "failed to retrieve admin information",
+		})
+		return
+	}
+
+	var request models.UpdateAdminRoleRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"status":  "failed",
+			"message": "failed to process the incoming request",
+		})
+		return
+	}
+
+	validate := validator.New()
+	if err := validate.Struct(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"status":  "failed",
+			"message": err.Error(),
+		})
+		return
+	}
+
+	if request.AdminID == adminIDUint && request.Role != models.AdminRoleSuper {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"status":  "failed",
+			"message": "you cannot remove your own super admin role",
+		})
+		return
+	}
+
+	result := database.DB.Model(&models.Admin{}).Where("id = ?", request.AdminID).Update("role", request.Role)
+	if result.Error != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"status":  "failed",
+			"message": "failed to update admin role",
+		})
+		return
+	}
+	if result.RowsAffected == 0 {
+		c.JSON(http.StatusNotFound, gin.H{
+			"status":  "failed",
+			"message": "admin not found",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
 		"status":  "success",
-		"message": "login success",
+		"message": "admin role updated successfully",
+		"data": gin.H{
+			"admin_id": request.AdminID,
+			"role":     request.Role,
+		},
 	})
 }
@@ -0,0 +1,254 @@
+package controllers
+
+import (
+	"errors"
+	"fmt"
+	database "knowledgeMart/config"
+	"knowledgeMart/models"
+	"knowledgeMart/utils"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-playground/validator/v10"
+	"gorm.io/gorm"
+)
+
+const defaultRefreshTokenDays = 30
+
+// RefreshTokenTTL is how long a session stays alive without being refreshed,
+// configured in days through REFRESH_TOKEN_TTL_DAYS.
+func RefreshTokenTTL() time.Duration {
+	days, err := strconv.Atoi(os.Getenv("REFRESH_TOKEN_TTL_DAYS"))
+	if err != nil || days <= 0 {
+		days = defaultRefreshTokenDays
+	}
+	return time.Duration(days) * 24 * time.Hour
+}
+
+// StartSession opens a login session for the owner and returns its first
+// access token and refresh token.
+func StartSession(role string, ownerID uint) (accessToken, refreshToken string, err error) {
+	refreshToken, err = utils.GenerateRefreshToken()
+	if err != nil {
+		return "", "", fmt.Errorf("failed to generate refresh token: %w", err)
+	}
+
+	session := models.AuthSession{
+		Role:             role,
+		OwnerID:          ownerID,
+		RefreshTokenHash: utils.HashToken(refreshToken),
+		ExpiresAt:        time.Now().Add(RefreshTokenTTL()),
+		LastUsedAt:       time.Now(),
+	}
+	if err := database.DB.Create(&session).Error; err != nil {
+		return "", "", fmt.Errorf("failed to create session: %w", err)
+	}
+
+	accessToken, err = utils.GenerateJWT(ownerID, role, session.ID)
+	if err != nil {
+		return "", "", err
+	}
+	return accessToken, refreshToken, nil
+}
+
+// RevokeSessions ends every open session of the owner except keep, so their
+// access tokens stop working on the next request.
+func RevokeSessions(tx *gorm.DB, role string, ownerID uint, reason string, keep uint) error {
+	query := tx.Model(&models.AuthSession{}).
+		Where("role = ? AND owner_id = ? AND revoked_at IS NULL", role, ownerID)
+	if keep != 0 {
+		query = query.Where("id <> ?", keep)
+	}
+	if err := query.Updates(map[string]interface{}{
+		"revoked_at":    time.Now(),
+		"revoke_reason": reason,
+	}).Error; err != nil {
+		return fmt.Errorf("failed to revoke sessions: %w", err)
+	}
+	return nil
+}
+
+// sessionOwnerActive reports whether the owner of a session may still log in.
+func sessionOwnerActive(session models.AuthSession) (bool, error) {
+	switch session.Role {
+	case models.RoleUser:
+		var user models.User
+		if err := database.DB.Select("id", "blocked").Where("id = ?", session.OwnerID).First(&user).Error; err != nil {
+			return false, err
+		}
+		return !user.Blocked, nil
+	case models.RoleSeller:
+		var seller models.Seller
+		if err := database.DB.Select("id", "is_verified").Where("id = ?", session.OwnerID).First(&seller).Error; err != nil {
+			return false, err
+		}
+		return seller.IsVerified, nil
+	case models.RoleAdmin:
+		var admin models.Admin
+		if err := database.DB.Select("id").Where("id = ?", session.OwnerID).First(&admin).Error; err != nil {
+			return false, err
+		}
+		return true, nil
+	}
+	return false, nil
+}
+
+// RefreshSession exchanges a refresh token for a new access token and a new
+// refresh token. A refresh token that was already rotated out is treated as
+// stolen and ends its session.
+func RefreshSession(c *gin.Context) {
+	var request models.RefreshTokenRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"status":  "failed",
+			"message": "failed to process the incoming request",
+		})
+		return
+	}
+
+	validate := validator.New()
+	if err := validate.Struct(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"status":  "failed",
+			"message": err.Error(),
+		})
+		return
+	}
+
+	tokenHash := utils.HashToken(request.RefreshToken)
+
+	var session models.AuthSession
+	if err := database.DB.Where("refresh_token_hash = ?", tokenHash).First(&session).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			var reused models.AuthSession
+			if err := database.DB.Where("previous_token_hash = ?", tokenHash).First(&reused).Error; err == nil {
+				database.DB.Model(&reused).Updates(map[string]interface{}{
+					"revoked_at":    time.Now(),
+					"revoke_reason": "refresh token reused",
+				})
+			}
+		}
+		c.JSON(http.StatusUnauthorized, gin.H{
+			"status":  "failed",
+			"message": "invalid refresh token",
+		})
+		return
+	}
+
+	if session.RevokedAt != nil || time.Now().After(session.ExpiresAt) {
+		c.JSON(http.StatusUnauthorized, gin.H{
+			"status":  "failed",
+			"message": "session has expired, please log in again",
+		})
+		return
+	}
+
+	active, err := sessionOwnerActive(session)
+	if err != nil || !active {
+		RevokeSessions(database.DB, session.Role, session.OwnerID, "account disabled", 0)
+		c.JSON(http.StatusUnauthorized, gin.H{
+			"status":  "failed",
+			"message": "account is not allowed to log in",
+		})
+		return
+	}
+
+	refreshToken, err := utils.GenerateRefreshToken()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"status":  "failed",
+			"message": "failed to generate refresh token",
+		})
+		return
+	}
+
+	// the hash in the where clause makes a concurrent refresh with the same
+	// token lose instead of forking the session
+	rotated := database.DB.Model(&models.AuthSession{}).
+		Where("id = ? AND refresh_token_hash = ? AND revoked_at IS NULL", session.ID, tokenHash).
+		Updates(map[string]interface{}{
+			"refresh_token_hash":  utils.HashToken(refreshToken),
+			"previous_token_hash": tokenHash,
+			"expires_at":          time.Now().Add(RefreshTokenTTL()),
+			"last_used_at":        time.Now(),
+		})
+	if rotated.Error != nil || rotated.RowsAffected == 0 {
+		c.JSON(http.StatusUnauthorized, gin.H{
+			"status":  "failed",
+			"message": "invalid refresh token",
+		})
+		return
+	}
+
+	accessToken, err := utils.GenerateJWT(session.OwnerID, session.Role, session.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"status":  "failed",
+			"message": "failed to generate token",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"status":  "success",
+		"message": "token refreshed successfully",
+		"data": gin.H{
+			"token":         accessToken,
+			"refresh_token": refreshToken,
+			"expires_in":    int(utils.AccessTokenTTL().Seconds()),
+		},
+	})
+}
+
+// Logout ends the session the access token belongs to, or every session of
+// the account when all_devices is set.
+func Logout(c *gin.Context) {
+	sessionID := c.GetUint("sessionID")
+	role := c.GetString("role")
+	ownerID := c.GetUint(role + "ID")
+	if sessionID == 0 || ownerID == 0 {
+		c.JSON(http.StatusUnauthorized, gin.H{
+			"status":  "failed",
+			"message": "not authorized",
+		})
+		return
+	}
+
+	var request models.LogoutRequest
+	if c.Request.ContentLength > 0 {
+		if err := c.ShouldBindJSON(&request); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"status":  "failed",
+				"message": "failed to process the incoming request",
+			})
+			return
+		}
+	}
+
+	var err error
+	if request.AllDevices {
+		err = RevokeSessions(database.DB, role, ownerID, "logged out everywhere", 0)
+	} else {
+		err = database.DB.Model(&models.AuthSession{}).
+			Where("id = ? AND revoked_at IS NULL", sessionID).
+			Updates(map[string]interface{}{
+				"revoked_at":    time.Now(),
+				"revoke_reason": "logged out",
+			}).Error
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"status":  "failed",
+			"message": "failed to log out",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"status":  "success",
+		"message": "logged out successfully",
+	})
+}
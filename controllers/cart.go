@@ -82,34 +82,53 @@ func AddToCart(c *gin.Context) {
 		return
 	}
 
+	quantity := Request.Quantity
+	if quantity == 0 {
+		quantity = 1
+	}
+
 	var existingCartItem models.Cart
 	if err := database.DB.Where("product_id = ? AND user_id = ?", Request.ProductID, UserIDStr).First(&existingCartItem).Error; err == nil {
-		c.JSON(http.StatusBadRequest, gin.H{
-			"status":  "failed",
-			"message": "This product is already in your cart.",
+		existingCartItem.Quantity += quantity
+		if existingCartItem.Quantity > Product.StockQuantity {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"status":  "failed",
+				"message": fmt.Sprintf("only %d units of this product are in stock", Product.StockQuantity),
+			})
+			return
+		}
+
+		if err := database.DB.Model(&existingCartItem).Update("quantity", existingCartItem.Quantity).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"status":  "failed",
+				"message": "Failed to update cart quantity. Please try again later.",
+			})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"status":  "success",
+			"message": "Product quantity updated in cart successfully",
+			"data": gin.H{
+				"cartId":   existingCartItem.ID,
+				"quantity": existingCartItem.Quantity,
+			},
 		})
 		return
 	}
 
-	var userCartItems []models.Cart
-	if err := database.DB.Where("user_id = ?", UserIDStr).Find(&userCartItems).Error; err == nil {
-		for _, cartItem := range userCartItems {
-			var cartProduct models.Product
-			if err := database.DB.Where("id = ?", cartItem.ProductID).First(&cartProduct).Error; err == nil {
-				if cartProduct.SellerID != Product.SellerID {
-					c.JSON(http.StatusBadRequest, gin.H{
-						"status":  "failed",
-						"message": "You can only add products from one seller at a time. Please complete or clear your current cart before adding products from a different seller.",
-					})
-					return
-				}
-			}
-		}
+	if quantity > Product.StockQuantity {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"status":  "failed",
+			"message": fmt.Sprintf("only %d units of this product are in stock", Product.StockQuantity),
+		})
+		return
 	}
 
 	cart := models.Cart{
 		ProductID: Request.ProductID,
 		UserID:    UserIDStr,
+		Quantity:  quantity,
 	}
 
 	if err := database.DB.Create(&cart).Error; err != nil {
@@ -185,9 +204,9 @@ func ListAllCart(c *gin.Context) {
 			return
 		}
 
-		finalAmount := calculateFinalAmount(cart.Product.OfferAmount, category.OfferPercentage)
+		finalAmount := calculateFinalAmount(cart.Product.OfferAmount, category.OfferPercentage) * float64(cart.Quantity)
 		TotalAmount += finalAmount
-		ItemCount++
+		ItemCount += int(cart.Quantity)
 
 		var seller models.Seller
 		if err := database.DB.Where("id = ?", cart.Product.SellerID).Select("average_rating").First(&seller).Error; err != nil {
@@ -210,6 +229,7 @@ func ListAllCart(c *gin.Context) {
 			Image:        cart.Product.Image,
 			SellerRating: seller.AverageRating,
 			ID:           cart.ID,
+			Quantity:     cart.Quantity,
 		})
 	}
 
@@ -226,6 +246,86 @@ func ListAllCart(c *gin.Context) {
 	})
 }
 
+func UpdateCartQuantity(c *gin.Context) {
+	userID, exists := c.Get("userID")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{
+			"status":  "failed",
+			"message": "user not authorized",
+		})
+		return
+	}
+
+	userIDUint, ok := userID.(uint)
+	if !ok {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"status":  "failed",
+			"message": "failed to retrieve user information",
+		})
+		return
+	}
+
+	var Request models.UpdateCartQuantityRequest
+	if err := c.BindJSON(&Request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"status":  "failed",
+			"message": "failed to process request",
+		})
+		return
+	}
+
+	validate := validator.New()
+	if err := validate.Struct(&Request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"status":  "failed",
+			"message": err.Error(),
+		})
+		return
+	}
+
+	var cart models.Cart
+	if err := database.DB.Preload("Product").Where("id = ? AND user_id = ?", Request.CartID, userIDUint).First(&cart).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{
+			"status":  "failed",
+			"message": "product is not present in the cart",
+		})
+		return
+	}
+
+	if !cart.Product.Availability {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"status":  "failed",
+			"message": "Product is not available",
+		})
+		return
+	}
+
+	if Request.Quantity > cart.Product.StockQuantity {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"status":  "failed",
+			"message": fmt.Sprintf("only %d units of this product are in stock", cart.Product.StockQuantity),
+		})
+		return
+	}
+
+	if err := database.DB.Model(&cart).Update("quantity", Request.Quantity).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"status":  "failed",
+			"message": "unable to update cart quantity",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"status":  "success",
+		"message": "successfully updated cart quantity",
+		"data": gin.H{
+			"cartId":   cart.ID,
+			"quantity": Request.Quantity,
+		},
+	})
+}
+
 func RemoveItemFromCart(c *gin.Context) {
 	userID, exists := c.Get("userID")
 	if !exists {
@@ -0,0 +1,332 @@
+package controllers
+
+import (
+	"fmt"
+	database "knowledgeMart/config"
+	"knowledgeMart/models"
+	"math"
+	"net/http"
+	"os"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-playground/validator/v10"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const defaultGatewayFeePercent = 2
+
+// GatewayFeePercent is the share of a gateway payment the gateway keeps,
+// passed on to the seller, configured through GATEWAY_FEE_PERCENT.
+func GatewayFeePercent() float64 {
+	percent, err := strconv.ParseFloat(os.Getenv("GATEWAY_FEE_PERCENT"), 64)
+	if err != nil || percent < 0 {
+		percent = defaultGatewayFeePercent
+	}
+	return percent
+}
+
+// CommissionPercent returns the commission the platform takes on a sale by
+// the seller in the category. A seller rule wins over a category rule, which
+// wins over the global rule; without any rule no commission is taken.
+func CommissionPercent(tx *gorm.DB, sellerID, categoryID uint) (float64, error) {
+	var rules []models.CommissionRule
+	if err := tx.Where("(scope = ? AND seller_id = ?) OR (scope = ? AND category_id = ?) OR scope = ?",
+		models.CommissionScopeSeller, sellerID,
+		models.CommissionScopeCategory, categoryID,
+		models.CommissionScopeGlobal).
+		Find(&rules).Error; err != nil {
+		return 0, fmt.Errorf("failed to retrieve commission rules: %w", err)
+	}
+
+	rank := map[string]int{
+		models.CommissionScopeGlobal:   1,
+		models.CommissionScopeCategory: 2,
+		models.CommissionScopeSeller:   3,
+	}
+	var percent float64
+	var best int
+	for _, rule := range rules {
+		if rank[rule.Scope] > best {
+			best = rank[rule.Scope]
+			percent = rule.Percentage
+		}
+	}
+	return percent, nil
+}
+
+// deductOrderFees takes the platform commission and the gateway fee out of
+// the proceeds of order held in the seller's escrow, each as its own ledger
+// line and wallet history entry.
+func deductOrderFees(tx *gorm.DB, order models.Order) error {
+	var items []models.OrderItem
+	if err := tx.Preload("Product").Where("order_id = ?", order.OrderID).Find(&items).Error; err != nil {
+		return fmt.Errorf("failed to retrieve order items: %w", err)
+	}
+
+	var commission float64
+	for _, item := range items {
+		if item.Status == models.OrderStatusCanceled {
+			continue
+		}
+		percent, err := CommissionPercent(tx, order.SellerID, item.Product.CategoryID)
+		if err != nil {
+			return err
+		}
+		commission += item.FinalAmount * percent / 100
+	}
+	commission = RoundDecimalValue(math.Min(commission, order.FinalAmount))
+
+	var gatewayFee float64
+	if order.PaymentMethod == models.Razorpay {
+		gatewayFee = RoundDecimalValue(order.FinalAmount * GatewayFeePercent() / 100)
+	}
+
+	if commission == 0 && gatewayFee == 0 {
+		return nil
+	}
+
+	lines := []LedgerLine{
+		{Account: SellerEscrowAccount(order.SellerID), Amount: -RoundDecimalValue(commission + gatewayFee)},
+	}
+	if commission > 0 {
+		lines = append(lines, LedgerLine{Account: PlatformAccount(models.LedgerCommission), Amount: commission})
+	}
+	if gatewayFee > 0 {
+		lines = append(lines, LedgerLine{Account: PlatformAccount(models.LedgerGatewayFees), Amount: gatewayFee})
+	}
+	if _, err := PostJournalEntry(tx, fmt.Sprintf("FEES_ORDER_%d", order.OrderID), "Platform commission and gateway fee", lines...); err != nil {
+		return err
+	}
+
+	if err := tx.Model(&models.Order{}).Where("order_id = ?", order.OrderID).Updates(map[string]interface{}{
+		"commission_amount":  commission,
+		"gateway_fee_amount": gatewayFee,
+		"escrow_amount":      gorm.Expr("escrow_amount - ?", RoundDecimalValue(commission+gatewayFee)),
+	}).Error; err != nil {
+		return fmt.Errorf("failed to record order fees: %w", err)
+	}
+
+	if commission > 0 {
+		if err := recordSellerWalletTransaction(tx, order.SellerID, order.OrderID, models.WalletOutgoing, models.WalletEntryPending, commission, "Platform commission"); err != nil {
+			return err
+		}
+	}
+	if gatewayFee > 0 {
+		if err := recordSellerWalletTransaction(tx, order.SellerID, order.OrderID, models.WalletOutgoing, models.WalletEntryPending, gatewayFee, "Payment gateway fee"); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// returnCommission gives the seller back the commission taken on the part of
+// the order being refunded, its share of orderTotal, the order total before
+// the refund. Gateway fees are not returned since the gateway keeps them.
+func returnCommission(tx *gorm.DB, orderID uint, amount, orderTotal float64, to LedgerAccountRef, status string) error {
+	var order models.Order
+	if err := tx.Where("order_id = ?", orderID).First(&order).Error; err != nil {
+		return fmt.Errorf("failed to find order with ID %d: %w", orderID, err)
+	}
+
+	if order.CommissionAmount <= 0 || orderTotal <= 0 {
+		return nil
+	}
+
+	// the commission not yet returned belongs to what is left of the order
+	remaining := RoundDecimalValue(order.CommissionAmount - order.CommissionRefunded)
+	share := RoundDecimalValue(remaining * math.Min(amount, orderTotal) / orderTotal)
+	if share <= 0 {
+		return nil
+	}
+
+	if _, err := PostJournalEntry(tx, fmt.Sprintf("COMMISSION_REFUND_ORDER_%d", order.OrderID), "Commission returned on refund",
+		LedgerLine{Account: PlatformAccount(models.LedgerCommission), Amount: -share},
+		LedgerLine{Account: to, Amount: share},
+	); err != nil {
+		return err
+	}
+
+	updates := map[string]interface{}{
+		"commission_refunded": gorm.Expr("commission_refunded + ?", share),
+	}
+	if to.Type == models.LedgerSellerEscrow {
+		updates["escrow_amount"] = gorm.Expr("escrow_amount + ?", share)
+	}
+	if err := tx.Model(&models.Order{}).Where("order_id = ?", order.OrderID).Updates(updates).Error; err != nil {
+		return fmt.Errorf("failed to update order commission: %w", err)
+	}
+
+	return recordSellerWalletTransaction(tx, order.SellerID, order.OrderID, models.WalletIncoming, status, share, "Commission returned on refund")
+}
+
+func SaveCommissionRule(c *gin.Context) {
+	adminID, exists := c.Get("adminID")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{
+			"status":  "failed",
+			"message": "not authorized ",
+		})
+		return
+	}
+
+	if _, ok := adminID.(uint); !ok {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"status":  "failed",
+			"message": "failed to retrieve admin information",
+		})
+		return
+	}
+
+	var request models.CommissionRuleRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"status":  "failed",
+			"message": "failed to process the incoming request",
+		})
+		return
+	}
+
+	validate := validator.New()
+	if err := validate.Struct(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"status":  "failed",
+			"message": err.Error(),
+		})
+		return
+	}
+
+	rule := models.CommissionRule{
+		Scope:      request.Scope,
+		Percentage: request.Percentage,
+	}
+	switch request.Scope {
+	case models.CommissionScopeCategory:
+		var category models.Category
+		if err := database.DB.Where("id = ?", request.CategoryID).First(&category).Error; err != nil {
+			c.JSON(http.StatusNotFound, gin.H{
+				"status":  "failed",
+				"message": "category not found",
+			})
+			return
+		}
+		rule.CategoryID = request.CategoryID
+	case models.CommissionScopeSeller:
+		var seller models.Seller
+		if err := database.DB.Where("id = ?", request.SellerID).First(&seller).Error; err != nil {
+			c.JSON(http.StatusNotFound, gin.H{
+				"status":  "failed",
+				"message": "seller not found",
+			})
+			return
+		}
+		rule.SellerID = request.SellerID
+	}
+
+	if err := database.DB.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "scope"}, {Name: "category_id"}, {Name: "seller_id"}},
+		DoUpdates: clause.AssignmentColumns([]string{"percentage", "updated_at"}),
+	}).Create(&rule).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"status":  "failed",
+			"message": "failed to save commission rule",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"status":  "success",
+		"message": "commission rule saved successfully",
+		"data": gin.H{
+			"rule": rule,
+		},
+	})
+}
+
+func ListCommissionRules(c *gin.Context) {
+	adminID, exists := c.Get("adminID")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{
+			"status":  "failed",
+			"message": "not authorized ",
+		})
+		return
+	}
+
+	if _, ok := adminID.(uint); !ok {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"status":  "failed",
+			"message": "failed to retrieve admin information",
+		})
+		return
+	}
+
+	var rules []models.CommissionRule
+	if err := database.DB.Order("scope, category_id, seller_id").Find(&rules).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"status":  "failed",
+			"message": "failed to retrieve commission rules",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"status":  "success",
+		"message": "successfully retrieved commission rules",
+		"data": gin.H{
+			"rules":               rules,
+			"gateway_fee_percent": GatewayFeePercent(),
+		},
+	})
+}
+
+func DeleteCommissionRule(c *gin.Context) {
+	adminID, exists := c.Get("adminID")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{
+			"status":  "failed",
+			"message": "not authorized ",
+		})
+		return
+	}
+
+	if _, ok := adminID.(uint); !ok {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"status":  "failed",
+			"message": "failed to retrieve admin information",
+		})
+		return
+	}
+
+	ruleID, err := strconv.Atoi(c.Query("ruleid"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"status":  "failed",
+			"message": "invalid rule id",
+		})
+		return
+	}
+
+	result := database.DB.Where("id = ?", ruleID).Delete(&models.CommissionRule{})
+	if result.Error != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"status":  "failed",
+			"message": "failed to delete commission rule",
+		})
+		return
+	}
+	if result.RowsAffected == 0 {
+		c.JSON(http.StatusNotFound, gin.H{
+			"status":  "failed",
+			"message": "commission rule not found",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"status":  "success",
+		"message": "commission rule deleted successfully",
+	})
+}
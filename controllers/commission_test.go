@@ -0,0 +1,115 @@
+package controllers
+
+import (
+	database "knowledgeMart/config"
+	"knowledgeMart/models"
+	"strconv"
+	"testing"
+)
+
+// createPaidOrderWithCommission stores a paid order whose proceeds sit in the
+// seller's escrow after the platform took commission on them.
+func createPaidOrderWithCommission(t *testing.T, suffix string, amount, commission float64) models.Order {
+	t.Helper()
+
+	_, order, _ := createPendingCheckout(t, suffix, amount)
+
+	if _, err := PostJournalEntry(database.DB, "TEST_PAYMENT_"+suffix, "Test order payment",
+		LedgerLine{Account: PlatformAccount(models.LedgerGatewayClearing), Amount: -amount},
+		LedgerLine{Account: SellerEscrowAccount(order.SellerID), Amount: amount},
+	); err != nil {
+		t.Fatalf("failed to post order payment: %v", err)
+	}
+	if _, err := PostJournalEntry(database.DB, "TEST_FEES_"+suffix, "Test commission",
+		LedgerLine{Account: SellerEscrowAccount(order.SellerID), Amount: -commission},
+		LedgerLine{Account: PlatformAccount(models.LedgerCommission), Amount: commission},
+	); err != nil {
+		t.Fatalf("failed to post commission: %v", err)
+	}
+
+	order.PaymentStatus = models.PaymentStatusPaid
+	order.CommissionAmount = commission
+	order.EscrowAmount = amount - commission
+	if err := database.DB.Save(&order).Error; err != nil {
+		t.Fatalf("failed to update order: %v", err)
+	}
+	return order
+}
+
+// refundPartOfOrder lowers the order total and refunds the difference to the
+// buyer's wallet the way CancelOrder and completeReturn do.
+func refundPartOfOrder(t *testing.T, order models.Order, amount float64) {
+	t.Helper()
+
+	var current models.Order
+	if err := database.DB.Where("order_id = ?", order.OrderID).First(&current).Error; err != nil {
+		t.Fatalf("failed to load order: %v", err)
+	}
+	orderTotal := current.FinalAmount
+
+	tx := database.DB.Begin()
+	if err := tx.Model(&current).Update("final_amount", RoundDecimalValue(orderTotal-amount)).Error; err != nil {
+		tx.Rollback()
+		t.Fatalf("failed to update order total: %v", err)
+	}
+	if err := RefundToUser(tx, order.UserID, strconv.Itoa(int(order.OrderID)), amount, orderTotal, "Test refund", false, models.RefundDestinationWallet); err != nil {
+		tx.Rollback()
+		t.Fatalf("failed to refund: %v", err)
+	}
+	if err := tx.Commit().Error; err != nil {
+		t.Fatalf("failed to commit refund: %v", err)
+	}
+}
+
+func TestRefundReturnsCommission(t *testing.T) {
+	useTestDatabase(t)
+
+	commissionBefore, err := LedgerBalance(database.DB, PlatformAccount(models.LedgerCommission))
+	if err != nil {
+		t.Fatalf("failed to read commission balance: %v", err)
+	}
+
+	order := createPaidOrderWithCommission(t, uniqueSuffix(), 100, 10)
+
+	steps := []struct {
+		name           string
+		amount         float64
+		wantReturned   float64
+		wantEscrow     float64
+		wantCommission float64
+	}{
+		{"partial refund", 40, 4, 54, 6},
+		{"refund of the rest", 60, 10, 0, 0},
+	}
+
+	for _, step := range steps {
+		refundPartOfOrder(t, order, step.amount)
+
+		var updated models.Order
+		if err := database.DB.Where("order_id = ?", order.OrderID).First(&updated).Error; err != nil {
+			t.Fatalf("%s: failed to load order: %v", step.name, err)
+		}
+		if RoundDecimalValue(updated.CommissionRefunded) != step.wantReturned {
+			t.Errorf("%s: commission_refunded = %v, want %v", step.name, updated.CommissionRefunded, step.wantReturned)
+		}
+		if RoundDecimalValue(updated.EscrowAmount) != step.wantEscrow {
+			t.Errorf("%s: escrow_amount = %v, want %v", step.name, updated.EscrowAmount, step.wantEscrow)
+		}
+
+		escrow, err := LedgerBalance(database.DB, SellerEscrowAccount(order.SellerID))
+		if err != nil {
+			t.Fatalf("%s: failed to read escrow balance: %v", step.name, err)
+		}
+		if RoundDecimalValue(escrow) != step.wantEscrow {
+			t.Errorf("%s: escrow ledger balance = %v, want %v", step.name, escrow, step.wantEscrow)
+		}
+
+		commission, err := LedgerBalance(database.DB, PlatformAccount(models.LedgerCommission))
+		if err != nil {
+			t.Fatalf("%s: failed to read commission balance: %v", step.name, err)
+		}
+		if got := RoundDecimalValue(commission - commissionBefore); got != step.wantCommission {
+			t.Errorf("%s: commission kept = %v, want %v", step.name, got, step.wantCommission)
+		}
+	}
+}
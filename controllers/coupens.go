@@ -13,6 +13,7 @@ import (
 	"github.com/gin-gonic/gin"
 	"github.com/go-playground/validator/v10"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
 func CreateCoupen(c *gin.Context) {
@@ -340,10 +341,11 @@ func ApplyCouponOnCart(c *gin.Context) {
 			Image:        item.Product.Image,
 			SellerRating: Product.Seller.AverageRating,
 			ID:           item.ID,
+			Quantity:     item.Quantity,
 		})
 
 		//ProductOfferAmount += float64(ProductOfferAmount) * float64()
-		sum += Product.OfferAmount
+		sum += Product.OfferAmount * float64(item.Quantity)
 
 	}
 	var couponDiscount float64
@@ -415,9 +417,11 @@ func ApplyCouponOnCart(c *gin.Context) {
 	})
 }
 
-func ApplyCouponToOrder(TotalAmount float64, UserID uint, CouponCode string) (bool, string, float64) {
+// ApplyCouponToOrder checks the coupon against the order total and records
+// one more use of it on tx.
+func ApplyCouponToOrder(tx *gorm.DB, TotalAmount float64, UserID uint, CouponCode string) (bool, string, float64) {
 	var coupon models.CouponInventory
-	if err := database.DB.Where("coupon_code = ?", CouponCode).First(&coupon).Error; err != nil {
+	if err := tx.Where("coupon_code = ?", CouponCode).First(&coupon).Error; err != nil {
 		return false, "coupon not found", 0
 	}
 
@@ -426,7 +430,7 @@ func ApplyCouponToOrder(TotalAmount float64, UserID uint, CouponCode string) (bo
 	}
 
 	var couponUsage models.CouponUsage
-	err := database.DB.Where("coupon_code = ? AND user_id = ?", CouponCode, UserID).First(&couponUsage).Error
+	err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("coupon_code = ? AND user_id = ?", CouponCode, UserID).First(&couponUsage).Error
 	if err == nil && couponUsage.UsageCount >= coupon.MaximumUsage {
 		return false, "coupon usage limit reached", 0
 	} else if err != nil && err != gorm.ErrRecordNotFound {
@@ -450,12 +454,12 @@ func ApplyCouponToOrder(TotalAmount float64, UserID uint, CouponCode string) (bo
 			CouponCode: CouponCode,
 			UsageCount: 1,
 		}
-		if err := database.DB.Create(&couponUsage).Error; err != nil {
+		if err := tx.Create(&couponUsage).Error; err != nil {
 			return false, "failed to create coupon usage record", 0
 		}
 	} else {
 		couponUsage.UsageCount++
-		if err := database.DB.Where("user_id = ? AND coupon_code = ?", UserID, CouponCode).Save(&couponUsage).Error; err != nil {
+		if err := tx.Where("user_id = ? AND coupon_code = ?", UserID, CouponCode).Save(&couponUsage).Error; err != nil {
 			return false, "failed to update coupon usage record", 0
 		}
 	}
@@ -0,0 +1,154 @@
+package controllers
+
+import (
+	"errors"
+	"fmt"
+	database "knowledgeMart/config"
+	"knowledgeMart/mailer"
+	"knowledgeMart/models"
+	"log"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const (
+	emailOutboxInterval    = 30 * time.Second
+	emailOutboxBatchSize   = 50
+	emailMaxAttempts       = 8
+	emailRetryInitialDelay = time.Minute
+)
+
+// QueueEmail renders the email for event and stores it in the outbox on tx,
+// so it is only sent once the surrounding transaction commits. Delivery
+// happens in the background and never fails the request that queued it.
+func QueueEmail(tx *gorm.DB, to, event string, data interface{}) error {
+	if to == "" {
+		return nil
+	}
+
+	message, err := mailer.Render(event, to, data)
+	if err != nil {
+		return err
+	}
+
+	email := models.EmailOutbox{
+		Event:         event,
+		To:            message.To,
+		Subject:       message.Subject,
+		TextBody:      message.Text,
+		HTMLBody:      message.HTML,
+		Status:        models.EmailStatusPending,
+		NextAttemptAt: time.Now(),
+	}
+	if err := tx.Create(&email).Error; err != nil {
+		return fmt.Errorf("failed to queue email: %w", err)
+	}
+	return nil
+}
+
+// queueUserEmail queues an email to the user's address. A failure is only
+// logged, since a missing email must not undo the change it reports.
+func queueUserEmail(tx *gorm.DB, userID uint, event string, data map[string]interface{}) {
+	var user models.User
+	if err := tx.Select("id", "name", "email").Where("id = ?", userID).First(&user).Error; err != nil {
+		log.Printf("failed to find user %d for %s email: %v", userID, event, err)
+		return
+	}
+
+	if _, ok := data["Name"]; !ok {
+		data["Name"] = user.Name
+	}
+	if err := QueueEmail(tx, user.Email, event, data); err != nil {
+		log.Printf("failed to queue %s email for user %d: %v", event, userID, err)
+	}
+}
+
+// StartEmailOutboxScheduler delivers queued emails for as long as the server
+// runs.
+func StartEmailOutboxScheduler() {
+	go func() {
+		ticker := time.NewTicker(emailOutboxInterval)
+		defer ticker.Stop()
+
+		for {
+			DeliverPendingEmails()
+			<-ticker.C
+		}
+	}()
+}
+
+// DeliverPendingEmails sends every queued email that is due. A failed send is
+// retried with a doubling delay until emailMaxAttempts, after which the email
+// is marked failed and left for inspection.
+func DeliverPendingEmails() {
+	sender, err := mailer.New()
+	if err != nil {
+		log.Printf("failed to set up mailer: %v", err)
+		return
+	}
+
+	var emailIDs []uint
+	if err := database.DB.Model(&models.EmailOutbox{}).
+		Where("status = ? AND next_attempt_at <= ?", models.EmailStatusPending, time.Now()).
+		Order("next_attempt_at").
+		Limit(emailOutboxBatchSize).
+		Pluck("id", &emailIDs).Error; err != nil {
+		log.Printf("failed to find queued emails: %v", err)
+		return
+	}
+
+	for _, emailID := range emailIDs {
+		if err := deliverEmail(sender, emailID); err != nil {
+			log.Printf("failed to deliver email %d: %v", emailID, err)
+		}
+	}
+}
+
+func deliverEmail(sender mailer.Mailer, emailID uint) error {
+	tx := database.DB.Begin()
+
+	var email models.EmailOutbox
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE", Options: "SKIP LOCKED"}).
+		Where("id = ? AND status = ?", emailID, models.EmailStatusPending).
+		First(&email).Error; err != nil {
+		tx.Rollback()
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			// sent by another worker in the meantime
+			return nil
+		}
+		return err
+	}
+
+	sendErr := sender.Send(mailer.Message{
+		To:      email.To,
+		Subject: email.Subject,
+		Text:    email.TextBody,
+		HTML:    email.HTMLBody,
+	})
+
+	updates := map[string]interface{}{"attempts": email.Attempts + 1}
+	if sendErr == nil {
+		updates["status"] = models.EmailStatusSent
+		updates["sent_at"] = time.Now()
+		updates["last_error"] = ""
+	} else {
+		updates["last_error"] = sendErr.Error()
+		if email.Attempts+1 >= emailMaxAttempts {
+			updates["status"] = models.EmailStatusFailed
+		} else {
+			updates["next_attempt_at"] = time.Now().Add(emailRetryInitialDelay << email.Attempts)
+		}
+	}
+
+	if err := tx.Model(&email).Updates(updates).Error; err != nil {
+		tx.Rollback()
+		return fmt.Errorf("failed to update email: %w", err)
+	}
+	if err := tx.Commit().Error; err != nil {
+		return err
+	}
+
+	return sendErr
+}
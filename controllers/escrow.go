@@ -0,0 +1,185 @@
+package controllers
+
+import (
+	"errors"
+	"fmt"
+	database "knowledgeMart/config"
+	"knowledgeMart/models"
+	"log"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const escrowReleaseInterval = time.Hour
+
+// holdOrderProceeds records amount as held in escrow for the order once it
+// has been posted to the seller's escrow account.
+func holdOrderProceeds(tx *gorm.DB, order models.Order, amount float64) error {
+	if err := tx.Model(&models.Order{}).Where("order_id = ?", order.OrderID).
+		Update("escrow_amount", gorm.Expr("escrow_amount + ?", amount)).Error; err != nil {
+		return fmt.Errorf("failed to hold order proceeds: %w", err)
+	}
+
+	if err := recordSellerWalletTransaction(tx, order.SellerID, order.OrderID, models.WalletIncoming, models.WalletEntryPending, amount, "Order payment held until the return window closes"); err != nil {
+		return err
+	}
+
+	return deductOrderFees(tx, order)
+}
+
+// sellerRefundAccount picks the account a refund on the order is taken from:
+// the seller's escrow while the proceeds are still held there, otherwise the
+// seller's wallet. It also returns the wallet history state of the refund.
+func sellerRefundAccount(tx *gorm.DB, orderID uint, amount float64) (LedgerAccountRef, string, error) {
+	var order models.Order
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+		Where("order_id = ?", orderID).
+		First(&order).Error; err != nil {
+		return LedgerAccountRef{}, "", fmt.Errorf("failed to find order with ID %d: %w", orderID, err)
+	}
+
+	// escrow may go below zero here, when the fees taken from it are kept
+	// on a refund, and the difference is settled from the wallet on release
+	amount = RoundDecimalValue(amount)
+	if order.EscrowReleasedAt != nil || RoundDecimalValue(order.EscrowAmount) == 0 {
+		return SellerWalletAccount(order.SellerID), models.WalletEntryAvailable, nil
+	}
+
+	if err := tx.Model(&models.Order{}).Where("order_id = ?", orderID).
+		Update("escrow_amount", RoundDecimalValue(order.EscrowAmount-amount)).Error; err != nil {
+		return LedgerAccountRef{}, "", fmt.Errorf("failed to update order escrow: %w", err)
+	}
+	return SellerEscrowAccount(order.SellerID), models.WalletEntryPending, nil
+}
+
+// StartEscrowReleaseScheduler periodically releases held order proceeds whose
+// return window has closed for as long as the server runs.
+func StartEscrowReleaseScheduler() {
+	go func() {
+		ticker := time.NewTicker(escrowReleaseInterval)
+		defer ticker.Stop()
+
+		for {
+			ReleaseDueEscrow()
+			<-ticker.C
+		}
+	}()
+}
+
+// ReleaseDueEscrow moves the proceeds of every settled order from escrow to
+// the seller's available balance. An order is settled when none of its items
+// can still change, that is all are delivered, canceled or returned, and the
+// return window of its last delivered item has closed.
+func ReleaseDueEscrow() {
+	var orderIDs []uint
+	if err := database.DB.Model(&models.Order{}).
+		Where("escrow_amount <> 0 AND escrow_released_at IS NULL").
+		Where("NOT EXISTS (SELECT 1 FROM order_items WHERE order_items.order_id = orders.order_id AND order_items.status NOT IN ?)",
+			[]string{models.OrderStatusDelivered, models.OrderStatusCanceled, models.OrderStatusReturned}).
+		Pluck("order_id", &orderIDs).Error; err != nil {
+		log.Printf("failed to find orders with held proceeds: %v", err)
+		return
+	}
+
+	for _, orderID := range orderIDs {
+		if err := releaseOrderEscrow(orderID); err != nil {
+			log.Printf("failed to release escrow for order %d: %v", orderID, err)
+		}
+	}
+}
+
+func releaseOrderEscrow(orderID uint) error {
+	tx := database.DB.Begin()
+
+	var order models.Order
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE", Options: "SKIP LOCKED"}).
+		Where("order_id = ?", orderID).
+		First(&order).Error; err != nil {
+		tx.Rollback()
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			// locked by a refund being taken from it right now
+			return nil
+		}
+		return err
+	}
+
+	if order.EscrowReleasedAt != nil || RoundDecimalValue(order.EscrowAmount) == 0 {
+		tx.Rollback()
+		return nil
+	}
+
+	due, err := escrowReleaseDue(tx, order)
+	if err != nil || !due {
+		tx.Rollback()
+		return err
+	}
+
+	// a negative amount settles fees kept on a refunded order
+	amount := RoundDecimalValue(order.EscrowAmount)
+	if _, err := PostJournalEntry(tx, fmt.Sprintf("ESCROW_ORDER_%d", order.OrderID), "Order proceeds released",
+		LedgerLine{Account: SellerEscrowAccount(order.SellerID), Amount: -amount},
+		LedgerLine{Account: SellerWalletAccount(order.SellerID), Amount: amount},
+	); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	now := time.Now()
+	if err := tx.Model(&models.Order{}).Where("order_id = ?", order.OrderID).Updates(map[string]interface{}{
+		"escrow_amount":      0,
+		"escrow_released_at": &now,
+	}).Error; err != nil {
+		tx.Rollback()
+		return fmt.Errorf("failed to update order escrow: %w", err)
+	}
+
+	walletType, walletAmount, reason := models.WalletIncoming, amount, "Order payment released after the return window"
+	if amount < 0 {
+		walletType, walletAmount, reason = models.WalletOutgoing, -amount, "Fees on refunded order settled after the return window"
+	}
+	if err := recordSellerWalletTransaction(tx, order.SellerID, order.OrderID, walletType, models.WalletEntryAvailable, walletAmount, reason); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	return tx.Commit().Error
+}
+
+func escrowReleaseDue(tx *gorm.DB, order models.Order) (bool, error) {
+	var items []models.OrderItem
+	if err := tx.Where("order_id = ?", order.OrderID).Find(&items).Error; err != nil {
+		return false, fmt.Errorf("failed to retrieve order items: %w", err)
+	}
+
+	var openReturns int64
+	if err := tx.Model(&models.ReturnRequest{}).
+		Where("order_id = ? AND status NOT IN ?", order.OrderID, []string{models.ReturnStatusRejected, models.ReturnStatusReceived}).
+		Count(&openReturns).Error; err != nil {
+		return false, fmt.Errorf("failed to check return requests: %w", err)
+	}
+	if openReturns > 0 {
+		return false, nil
+	}
+
+	window := ReturnWindow()
+	for _, item := range items {
+		switch item.Status {
+		case models.OrderStatusCanceled, models.OrderStatusReturned:
+			continue
+		case models.OrderStatusDelivered:
+			deliveredAt, err := OrderItemDeliveredAt(tx, item)
+			if err != nil {
+				return false, err
+			}
+			if time.Since(deliveredAt) < window {
+				return false, nil
+			}
+		default:
+			return false, nil
+		}
+	}
+
+	return true, nil
+}
@@ -0,0 +1,191 @@
+package controllers
+
+import (
+	database "knowledgeMart/config"
+	"knowledgeMart/models"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// LinkGoogleAccount starts the Google sign-in that attaches a Google identity
+// to the logged-in user. The returned URL is opened in the same browser, and
+// the callback finishes the link.
+func LinkGoogleAccount(c *gin.Context) {
+	userID, exists := c.Get("userID")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{
+			"status":  "failed",
+			"message": "user not authorized",
+		})
+		return
+	}
+
+	userIDUint, ok := userID.(uint)
+	if !ok {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"status":  "failed",
+			"message": "failed to retrieve user information",
+		})
+		return
+	}
+
+	var user models.User
+	if err := database.DB.Where("id = ?", userIDUint).First(&user).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{
+			"status":  "failed",
+			"message": "user not found",
+		})
+		return
+	}
+
+	if user.GoogleID != "" {
+		c.JSON(http.StatusConflict, gin.H{
+			"status":  "failed",
+			"message": "a google account is already linked, unlink it first",
+		})
+		return
+	}
+
+	url, err := googleAuthURL(c, googleStatePurposeLink, user.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"status":  "failed",
+			"message": err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"status":  "success",
+		"message": "open the url to link your google account",
+		"data": gin.H{
+			"url": url,
+		},
+	})
+}
+
+// linkGoogleAccount finishes a link started by LinkGoogleAccount once Google
+// has redirected back with the identity.
+func linkGoogleAccount(c *gin.Context, userID uint, googleUser models.GoogleResponse) {
+	var user models.User
+	if err := database.DB.Where("id = ?", userID).First(&user).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{
+			"status":  "failed",
+			"message": "user not found",
+		})
+		return
+	}
+
+	if user.Blocked {
+		c.JSON(http.StatusUnauthorized, gin.H{
+			"status":  "failed",
+			"message": "user is unauthorized to access",
+		})
+		return
+	}
+
+	var owners int64
+	if err := database.DB.Model(&models.User{}).
+		Where("google_id = ? AND id <> ?", googleUser.ID, user.ID).
+		Count(&owners).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"status":  "failed",
+			"message": "failed to fetch user from database",
+		})
+		return
+	}
+	if owners > 0 {
+		c.JSON(http.StatusConflict, gin.H{
+			"status":  "failed",
+			"message": "this google account is already linked to another user",
+		})
+		return
+	}
+
+	result := database.DB.Model(&models.User{}).
+		Where("id = ? AND (google_id = '' OR google_id IS NULL OR google_id = ?)", user.ID, googleUser.ID).
+		Update("google_id", googleUser.ID)
+	if result.Error != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"status":  "failed",
+			"message": "failed to link google account",
+		})
+		return
+	}
+	if result.RowsAffected == 0 {
+		c.JSON(http.StatusConflict, gin.H{
+			"status":  "failed",
+			"message": "a google account is already linked, unlink it first",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"status":  "success",
+		"message": "google account linked successfully",
+		"data": gin.H{
+			"email": googleUser.Email,
+		},
+	})
+}
+
+// UnlinkGoogleAccount removes the Google identity from the logged-in user.
+// Accounts created through Google have no password, so they keep it.
+func UnlinkGoogleAccount(c *gin.Context) {
+	userID, exists := c.Get("userID")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{
+			"status":  "failed",
+			"message": "user not authorized",
+		})
+		return
+	}
+
+	userIDUint, ok := userID.(uint)
+	if !ok {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"status":  "failed",
+			"message": "failed to retrieve user information",
+		})
+		return
+	}
+
+	var user models.User
+	if err := database.DB.Where("id = ?", userIDUint).First(&user).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{
+			"status":  "failed",
+			"message": "user not found",
+		})
+		return
+	}
+
+	if user.GoogleID == "" {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"status":  "failed",
+			"message": "no google account is linked",
+		})
+		return
+	}
+
+	if user.Password == "" {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"status":  "failed",
+			"message": "this account has no password, unlinking google would lock you out",
+		})
+		return
+	}
+
+	if err := database.DB.Model(&user).Update("google_id", "").Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"status":  "failed",
+			"message": "failed to unlink google account",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"status":  "success",
+		"message": "google account unlinked successfully",
+	})
+}
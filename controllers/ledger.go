@@ -0,0 +1,321 @@
+package controllers
+
+import (
+	"errors"
+	"fmt"
+	database "knowledgeMart/config"
+	"knowledgeMart/models"
+	"math"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var (
+	ErrUnbalancedJournalEntry  = errors.New("journal entry does not balance")
+	ErrInsufficientWalletFunds = errors.New("insufficient wallet balance")
+)
+
+// LedgerAccountRef names a ledger account by its type and owner. Platform
+// accounts such as gateway clearing have owner 0.
+type LedgerAccountRef struct {
+	Type    string
+	OwnerID uint
+}
+
+// LedgerLine moves Amount into (positive) or out of (negative) an account.
+// The lines of a journal entry always sum to zero.
+type LedgerLine struct {
+	Account LedgerAccountRef
+	Amount  float64
+}
+
+func UserWalletAccount(userID uint) LedgerAccountRef {
+	return LedgerAccountRef{Type: models.LedgerUserWallet, OwnerID: userID}
+}
+
+func SellerWalletAccount(sellerID uint) LedgerAccountRef {
+	return LedgerAccountRef{Type: models.LedgerSellerWallet, OwnerID: sellerID}
+}
+
+// SellerEscrowAccount holds a seller's order proceeds until the return window
+// of the order has closed.
+func SellerEscrowAccount(sellerID uint) LedgerAccountRef {
+	return LedgerAccountRef{Type: models.LedgerSellerEscrow, OwnerID: sellerID}
+}
+
+func PlatformAccount(accountType string) LedgerAccountRef {
+	return LedgerAccountRef{Type: accountType}
+}
+
+// PostJournalEntry records a balanced set of postings and moves the cached
+// balances with them. Accounts are locked in a fixed order so concurrent
+// entries touching the same accounts cannot deadlock. A user wallet may not
+// go below zero; seller wallets may, when a refund claws money back.
+func PostJournalEntry(tx *gorm.DB, reference, description string, lines ...LedgerLine) (models.JournalEntry, error) {
+	amounts := make(map[LedgerAccountRef]float64)
+	var total float64
+	for _, line := range lines {
+		amounts[line.Account] += line.Amount
+		total += line.Amount
+	}
+	if math.Abs(RoundDecimalValue(total)) >= 0.01 {
+		return models.JournalEntry{}, fmt.Errorf("%w: %s is off by %.2f", ErrUnbalancedJournalEntry, reference, total)
+	}
+
+	refs := make([]LedgerAccountRef, 0, len(amounts))
+	for ref, amount := range amounts {
+		if RoundDecimalValue(amount) != 0 {
+			refs = append(refs, ref)
+		}
+	}
+	sort.Slice(refs, func(i, j int) bool {
+		if refs[i].Type != refs[j].Type {
+			return refs[i].Type < refs[j].Type
+		}
+		return refs[i].OwnerID < refs[j].OwnerID
+	})
+
+	entry := models.JournalEntry{Reference: reference, Description: description}
+	if len(refs) == 0 {
+		return entry, nil
+	}
+
+	accounts := make([]models.LedgerAccount, len(refs))
+	for i, ref := range refs {
+		account, err := lockLedgerAccount(tx, ref)
+		if err != nil {
+			return models.JournalEntry{}, err
+		}
+		accounts[i] = account
+	}
+
+	if err := tx.Create(&entry).Error; err != nil {
+		return models.JournalEntry{}, fmt.Errorf("failed to create journal entry: %w", err)
+	}
+
+	for i, ref := range refs {
+		amount := RoundDecimalValue(amounts[ref])
+		if err := applyPosting(tx, entry.ID, &accounts[i], amount); err != nil {
+			return models.JournalEntry{}, err
+		}
+	}
+
+	return entry, nil
+}
+
+// LedgerBalance returns the balance of an account as of the current
+// transaction.
+func LedgerBalance(tx *gorm.DB, ref LedgerAccountRef) (float64, error) {
+	account, err := lockLedgerAccount(tx, ref)
+	if err != nil {
+		return 0, err
+	}
+	return account.Balance, nil
+}
+
+func applyPosting(tx *gorm.DB, entryID uint, account *models.LedgerAccount, amount float64) error {
+	newBalance := RoundDecimalValue(account.Balance + amount)
+	if account.Type == models.LedgerUserWallet && amount < 0 && newBalance < 0 {
+		return ErrInsufficientWalletFunds
+	}
+
+	posting := models.LedgerPosting{
+		JournalEntryID: entryID,
+		AccountID:      account.ID,
+		Amount:         amount,
+	}
+	if err := tx.Create(&posting).Error; err != nil {
+		return fmt.Errorf("failed to create ledger posting: %w", err)
+	}
+
+	if err := tx.Model(&models.LedgerAccount{}).Where("id = ?", account.ID).
+		Update("balance", gorm.Expr("balance + ?", amount)).Error; err != nil {
+		return fmt.Errorf("failed to update ledger account: %w", err)
+	}
+	account.Balance = newBalance
+
+	// the wallet amounts on users and sellers are kept as a cache of the ledger
+	switch account.Type {
+	case models.LedgerUserWallet:
+		if err := tx.Model(&models.User{}).Where("id = ?", account.OwnerID).Update("wallet_amount", newBalance).Error; err != nil {
+			return fmt.Errorf("failed to update user wallet balance: %w", err)
+		}
+	case models.LedgerSellerWallet:
+		if err := tx.Model(&models.Seller{}).Where("id = ?", account.OwnerID).Update("wallet_amount", newBalance).Error; err != nil {
+			return fmt.Errorf("failed to update seller wallet balance: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// lockLedgerAccount locks the account, opening it on first use. Wallets that
+// held money before the ledger existed are opened with that balance, posted
+// against the opening balances account so the ledger still sums to zero.
+func lockLedgerAccount(tx *gorm.DB, ref LedgerAccountRef) (models.LedgerAccount, error) {
+	var account models.LedgerAccount
+	err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+		Where("type = ? AND owner_id = ?", ref.Type, ref.OwnerID).
+		First(&account).Error
+	if err == nil {
+		return account, nil
+	}
+	if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return account, fmt.Errorf("failed to retrieve ledger account: %w", err)
+	}
+
+	account = models.LedgerAccount{Type: ref.Type, OwnerID: ref.OwnerID}
+	created := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&account)
+	if created.Error != nil {
+		return account, fmt.Errorf("failed to open ledger account: %w", created.Error)
+	}
+
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+		Where("type = ? AND owner_id = ?", ref.Type, ref.OwnerID).
+		First(&account).Error; err != nil {
+		return account, fmt.Errorf("failed to retrieve ledger account: %w", err)
+	}
+	if created.RowsAffected == 0 {
+		return account, nil
+	}
+
+	opening, err := existingWalletAmount(tx, ref)
+	if err != nil || RoundDecimalValue(opening) == 0 {
+		return account, err
+	}
+
+	openingAccount, err := lockLedgerAccount(tx, PlatformAccount(models.LedgerOpeningBalances))
+	if err != nil {
+		return account, err
+	}
+
+	entry := models.JournalEntry{
+		Reference:   fmt.Sprintf("OPENING_%s_%d", ref.Type, ref.OwnerID),
+		Description: "Opening balance carried over from the wallet",
+	}
+	if err := tx.Create(&entry).Error; err != nil {
+		return account, fmt.Errorf("failed to create journal entry: %w", err)
+	}
+	if err := applyPosting(tx, entry.ID, &openingAccount, -RoundDecimalValue(opening)); err != nil {
+		return account, err
+	}
+	if err := applyPosting(tx, entry.ID, &account, RoundDecimalValue(opening)); err != nil {
+		return account, err
+	}
+
+	return account, nil
+}
+
+func existingWalletAmount(tx *gorm.DB, ref LedgerAccountRef) (float64, error) {
+	var amount float64
+	switch ref.Type {
+	case models.LedgerUserWallet:
+		if err := tx.Model(&models.User{}).Where("id = ?", ref.OwnerID).Select("COALESCE(wallet_amount, 0)").Scan(&amount).Error; err != nil {
+			return 0, fmt.Errorf("failed to retrieve user wallet balance: %w", err)
+		}
+	case models.LedgerSellerWallet:
+		if err := tx.Model(&models.Seller{}).Where("id = ?", ref.OwnerID).Select("COALESCE(wallet_amount, 0)").Scan(&amount).Error; err != nil {
+			return 0, fmt.Errorf("failed to retrieve seller wallet balance: %w", err)
+		}
+	}
+	return amount, nil
+}
+
+// CheckLedgerConsistency proves the stored balances against the postings:
+// every entry balances, every account's cached balance equals the sum of its
+// postings, and every user and seller wallet amount equals its ledger account.
+func CheckLedgerConsistency(c *gin.Context) {
+	report := models.LedgerConsistencyReport{
+		CheckedAt:         time.Now(),
+		UnbalancedEntries: []models.UnbalancedJournalEntry{},
+		AccountMismatches: []models.LedgerBalanceMismatch{},
+		UserMismatches:    []models.LedgerBalanceMismatch{},
+		SellerMismatches:  []models.LedgerBalanceMismatch{},
+	}
+
+	if err := database.DB.Model(&models.LedgerPosting{}).
+		Select("COALESCE(SUM(amount), 0)").
+		Scan(&report.PostingTotal).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"status":  "failed",
+			"message": "failed to total ledger postings",
+		})
+		return
+	}
+
+	if err := database.DB.Model(&models.LedgerPosting{}).
+		Select("journal_entry_id, SUM(amount) AS total").
+		Group("journal_entry_id").
+		Having("ABS(SUM(amount)) >= 0.01").
+		Scan(&report.UnbalancedEntries).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"status":  "failed",
+			"message": "failed to check journal entries",
+		})
+		return
+	}
+
+	if err := database.DB.Table("ledger_accounts").
+		Select("ledger_accounts.id AS account_id, ledger_accounts.owner_id, ledger_accounts.type, ledger_accounts.balance AS stored_balance, COALESCE(SUM(ledger_postings.amount), 0) AS ledger_balance").
+		Joins("LEFT JOIN ledger_postings ON ledger_postings.account_id = ledger_accounts.id").
+		Group("ledger_accounts.id").
+		Having("ABS(ledger_accounts.balance - COALESCE(SUM(ledger_postings.amount), 0)) >= 0.01").
+		Scan(&report.AccountMismatches).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"status":  "failed",
+			"message": "failed to check ledger accounts",
+		})
+		return
+	}
+
+	if err := database.DB.Table("users").
+		Select("ledger_accounts.id AS account_id, users.id AS owner_id, ? AS type, COALESCE(users.wallet_amount, 0) AS stored_balance, COALESCE(ledger_accounts.balance, 0) AS ledger_balance", models.LedgerUserWallet).
+		Joins("LEFT JOIN ledger_accounts ON ledger_accounts.owner_id = users.id AND ledger_accounts.type = ?", models.LedgerUserWallet).
+		Where("users.deleted_at IS NULL").
+		Where("ABS(COALESCE(users.wallet_amount, 0) - COALESCE(ledger_accounts.balance, 0)) >= 0.01").
+		Scan(&report.UserMismatches).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"status":  "failed",
+			"message": "failed to check user wallets",
+		})
+		return
+	}
+
+	if err := database.DB.Table("sellers").
+		Select("ledger_accounts.id AS account_id, sellers.id AS owner_id, ? AS type, COALESCE(sellers.wallet_amount, 0) AS stored_balance, COALESCE(ledger_accounts.balance, 0) AS ledger_balance", models.LedgerSellerWallet).
+		Joins("LEFT JOIN ledger_accounts ON ledger_accounts.owner_id = sellers.id AND ledger_accounts.type = ?", models.LedgerSellerWallet).
+		Where("sellers.deleted_at IS NULL").
+		Where("ABS(COALESCE(sellers.wallet_amount, 0) - COALESCE(ledger_accounts.balance, 0)) >= 0.01").
+		Scan(&report.SellerMismatches).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"status":  "failed",
+			"message": "failed to check seller wallets",
+		})
+		return
+	}
+
+	report.PostingTotal = RoundDecimalValue(report.PostingTotal)
+	report.Consistent = report.PostingTotal == 0 &&
+		len(report.UnbalancedEntries) == 0 &&
+		len(report.AccountMismatches) == 0 &&
+		len(report.UserMismatches) == 0 &&
+		len(report.SellerMismatches) == 0
+
+	message := "ledger and balances are consistent"
+	if !report.Consistent {
+		message = "ledger and balances do not match"
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"status":  "success",
+		"message": message,
+		"data": gin.H{
+			"report": report,
+		},
+	})
+}
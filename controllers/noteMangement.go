@@ -3,6 +3,7 @@ package controllers
 import (
 	database "knowledgeMart/config"
 	"knowledgeMart/models"
+	"knowledgeMart/utils"
 	"net/http"
 
 	"github.com/gin-gonic/gin"
@@ -653,20 +654,65 @@ func GetAllNotes(c *gin.Context) {
 		FileURL        string `json:"file_url"`
 	}
 
-	if err := database.DB.Table("notes").
+	pageRequest, err := utils.ParsePageRequest(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"status": "failed", "message": err.Error()})
+		return
+	}
+
+	query := database.DB.Table("notes").
+		Joins("JOIN courses ON notes.course_id = courses.course_id").
+		Joins("JOIN semesters ON notes.semester_id = semesters.semester_id").
+		Joins("JOIN subjects ON notes.subject_id = subjects.subject_id")
+
+	if courseID := c.Query("course_id"); courseID != "" {
+		query = query.Where("notes.course_id = ?", courseID)
+	}
+	if semesterID := c.Query("semester_id"); semesterID != "" {
+		query = query.Where("notes.semester_id = ?", semesterID)
+	}
+	if subjectID := c.Query("subject_id"); subjectID != "" {
+		query = query.Where("notes.subject_id = ?", subjectID)
+	}
+
+	totalCount, err := pageRequest.Count(query)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"status": "failed", "message": "Could not count notes", "error": err.Error()})
+		return
+	}
+
+	var lastNoteID uint
+	query, err = pageRequest.Apply(query, "notes.note_id", false, &lastNoteID)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"status": "failed", "message": err.Error()})
+		return
+	}
+
+	if err := query.
 		Select(`notes.note_id, notes.user_id, courses.name AS course_name, 
 				semesters.number AS semester_number, 
 				subjects.name AS subject_name, 
 				notes.description, notes.file_url`).
-		Joins("JOIN courses ON notes.course_id = courses.course_id").
-		Joins("JOIN semesters ON notes.semester_id = semesters.semester_id").
-		Joins("JOIN subjects ON notes.subject_id = subjects.subject_id").
 		Scan(&notes).Error; err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"status": "failed", "message": "Could not retrieve notes", "error": err.Error()})
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{"status": "success", "data": notes})
+	hasMore := pageRequest.HasMore(len(notes), totalCount)
+	if pageRequest.CursorMode && hasMore {
+		notes = notes[:pageRequest.Limit]
+	}
+
+	var nextCursor string
+	if len(notes) > 0 {
+		nextCursor = utils.EncodeCursor(notes[len(notes)-1].NoteID)
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"status":     "success",
+		"data":       notes,
+		"pagination": utils.NewPageInfo(c, pageRequest, totalCount, hasMore, nextCursor),
+	})
 }
 
 func GetUserNotes(c *gin.Context) {
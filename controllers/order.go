@@ -1,15 +1,16 @@
 package controllers
 
 import (
-	"fmt"
 	database "knowledgeMart/config"
 	"knowledgeMart/models"
+	"knowledgeMart/utils"
 	"math"
 	"net/http"
 	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/go-playground/validator/v10"
+	"gorm.io/gorm"
 )
 
 func RoundDecimalValue(value float64) float64 {
@@ -64,7 +65,7 @@ func PlaceOrder(c *gin.Context) {
 	}
 
 	var CartItems []models.Cart
-	if err := database.DB.Preload("Product").Where("user_id = ?", userIDStr).Find(&CartItems).Error; err != nil {
+	if err := database.DB.Preload("Product").Where("user_id = ?", userIDStr).Order("product_id").Find(&CartItems).Error; err != nil {
 		c.JSON(http.StatusNotFound, gin.H{
 			"status":  "failed",
 			"message": "failed to find the cart",
@@ -80,18 +81,18 @@ func PlaceOrder(c *gin.Context) {
 		return
 	}
 
-	var discountedPrice float64
+	var sellerOrders []*sellerOrderSummary
+	sellerIndex := make(map[uint]*sellerOrderSummary)
 	var TotalCategoryDiscount float64
 	var TotalProductOfferAmount float64
-	var ProductOfferAmount float64
 	var TotalAmount float64
 	var finalAmount float64
-	var sellerID uint
 
 	for _, item := range CartItems {
 		Product := item.Product
+		quantity := float64(item.Quantity)
 
-		if !Product.Availability {
+		if !Product.Availability || Product.StockQuantity < item.Quantity {
 			c.JSON(http.StatusBadRequest, gin.H{
 				"status":  "failed",
 				"message": "Some items in the cart are out of stock.",
@@ -108,36 +109,40 @@ func PlaceOrder(c *gin.Context) {
 			return
 		}
 
-		discountedPrice = calculateFinalAmount(Product.OfferAmount, category.OfferPercentage)
+		discountedPrice := calculateFinalAmount(Product.OfferAmount, category.OfferPercentage)
 
-		TotalAmount += Product.Price
+		ProductOfferAmount := (Product.Price - Product.OfferAmount) * quantity
+		CategoryDiscount := (Product.OfferAmount - discountedPrice) * quantity
 
-		ProductOfferAmount = Product.Price - Product.OfferAmount
+		summary, ok := sellerIndex[Product.SellerID]
+		if !ok {
+			summary = &sellerOrderSummary{SellerID: Product.SellerID}
+			sellerIndex[Product.SellerID] = summary
+			sellerOrders = append(sellerOrders, summary)
+		}
+		summary.Items = append(summary.Items, item)
+		summary.TotalAmount += Product.Price * quantity
+		summary.ProductOfferAmount += ProductOfferAmount
+		summary.CategoryDiscount += CategoryDiscount
+		summary.OfferTotal += Product.OfferAmount * quantity
+		summary.FinalAmount += discountedPrice * quantity
+
+		TotalAmount += Product.Price * quantity
 		TotalProductOfferAmount += ProductOfferAmount
-
-		CategoryDiscount := Product.OfferAmount - discountedPrice
 		TotalCategoryDiscount += CategoryDiscount
-
-		finalAmount += Product.OfferAmount
-
-		if sellerID == 0 {
-			sellerID = Product.SellerID
-		} else if sellerID != Product.SellerID {
-			c.JSON(http.StatusBadRequest, gin.H{
-				"status":  "failed",
-				"message": "You can only add products from one seller to your cart per order.",
-			})
-			return
-		}
+		finalAmount += discountedPrice * quantity
 	}
 
-	finalAmount -= TotalCategoryDiscount
+	// the coupon usage is recorded in the same transaction as the stock
+	// reservation, so a failed order does not use up the coupon
+	tx := database.DB.Begin()
 
 	// Apply coupon discount if available
 	var CouponDiscount float64
 	if request.CouponCode != "" {
-		success, msg, discount := ApplyCouponToOrder(TotalAmount, userIDStr, request.CouponCode)
+		success, msg, discount := ApplyCouponToOrder(tx, TotalAmount, userIDStr, request.CouponCode)
 		if !success {
+			tx.Rollback()
 			c.JSON(http.StatusBadRequest, gin.H{
 				"status":  "failed",
 				"message": msg,
@@ -150,6 +155,7 @@ func PlaceOrder(c *gin.Context) {
 
 	var Address models.Address
 	if err := database.DB.Where("user_id = ? AND id = ?", userIDStr, request.AddressID).First(&Address).Error; err != nil {
+		tx.Rollback()
 		c.JSON(http.StatusConflict, gin.H{
 			"status":  "failed",
 			"message": "Invalid shipping address.",
@@ -166,6 +172,7 @@ func PlaceOrder(c *gin.Context) {
 	case 3:
 		PaymentMethodOption = models.COD
 	default:
+		tx.Rollback()
 		c.JSON(http.StatusBadRequest, gin.H{
 			"status":  "failed",
 			"message": "Invalid payment method.",
@@ -174,6 +181,7 @@ func PlaceOrder(c *gin.Context) {
 	}
 
 	if PaymentMethodOption == models.COD && finalAmount > 1000 {
+		tx.Rollback()
 		c.JSON(http.StatusBadRequest, gin.H{
 			"status":  "failed",
 			"message": "COD is not applicable for order",
@@ -187,59 +195,129 @@ func PlaceOrder(c *gin.Context) {
 		finalAmount += float64(deliveryCharge)
 	}
 
+	offerTotals := make([]float64, len(sellerOrders))
+	for i, summary := range sellerOrders {
+		offerTotals[i] = summary.OfferTotal
+	}
+	couponShares := apportionAmount(CouponDiscount, offerTotals)
+
+	discountedTotals := make([]float64, len(sellerOrders))
+	for i, summary := range sellerOrders {
+		discountedTotals[i] = summary.FinalAmount - couponShares[i]
+	}
+	deliveryShares := apportionAmount(float64(deliveryCharge), discountedTotals)
+
 	status := models.OrderStatusPending
 
 	if PaymentMethodOption == models.COD {
 		status = models.OrderStatusConfirmed
 	}
 
-	tx := database.DB.Begin()
+	for _, item := range CartItems {
+		if err := ReserveProductStock(tx, item.ProductID, item.Quantity); err != nil {
+			tx.Rollback()
+			c.JSON(http.StatusConflict, gin.H{
+				"status":  "failed",
+				"message": err.Error(),
+			})
+			return
+		}
+	}
 
-	order := models.Order{
+	checkout := models.Checkout{
 		UserID:                 userIDStr,
 		TotalAmount:            RoundDecimalValue(TotalAmount),
 		FinalAmount:            RoundDecimalValue(finalAmount),
 		PaymentMethod:          PaymentMethodOption,
 		PaymentStatus:          models.OrderStatusPending,
-		OrderedAt:              time.Now(),
 		CouponCode:             request.CouponCode,
 		CouponDiscountAmount:   RoundDecimalValue(CouponDiscount),
 		ProductOfferAmount:     RoundDecimalValue(TotalProductOfferAmount),
-		DeliveryCharge:         float64(deliveryCharge),
 		CategoryDiscountAmount: RoundDecimalValue(TotalCategoryDiscount),
-		SellerID:               sellerID,
-		Status:                 status,
-		ShippingAddress: models.ShippingAddress{
-			StreetName:   Address.StreetName,
-			StreetNumber: Address.StreetNumber,
-			City:         Address.City,
-			State:        Address.State,
-			PinCode:      Address.PinCode,
-			PhoneNumber:  Address.PhoneNumber,
-		},
+		DeliveryCharge:         float64(deliveryCharge),
+		CreatedAt:              time.Now(),
 	}
 
-	if err := tx.Create(&order).Error; err != nil {
+	if err := tx.Create(&checkout).Error; err != nil {
 		tx.Rollback()
 		c.JSON(http.StatusInternalServerError, gin.H{
 			"status":  "failed",
-			"message": "Failed to create order.",
+			"message": "Failed to create checkout.",
 		})
 		return
 	}
 
-	if !CartToOrderItems(userIDStr, order, CouponDiscount) {
-		tx.Rollback()
-		c.JSON(http.StatusInternalServerError, gin.H{
-			"status":  "failed",
-			"message": "Failed to transfer cart items to order.",
-		})
-		return
+	var orders []models.Order
+	for i, summary := range sellerOrders {
+		order := models.Order{
+			UserID:                 userIDStr,
+			CheckoutID:             checkout.CheckoutID,
+			TotalAmount:            RoundDecimalValue(summary.TotalAmount),
+			FinalAmount:            RoundDecimalValue(summary.FinalAmount - couponShares[i] + deliveryShares[i]),
+			PaymentMethod:          PaymentMethodOption,
+			PaymentStatus:          models.OrderStatusPending,
+			OrderedAt:              time.Now(),
+			CouponCode:             request.CouponCode,
+			CouponDiscountAmount:   RoundDecimalValue(couponShares[i]),
+			ProductOfferAmount:     RoundDecimalValue(summary.ProductOfferAmount),
+			DeliveryCharge:         RoundDecimalValue(deliveryShares[i]),
+			CategoryDiscountAmount: RoundDecimalValue(summary.CategoryDiscount),
+			SellerID:               summary.SellerID,
+			Status:                 status,
+			ShippingAddress: models.ShippingAddress{
+				StreetName:   Address.StreetName,
+				StreetNumber: Address.StreetNumber,
+				City:         Address.City,
+				State:        Address.State,
+				PinCode:      Address.PinCode,
+				PhoneNumber:  Address.PhoneNumber,
+			},
+		}
+
+		if err := tx.Create(&order).Error; err != nil {
+			tx.Rollback()
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"status":  "failed",
+				"message": "Failed to create order.",
+			})
+			return
+		}
+
+		if !CartToOrderItems(tx, userIDStr, order, summary.Items, couponShares[i]) {
+			tx.Rollback()
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"status":  "failed",
+				"message": "Failed to transfer cart items to order.",
+			})
+			return
+		}
+
+		if err := RecordOrderStatusChange(tx, order.OrderID, 0, "", order.Status, OrderActor{Role: models.ActorUser, ID: userIDStr}, "order placed"); err != nil {
+			tx.Rollback()
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"status":  "failed",
+				"message": "Failed to record order status.",
+			})
+			return
+		}
+		notifyOrderStatus(tx, order)
+
+		orders = append(orders, order)
+	}
+
+	if PaymentMethodOption == models.COD {
+		if err := tx.Where("user_id = ?", userIDStr).Delete(&models.Cart{}).Error; err != nil {
+			tx.Rollback()
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"status":  "failed",
+				"message": "Failed to clear the cart.",
+			})
+			return
+		}
 	}
 
 	if PaymentMethodOption == models.Wallet {
-		orderIDStr := fmt.Sprintf("%d", order.OrderID)
-		if _, err := ProcessWalletPayment(userIDStr, orderIDStr, tx); err != nil {
+		if _, err := ProcessWalletPayment(userIDStr, checkout.CheckoutID, tx); err != nil {
 			tx.Rollback()
 			c.JSON(http.StatusBadRequest, gin.H{
 				"status":  "failed",
@@ -254,49 +332,79 @@ func PlaceOrder(c *gin.Context) {
 
 	c.JSON(http.StatusOK, gin.H{
 		"status":  "success",
-		"message": "Order successfully created with " + order.PaymentMethod,
+		"message": "Order successfully created with " + checkout.PaymentMethod,
 		"data": gin.H{
-			"order_id":      order.OrderID,
-			"order_details": order,
+			"checkout_id":      checkout.CheckoutID,
+			"checkout_details": checkout,
+			"orders":           orders,
 		},
 	})
 }
 
-func CartToOrderItems(UserID uint, Order models.Order, CouponDiscount float64) bool {
-	var CartItems []models.Cart
-	if err := database.DB.Preload("Product").Where("user_id = ?", UserID).Find(&CartItems).Error; err != nil {
-		return false
+type sellerOrderSummary struct {
+	SellerID           uint
+	Items              []models.Cart
+	TotalAmount        float64
+	ProductOfferAmount float64
+	CategoryDiscount   float64
+	OfferTotal         float64
+	FinalAmount        float64
+}
+
+func apportionAmount(amount float64, weights []float64) []float64 {
+	shares := make([]float64, len(weights))
+	if len(weights) == 0 || amount == 0 {
+		return shares
+	}
+
+	var totalWeight float64
+	for _, weight := range weights {
+		totalWeight += math.Max(0, weight)
 	}
 
+	var allocated float64
+	for i, weight := range weights {
+		if i == len(weights)-1 {
+			shares[i] = RoundDecimalValue(amount - allocated)
+			break
+		}
+		if totalWeight > 0 {
+			shares[i] = RoundDecimalValue(amount * math.Max(0, weight) / totalWeight)
+		}
+		allocated += shares[i]
+	}
+
+	return shares
+}
+
+func CartToOrderItems(tx *gorm.DB, UserID uint, Order models.Order, CartItems []models.Cart, CouponDiscount float64) bool {
 	if len(CartItems) == 0 {
 		return false
 	}
 
 	var totalCartPrice float64
 	for _, cartItem := range CartItems {
-		totalCartPrice += cartItem.Product.OfferAmount
+		totalCartPrice += cartItem.Product.OfferAmount * float64(cartItem.Quantity)
 	}
 
-	tx := database.DB.Begin()
-
 	for _, cartItem := range CartItems {
 		Product := cartItem.Product
+		quantity := float64(cartItem.Quantity)
 
 		var category models.Category
-		if err := database.DB.First(&category, Product.CategoryID).Error; err != nil {
-			tx.Rollback()
+		if err := tx.First(&category, Product.CategoryID).Error; err != nil {
 			return false
 		}
 
 		discountedPrice := calculateFinalAmount(Product.OfferAmount, category.OfferPercentage)
-		productOffer := Product.Price - Product.OfferAmount
+		productOffer := (Product.Price - Product.OfferAmount) * quantity
 
-		categoryOffer := Product.OfferAmount - discountedPrice
-		finalPrice := Product.Price - categoryOffer - productOffer
+		categoryOffer := (Product.OfferAmount - discountedPrice) * quantity
+		finalPrice := Product.Price*quantity - categoryOffer - productOffer
 
 		var proportionalDiscount float64
 		if CouponDiscount > 0 {
-			proportionalDiscount = (Product.OfferAmount / totalCartPrice) * CouponDiscount
+			proportionalDiscount = (Product.OfferAmount * quantity / totalCartPrice) * CouponDiscount
 			finalPrice -= proportionalDiscount
 		}
 
@@ -313,6 +421,7 @@ func CartToOrderItems(UserID uint, Order models.Order, CouponDiscount float64) b
 			ProductID:           cartItem.ProductID,
 			UserID:              UserID,
 			SellerID:            Product.SellerID,
+			Quantity:            cartItem.Quantity,
 			Price:               Product.Price,
 			ProductOfferAmount:  RoundDecimalValue(productOffer),
 			CategoryOfferAmount: RoundDecimalValue(categoryOffer),
@@ -322,30 +431,10 @@ func CartToOrderItems(UserID uint, Order models.Order, CouponDiscount float64) b
 		}
 
 		if err := tx.Create(&orderItem).Error; err != nil {
-			tx.Rollback()
-			return false
-		}
-
-		if Order.PaymentMethod == models.COD {
-			Product.Availability = false
-			if err := tx.Model(&Product).Where("id = ?", Product.ID).Update("availability", Product.Availability).Error; err != nil {
-				tx.Rollback()
-				return false
-			}
-		}
-	}
-
-	if Order.PaymentMethod == models.COD {
-		if err := tx.Where("user_id = ?", UserID).Delete(&models.Cart{}).Error; err != nil {
-			tx.Rollback()
 			return false
 		}
 	}
 
-	if err := tx.Commit().Error; err != nil {
-		return false
-	}
-
 	return true
 }
 
@@ -368,10 +457,48 @@ func GetUserOrders(c *gin.Context) {
 		return
 	}
 
+	pageRequest, err := utils.ParsePageRequest(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"status":  "failed",
+			"message": err.Error(),
+		})
+		return
+	}
+
 	var orders []models.Order
 	var orderResponses []models.GetSellerOrdersResponse
 
-	if err := database.DB.Where("seller_id = ?", sellerIDStr).Find(&orders).Error; err != nil {
+	query := database.DB.Model(&models.Order{}).Where("seller_id = ?", sellerIDStr)
+
+	if status := c.Query("status"); status != "" {
+		query = query.Where("status = ?", status)
+	}
+
+	if paymentStatus := c.Query("payment_status"); paymentStatus != "" {
+		query = query.Where("payment_status = ?", paymentStatus)
+	}
+
+	totalCount, err := pageRequest.Count(query)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"status":  "failed",
+			"message": "failed to count orders",
+		})
+		return
+	}
+
+	var lastOrderID uint
+	query, err = pageRequest.Apply(query, "order_id", true, &lastOrderID)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"status":  "failed",
+			"message": err.Error(),
+		})
+		return
+	}
+
+	if err := query.Find(&orders).Error; err != nil {
 		c.JSON(http.StatusNotFound, gin.H{
 			"status":  "failed",
 			"message": "no orders found for this seller",
@@ -379,6 +506,16 @@ func GetUserOrders(c *gin.Context) {
 		return
 	}
 
+	hasMore := pageRequest.HasMore(len(orders), totalCount)
+	if pageRequest.CursorMode && hasMore {
+		orders = orders[:pageRequest.Limit]
+	}
+
+	var nextCursor string
+	if len(orders) > 0 {
+		nextCursor = utils.EncodeCursor(orders[len(orders)-1].OrderID)
+	}
+
 	for _, order := range orders {
 		var orderItems []models.OrderItem
 		if err := database.DB.Preload("Product").Where("order_id = ?", order.OrderID).Find(&orderItems).Error; err != nil {
@@ -396,6 +533,7 @@ func GetUserOrders(c *gin.Context) {
 				ProductName: item.Product.Name,
 				CategoryID:  item.Product.CategoryID,
 				Description: item.Product.Description,
+				Quantity:    item.Quantity,
 				Price:       item.Price,
 				Image:       item.Product.Image,
 				FinalAmount: item.FinalAmount,
@@ -418,8 +556,9 @@ func GetUserOrders(c *gin.Context) {
 	}
 
 	c.JSON(http.StatusOK, gin.H{
-		"status": "success",
-		"data":   orderResponses,
+		"status":     "success",
+		"data":       orderResponses,
+		"pagination": utils.NewPageInfo(c, pageRequest, totalCount, hasMore, nextCursor),
 	})
 }
 
@@ -470,34 +609,24 @@ func SellerUpdateOrderStatus(c *gin.Context) {
 		return
 	}
 
-	switch ordersItem.Status {
-	case models.OrderStatusPending:
-		ordersItem.Status = models.OrderStatusConfirmed
-	case models.OrderStatusConfirmed:
-		ordersItem.Status = models.OrderStatusShipped
-	case models.OrderStatusShipped:
-		ordersItem.Status = models.OrderStatusOutForDelivery
-	case models.OrderStatusOutForDelivery:
-		ordersItem.Status = models.OrderStatusDelivered
-	case models.OrderStatusDelivered:
-		c.JSON(http.StatusBadRequest, gin.H{
-			"status":  "failed",
-			"message": "Order already delivered",
-		})
-		return
-	default:
+	nextStatus, ok := NextOrderStatus(ordersItem.Status)
+	if !ok {
+		message := "Invalid order status transition"
+		if ordersItem.Status == models.OrderStatusDelivered {
+			message = "Order already delivered"
+		}
 		c.JSON(http.StatusBadRequest, gin.H{
 			"status":  "failed",
-			"message": "Invalid order status transition",
+			"message": message,
 		})
 		return
 	}
 
+	actor := OrderActor{Role: models.ActorSeller, ID: sellerIDStr}
+
 	tx := database.DB.Begin()
 
-	if err := tx.Model(&ordersItem).Updates(map[string]interface{}{
-		"status": ordersItem.Status,
-	}).Error; err != nil {
+	if err := TransitionOrderItemStatus(tx, &ordersItem, nextStatus, actor, "status updated by seller"); err != nil {
 		tx.Rollback()
 		c.JSON(http.StatusInternalServerError, gin.H{
 			"status":  "failed",
@@ -506,60 +635,26 @@ func SellerUpdateOrderStatus(c *gin.Context) {
 		return
 	}
 
-	var orderItems []models.OrderItem
-	if err := tx.Where("order_id = ?", ordersItem.OrderID).Find(&orderItems).Error; err != nil {
+	if err := SyncOrderStatus(tx, &order, actor, "status updated by seller"); err != nil {
 		tx.Rollback()
 		c.JSON(http.StatusInternalServerError, gin.H{
 			"status":  "failed",
-			"message": "Failed to retrieve order items",
+			"message": "Failed to update overall order status",
 		})
 		return
 	}
 
-	allDelivered := true
-	allPending := true
-	allConfirmed := true
-	allOutforDelivery := true
-	for _, item := range orderItems {
-		if item.Status != models.OrderStatusDelivered {
-			allDelivered = false
-		}
-		if item.Status != models.OrderStatusPending {
-			allPending = false
-		}
-		if item.Status != models.OrderStatusConfirmed {
-			allConfirmed = false
-		}
-		if item.Status != models.OrderStatusOutForDelivery {
-			allOutforDelivery = false
+	if order.Status == models.OrderStatusDelivered && order.PaymentStatus != models.PaymentStatusPaid {
+		if err := tx.Model(&order).Update("payment_status", models.PaymentStatusPaid).Error; err != nil {
+			tx.Rollback()
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"status":  "failed",
+				"message": "Failed to update overall order status",
+			})
+			return
 		}
 	}
 
-	if allDelivered {
-		order.Status = models.OrderStatusDelivered
-		order.PaymentStatus = models.PaymentStatusPaid
-	} else if allPending {
-		order.Status = models.OrderStatusPending
-	} else if allConfirmed {
-		order.Status = models.OrderStatusConfirmed
-	} else if allOutforDelivery {
-		order.Status = models.OrderStatusOutForDelivery
-	} else {
-		order.Status = models.OrderStatusShipped
-	}
-
-	if err := tx.Model(&order).Updates(map[string]interface{}{
-		"status":         order.Status,
-		"payment_status": order.PaymentStatus,
-	}).Error; err != nil {
-		tx.Rollback()
-		c.JSON(http.StatusInternalServerError, gin.H{
-			"status":  "failed",
-			"message": "Failed to update overall order status",
-		})
-		return
-	}
-
 	tx.Commit()
 	c.JSON(http.StatusOK, gin.H{
 		"status":  "success",
@@ -632,6 +727,7 @@ func UserCheckOrderStatus(c *gin.Context) {
 				ProductName: orderItem.Product.Name,
 				CategoryID:  orderItem.Product.CategoryID,
 				Description: orderItem.Product.Description,
+				Quantity:    orderItem.Quantity,
 				Price:       RoundDecimalValue(orderItem.Price),
 				FinalAmount: RoundDecimalValue(orderItem.FinalAmount),
 				Image:       orderItem.Product.Image,
@@ -639,6 +735,15 @@ func UserCheckOrderStatus(c *gin.Context) {
 			})
 		}
 
+		var timeline []models.OrderStatusHistory
+		if err := database.DB.Where("order_id = ?", order.OrderID).Order("changed_at ASC, id ASC").Find(&timeline).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"status":  "failed",
+				"message": "failed to retrieve order timeline",
+			})
+			return
+		}
+
 		statusCounts := gin.H{}
 		if countPending > 0 {
 			statusCounts["Pending"] = countPending
@@ -668,6 +773,7 @@ func UserCheckOrderStatus(c *gin.Context) {
 			PaymentMethod:   order.PaymentMethod,
 			ShippingAddress: order.ShippingAddress,
 			ItemCounts:      statusCounts,
+			Timeline:        timeline,
 		})
 	}
 
@@ -678,10 +784,16 @@ func UserCheckOrderStatus(c *gin.Context) {
 }
 
 func CancelOrder(c *gin.Context) {
-	sellerID, isSeller := c.Get("sellerID")
-	userID, isUser := c.Get("userID")
+	// the route decides who may cancel, the role only tells which one it is
+	isSeller := c.GetString("role") == models.RoleSeller
+	idKey := "userID"
+	if isSeller {
+		idKey = "sellerID"
+	}
 
-	if !isSeller && !isUser {
+	authID, exists := c.Get(idKey)
+	id, ok := authID.(uint)
+	if !exists || !ok {
 		c.JSON(http.StatusUnauthorized, gin.H{
 			"status":  "failed",
 			"message": "user or seller not authorized",
@@ -689,11 +801,9 @@ func CancelOrder(c *gin.Context) {
 		return
 	}
 
-	var id uint
+	actor := OrderActor{Role: models.ActorUser, ID: id}
 	if isSeller {
-		id = sellerID.(uint)
-	} else if isUser {
-		id = userID.(uint)
+		actor.Role = models.ActorSeller
 	}
 
 	orderId := c.Query("orderid")
@@ -707,6 +817,15 @@ func CancelOrder(c *gin.Context) {
 		return
 	}
 
+	refundTo := c.DefaultQuery("refund_to", models.RefundDestinationWallet)
+	if refundTo != models.RefundDestinationWallet && refundTo != models.RefundDestinationSource {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"status":  "failed",
+			"message": "refund_to must be either source or wallet",
+		})
+		return
+	}
+
 	var orders models.Order
 	var condition string
 	if isSeller {
@@ -737,6 +856,24 @@ func CancelOrder(c *gin.Context) {
 			return
 		}
 
+		if orderItem.Status == models.OrderStatusCanceled {
+			tx.Rollback()
+			c.JSON(http.StatusBadRequest, gin.H{
+				"status":  "failed",
+				"message": "this item is already cancelled",
+			})
+			return
+		}
+
+		if !CanTransitionOrderStatus(orderItem.Status, models.OrderStatusCanceled) {
+			tx.Rollback()
+			c.JSON(http.StatusBadRequest, gin.H{
+				"status":  "failed",
+				"message": "this item can no longer be cancelled, it is " + orderItem.Status,
+			})
+			return
+		}
+
 		var order models.Order
 		if err := tx.Where("order_id = ?", orderId).First(&order).Error; err != nil {
 			tx.Rollback()
@@ -780,8 +917,7 @@ func CancelOrder(c *gin.Context) {
 			return
 		}
 
-		orderItem.Product.Availability = true
-		if err := tx.Model(&orderItem.Product).Update("availability", orderItem.Product.Availability).Error; err != nil {
+		if err := ReleaseProductStock(tx, orderItem.ProductID, orderItem.Quantity); err != nil {
 			tx.Rollback()
 			c.JSON(http.StatusInternalServerError, gin.H{
 				"status":  "failed",
@@ -791,7 +927,7 @@ func CancelOrder(c *gin.Context) {
 		}
 
 		if orders.PaymentStatus == models.PaymentStatusPaid {
-			err := RefundToUser(tx, id, orderId, orderItemAmount, "Single item canceled", isSeller)
+			err := RefundToUser(tx, id, orderId, orderItemAmount, order.FinalAmount, "Single item canceled", isSeller, refundTo)
 			if err != nil {
 				tx.Rollback()
 				c.JSON(http.StatusInternalServerError, gin.H{
@@ -802,16 +938,7 @@ func CancelOrder(c *gin.Context) {
 			}
 		}
 
-		if orderItem.Status == models.OrderStatusCanceled {
-			c.JSON(http.StatusBadRequest, gin.H{
-				"status":  "failed",
-				"message": "this item is already cancelled",
-			})
-			return
-		}
-
-		orderItem.Status = models.OrderStatusCanceled
-		if err := tx.Model(&orderItem).Update("status", orderItem.Status).Error; err != nil {
+		if err := TransitionOrderItemStatus(tx, &orderItem, models.OrderStatusCanceled, actor, "single item canceled"); err != nil {
 			tx.Rollback()
 			c.JSON(http.StatusInternalServerError, gin.H{
 				"status":  "failed",
@@ -820,28 +947,15 @@ func CancelOrder(c *gin.Context) {
 			return
 		}
 
-		var itemCount int64
-		if err := tx.Model(&models.OrderItem{}).Where("order_id = ? AND status != ?", orderId, models.OrderStatusCanceled).Count(&itemCount).Error; err != nil {
+		if err := SyncOrderStatus(tx, &orders, actor, "single item canceled"); err != nil {
 			tx.Rollback()
 			c.JSON(http.StatusInternalServerError, gin.H{
 				"status":  "failed",
-				"message": "failed to check order items",
+				"message": "failed to update order status",
 			})
 			return
 		}
 
-		if itemCount == 0 {
-			orders.Status = models.OrderStatusCanceled
-			if err := tx.Model(&orders).Update("status", orders.Status).Error; err != nil {
-				tx.Rollback()
-				c.JSON(http.StatusInternalServerError, gin.H{
-					"status":  "failed",
-					"message": "failed to update order status",
-				})
-				return
-			}
-		}
-
 		tx.Commit()
 
 		c.JSON(http.StatusOK, gin.H{
@@ -852,6 +966,7 @@ func CancelOrder(c *gin.Context) {
 	}
 
 	if orders.Status == models.OrderStatusCanceled {
+		tx.Rollback()
 		c.JSON(http.StatusBadRequest, gin.H{
 			"status":  "failed",
 			"message": "this order is already cancelled",
@@ -859,252 +974,38 @@ func CancelOrder(c *gin.Context) {
 		return
 	}
 
-	if orders.PaymentStatus == models.PaymentStatusPaid {
-		fmt.Println("refund is starting")
-		err := RefundToUser(tx, id, orderId, orders.FinalAmount, "Entire order canceled", isSeller)
-		if err != nil {
-			tx.Rollback()
-			c.JSON(http.StatusInternalServerError, gin.H{
-				"status":  "failed",
-				"message": "failed to refund amount " + err.Error(),
-			})
-			return
-		}
-	}
-
-	orders.Status = models.OrderStatusCanceled
-	orders.PaymentStatus = models.PaymentStatusCanceled
-
-	if err := tx.Model(&orders).Updates(map[string]interface{}{
-		"status":         orders.Status,
-		"payment_status": orders.PaymentStatus,
-	}).Error; err != nil {
-		tx.Rollback()
-		c.JSON(http.StatusInternalServerError, gin.H{
-			"status":  "failed",
-			"message": "failed to update order status",
-		})
-		return
-	}
-
-	var orderItems []models.OrderItem
-	if err := tx.Preload("Product").Where("order_id = ?", orderId).Find(&orderItems).Error; err != nil {
+	if !CanTransitionOrderStatus(orders.Status, models.OrderStatusCanceled) {
 		tx.Rollback()
-		c.JSON(http.StatusNotFound, gin.H{
-			"status":  "failed",
-			"message": "order items not found for this order",
-		})
-		return
-	}
-
-	for _, orderItem := range orderItems {
-		orderItem.Status = models.OrderStatusCanceled
-		if err := tx.Model(&orderItem).Update("status", orderItem.Status).Error; err != nil {
-			tx.Rollback()
-			c.JSON(http.StatusInternalServerError, gin.H{
-				"status":  "failed",
-				"message": "failed to update order item status",
-			})
-			return
-		}
-
-		orderItem.Product.Availability = true
-		if err := tx.Model(&orderItem.Product).Update("availability", orderItem.Product.Availability).Error; err != nil {
-			tx.Rollback()
-			c.JSON(http.StatusInternalServerError, gin.H{
-				"status":  "failed",
-				"message": "failed to update product availability",
-			})
-			return
-		}
-	}
-
-	tx.Commit()
-
-	c.JSON(http.StatusOK, gin.H{
-		"status":  "success",
-		"message": "Order canceled and amount refunded",
-	})
-}
-
-func ReturnOrder(c *gin.Context) {
-	userID, exists := c.Get("userID")
-	if !exists {
-		c.JSON(http.StatusUnauthorized, gin.H{
-			"status":  "failed",
-			"message": "user not authorized",
-		})
-		return
-	}
-
-	userIDStr, ok := userID.(uint)
-	if !ok {
-		c.JSON(http.StatusInternalServerError, gin.H{
-			"status":  "failed",
-			"message": "failed to retrieve user information",
-		})
-		return
-	}
-
-	orderId := c.Query("orderid")
-	itemId := c.Query("itemid")
-
-	if orderId == "" {
 		c.JSON(http.StatusBadRequest, gin.H{
 			"status":  "failed",
-			"message": "orderId is required",
-		})
-		return
-	}
-
-	var orders models.Order
-	if err := database.DB.Where("user_id = ? AND order_id = ?", userIDStr, orderId).First(&orders).Error; err != nil {
-		c.JSON(http.StatusNotFound, gin.H{
-			"status":  "failed",
-			"message": "order not found for this user",
+			"message": "this order can no longer be cancelled, it is " + orders.Status,
 		})
 		return
 	}
 
-	tx := database.DB.Begin()
-
-	isSeller := false
-
-	// Return single item
-	if itemId != "" {
-		var orderItem models.OrderItem
-		if err := tx.Where("order_id = ? AND order_item_id = ?", orderId, itemId).Preload("Product").First(&orderItem).Error; err != nil {
-			tx.Rollback()
-			c.JSON(http.StatusNotFound, gin.H{
-				"status":  "failed",
-				"message": "order item not found",
-			})
-			return
-		}
-
-		if orderItem.Status != models.OrderStatusDelivered {
-			c.JSON(http.StatusBadRequest, gin.H{
-				"status":  "failed",
-				"message": "item not delivered yet",
-			})
-			return
-		}
-
-		if orderItem.Status == models.OrderStatusReturned {
-			c.JSON(http.StatusBadRequest, gin.H{
-				"status":  "failed",
-				"message": "this item is already returned",
-			})
-			return
-		}
-
-		if orders.PaymentStatus == models.PaymentStatusPaid {
-			err := RefundToUser(tx, userIDStr, orderId, orderItem.FinalAmount, "Single item returned", isSeller)
-			if err != nil {
-				tx.Rollback()
-				c.JSON(http.StatusInternalServerError, gin.H{
-					"status":  "failed",
-					"message": "failed to refund amount",
-				})
-				return
-			}
-		}
-
-		orderItem.Status = models.OrderStatusReturned
-		if err := tx.Model(&orderItem).Update("status", orderItem.Status).Error; err != nil {
-			tx.Rollback()
-			c.JSON(http.StatusInternalServerError, gin.H{
-				"status":  "failed",
-				"message": "failed to return order item",
-			})
-			return
-		}
-
-		orders.FinalAmount -= orderItem.FinalAmount
-		if err := tx.Model(&orders).Update("final_amount", orders.FinalAmount).Error; err != nil {
-			tx.Rollback()
-			c.JSON(http.StatusInternalServerError, gin.H{
-				"status":  "failed",
-				"message": "failed to update order total",
-			})
-			return
-		}
-
-		orderItem.Product.Availability = true
-		if err := tx.Model(&orderItem.Product).Update("availability", orderItem.Product.Availability).Error; err != nil {
-			tx.Rollback()
-			c.JSON(http.StatusInternalServerError, gin.H{
-				"status":  "failed",
-				"message": "failed to update product availability",
-			})
-			return
-		}
-
-		var itemCount int64
-		if err := tx.Model(&models.OrderItem{}).Where("order_id = ? AND status != ?", orderId, models.OrderStatusReturned).Count(&itemCount).Error; err != nil {
+	if orders.PaymentStatus == models.PaymentStatusPaid {
+		err := RefundToUser(tx, id, orderId, orders.FinalAmount, orders.FinalAmount, "Entire order canceled", isSeller, refundTo)
+		if err != nil {
 			tx.Rollback()
 			c.JSON(http.StatusInternalServerError, gin.H{
 				"status":  "failed",
-				"message": "failed to check order items",
+				"message": "failed to refund amount " + err.Error(),
 			})
 			return
 		}
-
-		if itemCount == 0 {
-			orders.Status = models.OrderStatusReturned
-			if err := tx.Model(&orders).Update("status", orders.Status).Error; err != nil {
-				tx.Rollback()
-				c.JSON(http.StatusInternalServerError, gin.H{
-					"status":  "failed",
-					"message": "failed to update order status",
-				})
-				return
-			}
-		}
-
-		tx.Commit()
-
-		c.JSON(http.StatusOK, gin.H{
-			"status":  "success",
-			"message": "Order item returned and amount refunded",
-		})
-		return
 	}
 
-	if orders.Status == models.OrderStatusReturned {
-		c.JSON(http.StatusBadRequest, gin.H{
-			"status":  "failed",
-			"message": "this order is already returned",
-		})
-		return
-	}
-
-	if orders.Status != models.OrderStatusDelivered {
-		c.JSON(http.StatusBadRequest, gin.H{
+	if err := TransitionOrderStatus(tx, &orders, models.OrderStatusCanceled, actor, "entire order canceled"); err != nil {
+		tx.Rollback()
+		c.JSON(http.StatusInternalServerError, gin.H{
 			"status":  "failed",
-			"message": "order is not delivered yet",
+			"message": "failed to update order status",
 		})
 		return
 	}
 
-	if orders.PaymentStatus == models.PaymentStatusPaid {
-		err := RefundToUser(tx, userIDStr, orderId, orders.FinalAmount, "Entire order canceled", isSeller)
-		if err != nil {
-			tx.Rollback()
-			c.JSON(http.StatusInternalServerError, gin.H{
-				"status":  "failed",
-				"message": "failed to refund amount",
-			})
-			return
-		}
-	}
-
-	orders.Status = models.OrderStatusReturned
-	orders.PaymentStatus = models.PaymentStatusRefund
-	if err := tx.Model(&orders).Updates(map[string]interface{}{
-		"status":         orders.Status,
-		"payment_status": orders.PaymentStatus,
-	}).Error; err != nil {
+	orders.PaymentStatus = models.PaymentStatusCanceled
+	if err := tx.Model(&orders).Update("payment_status", orders.PaymentStatus).Error; err != nil {
 		tx.Rollback()
 		c.JSON(http.StatusInternalServerError, gin.H{
 			"status":  "failed",
@@ -1124,18 +1025,20 @@ func ReturnOrder(c *gin.Context) {
 	}
 
 	for _, orderItem := range orderItems {
-		orderItem.Status = models.OrderStatusReturned
-		if err := tx.Model(&orderItem).Update("status", orderItem.Status).Error; err != nil {
+		if orderItem.Status == models.OrderStatusCanceled || orderItem.Status == models.OrderStatusReturned {
+			continue
+		}
+
+		if err := TransitionOrderItemStatus(tx, &orderItem, models.OrderStatusCanceled, actor, "entire order canceled"); err != nil {
 			tx.Rollback()
-			c.JSON(http.StatusInternalServerError, gin.H{
+			c.JSON(statusTransitionHTTPCode(err), gin.H{
 				"status":  "failed",
-				"message": "failed to update order item status",
+				"message": "failed to update order item status: " + err.Error(),
 			})
 			return
 		}
 
-		orderItem.Product.Availability = true
-		if err := tx.Model(&orderItem.Product).Update("availability", orderItem.Product.Availability).Error; err != nil {
+		if err := ReleaseProductStock(tx, orderItem.ProductID, orderItem.Quantity); err != nil {
 			tx.Rollback()
 			c.JSON(http.StatusInternalServerError, gin.H{
 				"status":  "failed",
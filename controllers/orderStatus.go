@@ -0,0 +1,215 @@
+package controllers
+
+import (
+	"errors"
+	"fmt"
+	"knowledgeMart/mailer"
+	"knowledgeMart/models"
+	"net/http"
+	"strconv"
+
+	"gorm.io/gorm"
+)
+
+var ErrInvalidStatusTransition = errors.New("invalid order status transition")
+
+// orderStatusTransitions lists the statuses an order or order item may move to
+// from each status. Canceled and returned are final.
+var orderStatusTransitions = map[string][]string{
+	models.OrderStatusPending:         {models.OrderStatusConfirmed, models.OrderStatusCanceled},
+	models.OrderStatusConfirmed:       {models.OrderStatusShipped, models.OrderStatusCanceled},
+	models.OrderStatusShipped:         {models.OrderStatusOutForDelivery, models.OrderStatusCanceled},
+	models.OrderStatusOutForDelivery:  {models.OrderStatusDelivered},
+	models.OrderStatusDelivered:       {models.OrderStatusReturnRequested},
+	models.OrderStatusReturnRequested: {models.OrderStatusReturned, models.OrderStatusDelivered},
+}
+
+// orderStatusProgress is the forward path a seller walks an item through.
+var orderStatusProgress = []string{
+	models.OrderStatusPending,
+	models.OrderStatusConfirmed,
+	models.OrderStatusShipped,
+	models.OrderStatusOutForDelivery,
+	models.OrderStatusDelivered,
+}
+
+type OrderActor struct {
+	Role string
+	ID   uint
+}
+
+func CanTransitionOrderStatus(from, to string) bool {
+	for _, allowed := range orderStatusTransitions[from] {
+		if allowed == to {
+			return true
+		}
+	}
+	return false
+}
+
+func NextOrderStatus(current string) (string, bool) {
+	for i, status := range orderStatusProgress {
+		if status == current && i+1 < len(orderStatusProgress) {
+			return orderStatusProgress[i+1], true
+		}
+	}
+	return "", false
+}
+
+func TransitionOrderItemStatus(tx *gorm.DB, item *models.OrderItem, to string, actor OrderActor, reason string) error {
+	if !CanTransitionOrderStatus(item.Status, to) {
+		return fmt.Errorf("%w: item %d cannot move from %s to %s", ErrInvalidStatusTransition, item.OrderItemID, item.Status, to)
+	}
+
+	if err := tx.Model(&models.OrderItem{}).Where("order_item_id = ?", item.OrderItemID).Update("status", to).Error; err != nil {
+		return fmt.Errorf("failed to update order item status: %w", err)
+	}
+
+	if err := RecordOrderStatusChange(tx, item.OrderID, item.OrderItemID, item.Status, to, actor, reason); err != nil {
+		return err
+	}
+
+	item.Status = to
+	return nil
+}
+
+func TransitionOrderStatus(tx *gorm.DB, order *models.Order, to string, actor OrderActor, reason string) error {
+	if !CanTransitionOrderStatus(order.Status, to) {
+		return fmt.Errorf("%w: order %d cannot move from %s to %s", ErrInvalidStatusTransition, order.OrderID, order.Status, to)
+	}
+
+	return setOrderStatus(tx, order, to, actor, reason)
+}
+
+// SyncOrderStatus sets the order status derived from its items. Item
+// transitions are validated individually, so the derived order status is
+// recorded without re-checking adjacency.
+func SyncOrderStatus(tx *gorm.DB, order *models.Order, actor OrderActor, reason string) error {
+	var items []models.OrderItem
+	if err := tx.Where("order_id = ?", order.OrderID).Find(&items).Error; err != nil {
+		return fmt.Errorf("failed to retrieve order items: %w", err)
+	}
+
+	derived := deriveOrderStatus(items)
+	if derived == order.Status {
+		return nil
+	}
+
+	return setOrderStatus(tx, order, derived, actor, reason)
+}
+
+// deriveOrderStatus returns the status an order takes from its items: the
+// least advanced active item decides, and once every item is canceled or
+// returned the order follows.
+func deriveOrderStatus(items []models.OrderItem) string {
+	derived := ""
+	derivedIndex := len(orderStatusProgress)
+	anyReturned := false
+	for _, item := range items {
+		switch item.Status {
+		case models.OrderStatusCanceled:
+			continue
+		case models.OrderStatusReturned:
+			anyReturned = true
+			continue
+		}
+		itemStatus := item.Status
+		if itemStatus == models.OrderStatusReturnRequested {
+			itemStatus = models.OrderStatusDelivered
+		}
+		for i, status := range orderStatusProgress {
+			if status == itemStatus && i < derivedIndex {
+				derived, derivedIndex = status, i
+			}
+		}
+	}
+
+	if derived == "" {
+		derived = models.OrderStatusCanceled
+		if anyReturned {
+			derived = models.OrderStatusReturned
+		}
+	}
+	return derived
+}
+
+func RecordOrderStatusChange(tx *gorm.DB, orderID, orderItemID uint, from, to string, actor OrderActor, reason string) error {
+	history := models.OrderStatusHistory{
+		OrderID:       orderID,
+		OrderItemID:   orderItemID,
+		FromStatus:    from,
+		ToStatus:      to,
+		ChangedByRole: actor.Role,
+		ChangedByID:   actor.ID,
+		Reason:        reason,
+	}
+	if err := tx.Create(&history).Error; err != nil {
+		return fmt.Errorf("failed to record order status history: %w", err)
+	}
+	return nil
+}
+
+// ConfirmOrderPayment marks an order paid and moves it and its pending items
+// to confirmed.
+func ConfirmOrderPayment(tx *gorm.DB, order *models.Order, actor OrderActor, reason string) error {
+	if err := tx.Model(&models.Order{}).Where("order_id = ?", order.OrderID).Update("payment_status", models.PaymentStatusPaid).Error; err != nil {
+		return fmt.Errorf("failed to update order payment status: %w", err)
+	}
+	order.PaymentStatus = models.PaymentStatusPaid
+
+	var items []models.OrderItem
+	if err := tx.Where("order_id = ? AND status = ?", order.OrderID, models.OrderStatusPending).Find(&items).Error; err != nil {
+		return fmt.Errorf("failed to retrieve order items: %w", err)
+	}
+
+	for i := range items {
+		if err := TransitionOrderItemStatus(tx, &items[i], models.OrderStatusConfirmed, actor, reason); err != nil {
+			return err
+		}
+	}
+
+	if order.Status == models.OrderStatusPending {
+		return TransitionOrderStatus(tx, order, models.OrderStatusConfirmed, actor, reason)
+	}
+	return nil
+}
+
+func setOrderStatus(tx *gorm.DB, order *models.Order, to string, actor OrderActor, reason string) error {
+	if err := tx.Model(&models.Order{}).Where("order_id = ?", order.OrderID).Update("status", to).Error; err != nil {
+		return fmt.Errorf("failed to update order status: %w", err)
+	}
+
+	if err := RecordOrderStatusChange(tx, order.OrderID, 0, order.Status, to, actor, reason); err != nil {
+		return err
+	}
+
+	order.Status = to
+	notifyOrderStatus(tx, *order)
+	return nil
+}
+
+// notifyOrderStatus emails the buyer about the statuses they are told about:
+// an order confirmed, which for online payments is when it is paid, and an
+// order shipped.
+func notifyOrderStatus(tx *gorm.DB, order models.Order) {
+	switch order.Status {
+	case models.OrderStatusConfirmed:
+		queueUserEmail(tx, order.UserID, mailer.EventOrderPlaced, map[string]interface{}{
+			"OrderIDs":      strconv.Itoa(int(order.OrderID)),
+			"Amount":        order.FinalAmount,
+			"PaymentMethod": order.PaymentMethod,
+		})
+	case models.OrderStatusShipped:
+		queueUserEmail(tx, order.UserID, mailer.EventOrderShipped, map[string]interface{}{
+			"OrderID": order.OrderID,
+			"City":    order.ShippingAddress.City,
+		})
+	}
+}
+
+func statusTransitionHTTPCode(err error) int {
+	if errors.Is(err, ErrInvalidStatusTransition) {
+		return http.StatusBadRequest
+	}
+	return http.StatusInternalServerError
+}
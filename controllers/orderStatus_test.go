@@ -0,0 +1,85 @@
+package controllers
+
+import (
+	"knowledgeMart/models"
+	"testing"
+)
+
+func TestCanTransitionOrderStatus(t *testing.T) {
+	tests := []struct {
+		from, to string
+		want     bool
+	}{
+		{models.OrderStatusPending, models.OrderStatusConfirmed, true},
+		{models.OrderStatusPending, models.OrderStatusCanceled, true},
+		{models.OrderStatusPending, models.OrderStatusShipped, false},
+		{models.OrderStatusConfirmed, models.OrderStatusShipped, true},
+		{models.OrderStatusShipped, models.OrderStatusOutForDelivery, true},
+		{models.OrderStatusShipped, models.OrderStatusCanceled, true},
+		{models.OrderStatusOutForDelivery, models.OrderStatusDelivered, true},
+		{models.OrderStatusOutForDelivery, models.OrderStatusCanceled, false},
+		{models.OrderStatusDelivered, models.OrderStatusReturnRequested, true},
+		{models.OrderStatusDelivered, models.OrderStatusReturned, false},
+		{models.OrderStatusReturnRequested, models.OrderStatusReturned, true},
+		{models.OrderStatusReturnRequested, models.OrderStatusDelivered, true},
+		{models.OrderStatusCanceled, models.OrderStatusPending, false},
+		{models.OrderStatusReturned, models.OrderStatusDelivered, false},
+		{models.OrderStatusConfirmed, models.OrderStatusConfirmed, false},
+		{"unknown", models.OrderStatusConfirmed, false},
+	}
+
+	for _, test := range tests {
+		if got := CanTransitionOrderStatus(test.from, test.to); got != test.want {
+			t.Errorf("CanTransitionOrderStatus(%q, %q) = %v, want %v", test.from, test.to, got, test.want)
+		}
+	}
+}
+
+func TestNextOrderStatus(t *testing.T) {
+	tests := []struct {
+		current string
+		want    string
+		wantOK  bool
+	}{
+		{models.OrderStatusPending, models.OrderStatusConfirmed, true},
+		{models.OrderStatusConfirmed, models.OrderStatusShipped, true},
+		{models.OrderStatusShipped, models.OrderStatusOutForDelivery, true},
+		{models.OrderStatusOutForDelivery, models.OrderStatusDelivered, true},
+		{models.OrderStatusDelivered, "", false},
+		{models.OrderStatusCanceled, "", false},
+	}
+
+	for _, test := range tests {
+		got, ok := NextOrderStatus(test.current)
+		if got != test.want || ok != test.wantOK {
+			t.Errorf("NextOrderStatus(%q) = %q, %v, want %q, %v", test.current, got, ok, test.want, test.wantOK)
+		}
+	}
+}
+
+func TestDeriveOrderStatus(t *testing.T) {
+	tests := []struct {
+		name  string
+		items []string
+		want  string
+	}{
+		{"single pending item", []string{models.OrderStatusPending}, models.OrderStatusPending},
+		{"least advanced item decides", []string{models.OrderStatusShipped, models.OrderStatusConfirmed, models.OrderStatusDelivered}, models.OrderStatusConfirmed},
+		{"canceled items are ignored", []string{models.OrderStatusCanceled, models.OrderStatusShipped}, models.OrderStatusShipped},
+		{"returned items are ignored", []string{models.OrderStatusReturned, models.OrderStatusDelivered}, models.OrderStatusDelivered},
+		{"return requested counts as delivered", []string{models.OrderStatusReturnRequested, models.OrderStatusDelivered}, models.OrderStatusDelivered},
+		{"all canceled", []string{models.OrderStatusCanceled, models.OrderStatusCanceled}, models.OrderStatusCanceled},
+		{"canceled and returned", []string{models.OrderStatusCanceled, models.OrderStatusReturned}, models.OrderStatusReturned},
+		{"no items", nil, models.OrderStatusCanceled},
+	}
+
+	for _, test := range tests {
+		items := make([]models.OrderItem, len(test.items))
+		for i, status := range test.items {
+			items[i] = models.OrderItem{Status: status}
+		}
+		if got := deriveOrderStatus(items); got != test.want {
+			t.Errorf("%s: deriveOrderStatus() = %q, want %q", test.name, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,38 @@
+package controllers
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestApportionAmount(t *testing.T) {
+	tests := []struct {
+		name    string
+		amount  float64
+		weights []float64
+		want    []float64
+	}{
+		{"no weights", 100, nil, []float64{}},
+		{"zero amount", 0, []float64{1, 2}, []float64{0, 0}},
+		{"single weight takes everything", 99.99, []float64{5}, []float64{99.99}},
+		{"proportional split", 100, []float64{1, 3}, []float64{25, 75}},
+		{"rounding remainder goes to the last share", 100, []float64{1, 1, 1}, []float64{33.33, 33.33, 33.34}},
+		{"negative weights count as zero", 50, []float64{-10, 10}, []float64{0, 50}},
+		{"all zero weights leave it to the last share", 30, []float64{0, 0, 0}, []float64{0, 0, 30}},
+	}
+
+	for _, test := range tests {
+		got := apportionAmount(test.amount, test.weights)
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%s: apportionAmount(%v, %v) = %v, want %v", test.name, test.amount, test.weights, got, test.want)
+		}
+
+		var total float64
+		for _, share := range got {
+			total += share
+		}
+		if len(test.weights) > 0 && RoundDecimalValue(total) != RoundDecimalValue(test.amount) {
+			t.Errorf("%s: shares add up to %v, want %v", test.name, total, test.amount)
+		}
+	}
+}
@@ -0,0 +1,378 @@
+package controllers
+
+import (
+	"crypto/rand"
+	"errors"
+	"fmt"
+	database "knowledgeMart/config"
+	"knowledgeMart/mailer"
+	"knowledgeMart/models"
+	"knowledgeMart/utils"
+	"math/big"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-playground/validator/v10"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const (
+	passwordResetExpiry      = 15 * time.Minute
+	passwordResetCooldown    = time.Minute
+	passwordResetMaxAttempts = 5
+)
+
+var (
+	ErrInvalidResetCode  = errors.New("invalid or expired OTP")
+	ErrTooManyResetTries = errors.New("too many wrong attempts, request a new OTP")
+)
+
+// passwordResetSent is the reply to every reset request, whether or not the
+// account exists, so the endpoint cannot be used to look up accounts.
+const passwordResetSent = "if the account exists, an OTP to reset the password has been sent to its email"
+
+// startPasswordReset emails a fresh one-time code to the owner and replaces
+// any code sent before. Only a hash of the code is stored. Asking again within
+// the cooldown sends nothing, the earlier code still works.
+func startPasswordReset(role string, ownerID uint, email string) error {
+	var recent int64
+	if err := database.DB.Model(&models.PasswordReset{}).
+		Where("role = ? AND owner_id = ? AND created_at > ?", role, ownerID, time.Now().Add(-passwordResetCooldown)).
+		Count(&recent).Error; err != nil {
+		return fmt.Errorf("failed to check password resets: %w", err)
+	}
+	if recent > 0 {
+		return nil
+	}
+
+	otp, err := newResetCode()
+	if err != nil {
+		return err
+	}
+
+	tx := database.DB.Begin()
+
+	now := time.Now()
+	if err := tx.Model(&models.PasswordReset{}).
+		Where("role = ? AND owner_id = ? AND used_at IS NULL", role, ownerID).
+		Update("used_at", &now).Error; err != nil {
+		tx.Rollback()
+		return fmt.Errorf("failed to invalidate previous password resets: %w", err)
+	}
+
+	reset := models.PasswordReset{
+		Role:      role,
+		OwnerID:   ownerID,
+		CodeHash:  utils.HashToken(otp),
+		ExpiresAt: now.Add(passwordResetExpiry),
+	}
+	if err := tx.Create(&reset).Error; err != nil {
+		tx.Rollback()
+		return fmt.Errorf("failed to create password reset: %w", err)
+	}
+
+	if err := QueueEmail(tx, email, mailer.EventPasswordReset, map[string]interface{}{
+		"OTP":              otp,
+		"ExpiresInMinutes": int(passwordResetExpiry.Minutes()),
+	}); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	if err := tx.Commit().Error; err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return nil
+}
+
+// newResetCode returns a random six digit code read from crypto/rand, since
+// whoever guesses it can take over the account.
+func newResetCode() (string, error) {
+	n, err := rand.Int(rand.Reader, big.NewInt(900000))
+	if err != nil {
+		return "", fmt.Errorf("failed to generate reset code: %w", err)
+	}
+	return strconv.FormatInt(n.Int64()+100000, 10), nil
+}
+
+// consumePasswordReset checks otp against the owner's pending reset and, when
+// it matches, runs apply and marks the reset used in the same transaction, so
+// the code is only spent once the password has changed. Wrong codes count
+// against the attempt limit, after which the reset is burnt.
+func consumePasswordReset(role string, ownerID uint, otp string, apply func(tx *gorm.DB) error) error {
+	tx := database.DB.Begin()
+
+	var reset models.PasswordReset
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+		Where("role = ? AND owner_id = ? AND used_at IS NULL", role, ownerID).
+		Order("created_at DESC").
+		First(&reset).Error; err != nil {
+		tx.Rollback()
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return ErrInvalidResetCode
+		}
+		return fmt.Errorf("failed to retrieve password reset: %w", err)
+	}
+
+	if time.Now().After(reset.ExpiresAt) {
+		tx.Rollback()
+		return ErrInvalidResetCode
+	}
+
+	now := time.Now()
+	if reset.CodeHash != utils.HashToken(otp) {
+		updates := map[string]interface{}{"attempts": reset.Attempts + 1}
+		if reset.Attempts+1 >= passwordResetMaxAttempts {
+			updates["used_at"] = &now
+		}
+		if err := tx.Model(&reset).Updates(updates).Error; err != nil {
+			tx.Rollback()
+			return fmt.Errorf("failed to update password reset: %w", err)
+		}
+		if err := tx.Commit().Error; err != nil {
+			return fmt.Errorf("failed to commit transaction: %w", err)
+		}
+		if reset.Attempts+1 >= passwordResetMaxAttempts {
+			return ErrTooManyResetTries
+		}
+		return ErrInvalidResetCode
+	}
+
+	if err := apply(tx); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	if err := tx.Model(&reset).Update("used_at", &now).Error; err != nil {
+		tx.Rollback()
+		return fmt.Errorf("failed to update password reset: %w", err)
+	}
+	return tx.Commit().Error
+}
+
+func passwordResetStatus(err error) int {
+	switch {
+	case errors.Is(err, ErrInvalidResetCode):
+		return http.StatusBadRequest
+	case errors.Is(err, ErrTooManyResetTries):
+		return http.StatusTooManyRequests
+	}
+	return http.StatusInternalServerError
+}
+
+func ForgotPassword(c *gin.Context) {
+	var request models.ForgotPasswordRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"status":  "failed",
+			"message": "failed to process the incoming request",
+		})
+		return
+	}
+
+	validate := validator.New()
+	if err := validate.Struct(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"status":  "failed",
+			"message": err.Error(),
+		})
+		return
+	}
+
+	var user models.User
+	if err := database.DB.Where("email = ? AND deleted_at IS NULL AND login_method = ?", request.Email, "email").First(&user).Error; err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"status":  "success",
+			"message": passwordResetSent,
+		})
+		return
+	}
+
+	if err := startPasswordReset(models.RoleUser, user.ID, user.Email); err != nil {
+		c.JSON(passwordResetStatus(err), gin.H{
+			"status":  "failed",
+			"message": err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"status":  "success",
+		"message": passwordResetSent,
+	})
+}
+
+func ResetPassword(c *gin.Context) {
+	var request models.ResetPasswordRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"status":  "failed",
+			"message": "failed to process the incoming request",
+		})
+		return
+	}
+
+	validate := validator.New()
+	if err := validate.Struct(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"status":  "failed",
+			"message": err.Error(),
+		})
+		return
+	}
+
+	if request.NewPassword != request.ConfirmPassword {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"status":  "failed",
+			"message": "New password and confirm password do not match",
+		})
+		return
+	}
+
+	var user models.User
+	if err := database.DB.Where("email = ? AND deleted_at IS NULL AND login_method = ?", request.Email, "email").First(&user).Error; err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"status":  "failed",
+			"message": ErrInvalidResetCode.Error(),
+		})
+		return
+	}
+
+	hashpassword, err := HashPassword(request.NewPassword)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"status":  "failed",
+			"message": "error in password hashing",
+		})
+		return
+	}
+
+	if err := consumePasswordReset(models.RoleUser, user.ID, request.OTP, func(tx *gorm.DB) error {
+		if err := tx.Model(&user).Update("password", hashpassword).Error; err != nil {
+			return fmt.Errorf("failed to update password")
+		}
+		return RevokeSessions(tx, models.RoleUser, user.ID, "password reset", 0)
+	}); err != nil {
+		c.JSON(passwordResetStatus(err), gin.H{
+			"status":  "failed",
+			"message": err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"status":  "success",
+		"message": "password has been reset, please log in again",
+	})
+}
+
+func SellerForgotPassword(c *gin.Context) {
+	var request models.SellerForgotPasswordRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"status":  "failed",
+			"message": "failed to process the incoming request",
+		})
+		return
+	}
+
+	validate := validator.New()
+	if err := validate.Struct(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"status":  "failed",
+			"message": err.Error(),
+		})
+		return
+	}
+
+	// sellers have no email of their own, the OTP goes to the user account
+	// the seller was registered from
+	var seller models.Seller
+	if err := database.DB.Preload("User").Where("user_name = ? AND deleted_at IS NULL", request.UserName).First(&seller).Error; err != nil || seller.User.Email == "" {
+		c.JSON(http.StatusOK, gin.H{
+			"status":  "success",
+			"message": passwordResetSent,
+		})
+		return
+	}
+
+	if err := startPasswordReset(models.RoleSeller, seller.ID, seller.User.Email); err != nil {
+		c.JSON(passwordResetStatus(err), gin.H{
+			"status":  "failed",
+			"message": err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"status":  "success",
+		"message": passwordResetSent,
+	})
+}
+
+func SellerResetPassword(c *gin.Context) {
+	var request models.SellerResetPasswordRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"status":  "failed",
+			"message": "failed to process the incoming request",
+		})
+		return
+	}
+
+	validate := validator.New()
+	if err := validate.Struct(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"status":  "failed",
+			"message": err.Error(),
+		})
+		return
+	}
+
+	if request.NewPassword != request.ConfirmPassword {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"status":  "failed",
+			"message": "New password and confirm password do not match",
+		})
+		return
+	}
+
+	var seller models.Seller
+	if err := database.DB.Where("user_name = ? AND deleted_at IS NULL", request.UserName).First(&seller).Error; err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"status":  "failed",
+			"message": ErrInvalidResetCode.Error(),
+		})
+		return
+	}
+
+	hashpassword, err := HashPassword(request.NewPassword)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"status":  "failed",
+			"message": "error in password hashing",
+		})
+		return
+	}
+
+	if err := consumePasswordReset(models.RoleSeller, seller.ID, request.OTP, func(tx *gorm.DB) error {
+		if err := tx.Model(&seller).Update("password", hashpassword).Error; err != nil {
+			return fmt.Errorf("failed to update password")
+		}
+		return RevokeSessions(tx, models.RoleSeller, seller.ID, "password reset", 0)
+	}); err != nil {
+		c.JSON(passwordResetStatus(err), gin.H{
+			"status":  "failed",
+			"message": err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"status":  "success",
+		"message": "password has been reset, please log in again",
+	})
+}
@@ -1,54 +1,67 @@
 package controllers
 
 import (
-	"crypto/hmac"
-	"crypto/sha256"
-	"encoding/hex"
 	"errors"
 	"fmt"
 	database "knowledgeMart/config"
 	"knowledgeMart/models"
+	"knowledgeMart/payments"
 	"log"
+	"math"
 	"net/http"
-	"os"
+	"strconv"
 
 	"github.com/gin-gonic/gin"
-	"github.com/razorpay/razorpay-go"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
 func RenderRazorpay(c *gin.Context) {
-	orderID := c.Query("orderID")
-	if orderID == "" {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Order ID is required"})
+	checkoutID := c.Query("checkoutID")
+	if checkoutID == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Checkout ID is required"})
 		return
 	}
 	c.HTML(http.StatusOK, "payment.html", gin.H{
-		"orderID": orderID,
+		"checkoutID": checkoutID,
 	})
-	fmt.Println(orderID)
 }
 
+var ErrPaymentMismatch = errors.New("payment does not match the checkout")
+
 func CreateOrder(c *gin.Context) {
-	fmt.Println("order starting")
-	client := razorpay.NewClient(os.Getenv("RAZORPAY_KEY_ID"), os.Getenv("RAZORPAY_KEY_SECRET"))
+	userID, exists := c.Get("userID")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"status": "failed", "message": "user not authorized"})
+		return
+	}
+	userIDUint, ok := userID.(uint)
+	if !ok {
+		c.JSON(http.StatusInternalServerError, gin.H{"status": "failed", "message": "failed to retrieve user information"})
+		return
+	}
 
-	orderIDStr := c.Param("orderID")
-	if orderIDStr == "" {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Order ID is required"})
+	provider, err := payments.NewProvider()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
 
-	fmt.Println("orderid=" + orderIDStr)
-	var order models.Order
+	checkoutIDStr := c.Param("checkoutID")
+	if checkoutIDStr == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Checkout ID is required"})
+		return
+	}
 
-	if err := database.DB.Model(&models.Order{}).Where("order_id=?", orderIDStr).First(&order).Error; err != nil {
-		fmt.Println("Error fetching order:", err)
+	var checkout models.Checkout
+
+	if err := database.DB.Where("checkout_id = ? AND user_id = ?", checkoutIDStr, userIDUint).First(&checkout).Error; err != nil {
+		log.Printf("failed to fetch checkout %s: %v", checkoutIDStr, err)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error fetching order"})
 		return
 	}
 
-	if order.PaymentStatus == models.PaymentStatusFailed {
+	if checkout.PaymentStatus == models.PaymentStatusFailed {
 		c.JSON(http.StatusBadRequest, gin.H{
 			"status":  "failed",
 			"message": "your maximum payment attempt is reached",
@@ -56,49 +69,113 @@ func CreateOrder(c *gin.Context) {
 		return
 	}
 
-	if order.PaymentMethod != models.Razorpay {
+	if checkout.PaymentMethod != models.Razorpay {
 		c.JSON(http.StatusBadRequest, gin.H{
 			"status":  "failed",
 			"message": "you chose another payment method",
 		})
 		return
 	}
-	if order.PaymentStatus == models.PaymentStatusPaid {
+	if checkout.PaymentStatus == models.PaymentStatusPaid {
 		c.JSON(http.StatusBadRequest, gin.H{
 			"status":  "failed",
 			"message": "you already paid for this order",
 		})
 		return
 	}
+	if checkout.PaymentStatus == models.PaymentStatusCanceled {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"status":  "failed",
+			"message": "this checkout has expired, please place the order again",
+		})
+		return
+	}
 
-	amount := int(order.FinalAmount * 100)
-
-	razorpayOrder, err := client.Order.Create(map[string]interface{}{
-		"amount":   amount,
-		"currency": "INR",
-		"receipt":  "order_rcptid_11",
-	}, nil)
-
-	fmt.Println("amount:", amount)
+	intent, err := checkoutGatewayOrder(database.DB, provider, checkout)
 	if err != nil {
-		fmt.Println("Error creating Razorpay order:", err)
+		log.Printf("failed to create payment order for checkout %d: %v", checkout.CheckoutID, err)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error creating order"})
 		return
 	}
 
 	c.JSON(http.StatusOK, gin.H{
-		"order_id": razorpayOrder["id"],
-		"amount":   amount,
-		"currency": "INR",
+		"order_id":    intent.RazorpayOrderID,
+		"amount":      intent.GatewayAmount,
+		"currency":    "INR",
+		"provider":    provider.Name(),
+		"client_data": provider.ClientData(intent.RazorpayOrderID),
 	})
-	fmt.Println(razorpayOrder)
+}
+
+// checkoutGatewayOrder returns the gateway order a checkout is paid against.
+// The order is created once and stored as a pending payment record, so retries
+// from the checkout page reuse it instead of opening a new gateway order.
+func checkoutGatewayOrder(tx *gorm.DB, provider payments.PaymentProvider, checkout models.Checkout) (models.Payment, error) {
+	amount := checkoutGatewayAmount(checkout)
+
+	var existing models.Payment
+	err := tx.Where("checkout_id = ? AND payment_gateway = ? AND payment_status = ?", checkout.CheckoutID, provider.Name(), models.OnlinePaymentPending).
+		Order("id DESC").
+		First(&existing).Error
+	if err == nil && existing.GatewayAmount == amount {
+		return existing, nil
+	}
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		return models.Payment{}, fmt.Errorf("failed to retrieve payment record: %w", err)
+	}
+
+	intent, err := provider.CreateIntent(payments.IntentRequest{
+		Amount:   amount,
+		Currency: "INR",
+		Receipt:  fmt.Sprintf("checkout_%d", checkout.CheckoutID),
+		Notes: map[string]string{
+			"checkout_id": strconv.Itoa(int(checkout.CheckoutID)),
+		},
+	})
+	if err != nil {
+		return models.Payment{}, err
+	}
+
+	if err := tx.Model(&models.Payment{}).
+		Where("checkout_id = ? AND payment_status = ?", checkout.CheckoutID, models.OnlinePaymentPending).
+		Update("payment_status", models.PaymentStatusCanceled).Error; err != nil {
+		return models.Payment{}, fmt.Errorf("failed to update payment record: %w", err)
+	}
+
+	payment := models.Payment{
+		OrderID:         "",
+		CheckoutID:      checkout.CheckoutID,
+		RazorpayOrderID: intent.ID,
+		PaymentGateway:  provider.Name(),
+		PaymentStatus:   models.OnlinePaymentPending,
+		GatewayAmount:   amount,
+	}
+	if err := tx.Create(&payment).Error; err != nil {
+		return models.Payment{}, fmt.Errorf("failed to create payment record: %w", err)
+	}
+
+	return payment, nil
+}
+
+func checkoutGatewayAmount(checkout models.Checkout) int64 {
+	return int64(math.Round(checkout.FinalAmount * 100))
 }
 
 func VerifyPayment(c *gin.Context) {
-	fmt.Println("VerifyPayment started")
-	orderIDStr := c.Param("orderID")
-	if orderIDStr == "" {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Order ID is required"})
+	userID, exists := c.Get("userID")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"status": "failed", "message": "user not authorized"})
+		return
+	}
+	userIDUint, ok := userID.(uint)
+	if !ok {
+		c.JSON(http.StatusInternalServerError, gin.H{"status": "failed", "message": "failed to retrieve user information"})
+		return
+	}
+
+	checkoutIDStr := c.Param("checkoutID")
+	if checkoutIDStr == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Checkout ID is required"})
 		return
 	}
 
@@ -109,137 +186,204 @@ func VerifyPayment(c *gin.Context) {
 	}
 
 	if err := c.BindJSON(&paymentInfo); err != nil {
-		fmt.Println("binding error")
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid payment information"})
 		return
 	}
 
-	fmt.Println("Payment Info:", paymentInfo)
-
-	// Initialize transaction
-	tx := database.DB.Begin()
-	if tx.Error != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start transaction"})
+	var checkout models.Checkout
+	if err := database.DB.Where("checkout_id = ? AND user_id = ?", checkoutIDStr, userIDUint).First(&checkout).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"status": "failed", "message": "Checkout not found"})
 		return
 	}
 
-	payment := models.Payment{
-		OrderID:           orderIDStr,
-		WalletPaymentID:   "",
-		RazorpayOrderID:   paymentInfo.OrderID,
-		RazorpayPaymentID: paymentInfo.PaymentID,
-		RazorpaySignature: paymentInfo.Signature,
-		PaymentGateway:    models.Razorpay,
-		PaymentStatus:     models.OnlinePaymentPending,
+	provider, err := payments.NewProvider()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"status": "failed", "message": err.Error()})
+		return
 	}
 
-	if err := tx.Create(&payment).Error; err != nil {
-		tx.Rollback()
-		fmt.Println("Failed to create payment record:", err)
-		c.JSON(http.StatusInternalServerError, gin.H{"status": "failed", "message": "Failed to create payment record: " + err.Error()})
+	var gatewayOrder models.Payment
+	if err := database.DB.Where("checkout_id = ? AND razorpay_order_id = ? AND payment_gateway = ?", checkout.CheckoutID, paymentInfo.OrderID, provider.Name()).
+		First(&gatewayOrder).Error; err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"status": "failed", "message": "payment order does not belong to this checkout"})
 		return
 	}
 
-	secret := os.Getenv("RAZORPAY_KEY_SECRET")
-	if verifySignature(paymentInfo.OrderID, paymentInfo.PaymentID, paymentInfo.Signature, secret) {
-		if err := tx.Model(&models.Order{}).
-			Where("order_id = ?", orderIDStr).
-			Updates(map[string]interface{}{
-				"payment_status": models.PaymentStatusPaid,
-				"status":         models.OrderStatusConfirmed,
-			}).Error; err != nil {
-			tx.Rollback()
-			c.JSON(http.StatusInternalServerError, gin.H{"status": "failed", "message": "Failed to update order payment and status"})
+	if err := provider.VerifyPayment(payments.Verification{
+		IntentID:  paymentInfo.OrderID,
+		PaymentID: paymentInfo.PaymentID,
+		Signature: paymentInfo.Signature,
+	}); err != nil {
+		if errors.Is(err, payments.ErrInvalidSignature) {
+			c.JSON(http.StatusOK, gin.H{"status": "Payment verification failed, order marked as pending"})
 			return
 		}
+		c.JSON(http.StatusBadRequest, gin.H{"status": "failed", "message": err.Error()})
+		return
+	}
 
-		if err := tx.Model(&models.OrderItem{}).
-			Where("order_id = ?", orderIDStr).
-			Update("status", models.OrderStatusConfirmed).Error; err != nil {
-			tx.Rollback()
-			c.JSON(http.StatusInternalServerError, gin.H{"status": "failed", "message": "Failed to update order item status"})
-			return
-		}
+	gatewayPayment, err := provider.FetchStatus(paymentInfo.PaymentID)
+	if err != nil {
+		c.JSON(http.StatusBadGateway, gin.H{"status": "failed", "message": "failed to fetch payment from the gateway"})
+		return
+	}
+	if gatewayPayment.IntentID != paymentInfo.OrderID {
+		c.JSON(http.StatusBadRequest, gin.H{"status": "failed", "message": "payment does not belong to this payment order"})
+		return
+	}
+	if gatewayPayment.Status != payments.PaymentCaptured {
+		c.JSON(http.StatusBadRequest, gin.H{"status": "failed", "message": fmt.Sprintf("payment is %s, not captured", gatewayPayment.Status)})
+		return
+	}
+	if gatewayPayment.Amount != checkoutGatewayAmount(checkout) {
+		c.JSON(http.StatusBadRequest, gin.H{"status": "failed", "message": "amount paid does not match the checkout amount"})
+		return
+	}
 
-		var orderItems []models.OrderItem
-		if err := tx.Where("order_id = ?", orderIDStr).Find(&orderItems).Error; err != nil {
-			tx.Rollback()
-			c.JSON(http.StatusInternalServerError, gin.H{"status": "failed", "message": "Failed to fetch order items"})
+	tx := database.DB.Begin()
+	if tx.Error != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start transaction"})
+		return
+	}
+
+	_, err = confirmGatewayCheckout(tx, checkout.CheckoutID, provider.Name(), paymentInfo.OrderID, paymentInfo.PaymentID, paymentInfo.Signature, gatewayPayment.Amount)
+	if errors.Is(err, ErrCheckoutExpired) {
+		if err := tx.Commit().Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"status": "failed", "message": "Transaction commit failed"})
 			return
 		}
+		c.JSON(http.StatusGone, gin.H{"status": "failed", "message": "this checkout expired before the payment completed, the amount has been refunded"})
+		return
+	}
+	if err != nil {
+		tx.Rollback()
+		status := http.StatusInternalServerError
+		if errors.Is(err, ErrPaymentMismatch) {
+			status = http.StatusBadRequest
+		}
+		c.JSON(status, gin.H{"status": "failed", "message": err.Error()})
+		return
+	}
+
+	if err := tx.Commit().Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"status": "failed", "message": "Transaction commit failed"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"status": "Payment verified successfully"})
+}
+
+// confirmGatewayCheckout records a captured gateway payment against every
+// order of the checkout and confirms them. The payment must be for the gateway
+// order stored against the checkout and for its full amount. Both the browser
+// callback and the webhook end up here, so a checkout that is already paid is
+// left untouched and reported through the returned flag.
+func confirmGatewayCheckout(tx *gorm.DB, checkoutID uint, gateway, gatewayOrderID, gatewayPaymentID, signature string, amountPaid int64) (bool, error) {
+	var checkout models.Checkout
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("checkout_id = ?", checkoutID).First(&checkout).Error; err != nil {
+		return false, fmt.Errorf("checkout not found")
+	}
 
-		for _, item := range orderItems {
-			if err := tx.Model(&models.Product{}).
-				Where("id = ?", item.ProductID).
-				Update("availability", false).Error; err != nil {
-				tx.Rollback()
-				c.JSON(http.StatusInternalServerError, gin.H{"status": "failed", "message": "Failed to update product availability"})
-				return
+	if checkout.PaymentStatus == models.PaymentStatusPaid {
+		return true, nil
+	}
+
+	var gatewayOrder models.Payment
+	if err := tx.Where("checkout_id = ? AND razorpay_order_id = ? AND payment_gateway = ?", checkout.CheckoutID, gatewayOrderID, gateway).
+		First(&gatewayOrder).Error; err != nil {
+		return false, fmt.Errorf("%w: payment order %s does not belong to checkout %d", ErrPaymentMismatch, gatewayOrderID, checkout.CheckoutID)
+	}
+
+	if amountPaid != gatewayOrder.GatewayAmount || amountPaid != checkoutGatewayAmount(checkout) {
+		return false, fmt.Errorf("%w: paid %d, expected %d", ErrPaymentMismatch, amountPaid, checkoutGatewayAmount(checkout))
+	}
+
+	// The checkout expired while the buyer was paying. Its orders are already
+	// canceled, so the payment is refunded once and the caller is told why.
+	if checkout.PaymentStatus == models.PaymentStatusCanceled {
+		if gatewayOrder.PaymentStatus != models.PaymentStatusRefund {
+			if err := refundExpiredPayment(tx, checkout.UserID, gatewayOrder.ID, gateway, gatewayPaymentID, amountPaid, "checkout expired"); err != nil {
+				return false, fmt.Errorf("failed to refund payment for expired checkout: %w", err)
+			}
+			if err := tx.Model(&gatewayOrder).Updates(map[string]interface{}{
+				"razorpay_payment_id": gatewayPaymentID,
+				"payment_status":      models.PaymentStatusRefund,
+				"amount_paid":         float64(amountPaid) / 100,
+			}).Error; err != nil {
+				return false, fmt.Errorf("failed to update payment record: %w", err)
 			}
 		}
+		return false, ErrCheckoutExpired
+	}
 
-		var order models.Order
-		if err := tx.Where("order_id = ?", orderIDStr).First(&order).Error; err != nil {
-			tx.Rollback()
-			c.JSON(http.StatusInternalServerError, gin.H{
-				"status":  "failed",
-				"message": "Failed to fetch order",
-			})
-			return
-		}
+	if err := tx.Model(&gatewayOrder).Updates(map[string]interface{}{
+		"razorpay_payment_id": gatewayPaymentID,
+		"razorpay_signature":  signature,
+		"payment_status":      models.OnlinePaymentConfirmed,
+		"amount_paid":         float64(amountPaid) / 100,
+	}).Error; err != nil {
+		return false, fmt.Errorf("failed to update payment record: %w", err)
+	}
 
-		userID := order.UserID
-		if err := tx.Where("user_id = ?", userID).Delete(&models.Cart{}).Error; err != nil {
-			tx.Rollback()
-			c.JSON(http.StatusInternalServerError, gin.H{"status": "failed", "message": "Failed to delete user's cart"})
-			return
-		}
+	var orders []models.Order
+	if err := tx.Where("checkout_id = ?", checkout.CheckoutID).Find(&orders).Error; err != nil || len(orders) == 0 {
+		return false, fmt.Errorf("no orders found for this checkout")
+	}
 
-		if err := tx.Model(&models.Payment{}).
-			Where("order_id = ?", orderIDStr).
-			Update("payment_status", models.PaymentStatusPaid).Error; err != nil {
-			tx.Rollback()
-			c.JSON(http.StatusInternalServerError, gin.H{"status": "failed", "message": "Failed to update payment status"})
-			return
+	for i := range orders {
+		payment := models.Payment{
+			OrderID:           strconv.Itoa(int(orders[i].OrderID)),
+			CheckoutID:        checkout.CheckoutID,
+			WalletPaymentID:   "",
+			RazorpayOrderID:   gatewayOrderID,
+			RazorpayPaymentID: gatewayPaymentID,
+			RazorpaySignature: signature,
+			PaymentGateway:    gateway,
+			PaymentStatus:     models.PaymentStatusPaid,
+			AmountPaid:        orders[i].FinalAmount,
 		}
 
-		if !AddMoneyToSellerWallet(orderIDStr) {
-			tx.Rollback()
-			c.JSON(http.StatusInternalServerError, gin.H{"status": "failed", "message": "Failed to add money to seller wallet"})
-			return
+		if err := tx.Create(&payment).Error; err != nil {
+			return false, fmt.Errorf("failed to create payment record: %w", err)
 		}
 
-		if err := tx.Commit().Error; err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"status": "failed", "message": "Transaction commit failed"})
-			return
+		if err := ConfirmOrderPayment(tx, &orders[i], OrderActor{Role: models.ActorSystem}, gateway+" payment verified"); err != nil {
+			return false, fmt.Errorf("failed to update order payment and status")
 		}
 
-		fmt.Println("Payment verified successfully, order confirmed")
-		c.JSON(http.StatusOK, gin.H{"status": "Payment verified successfully"})
-	} else {
-		tx.Rollback()
-		fmt.Println("Invalid payment signature, order marked as pending")
-		c.JSON(http.StatusOK, gin.H{"status": "Payment verification failed, order marked as pending"})
+		if !AddMoneyToSellerWallet(tx, strconv.Itoa(int(orders[i].OrderID))) {
+			return false, fmt.Errorf("failed to add money to seller wallet")
+		}
 	}
-}
-
-func verifySignature(orderID, paymentID, signature, secret string) bool {
-	data := orderID + "|" + paymentID
-
-	h := hmac.New(sha256.New, []byte(secret))
 
-	h.Write([]byte(data))
+	if err := tx.Model(&checkout).Update("payment_status", models.PaymentStatusPaid).Error; err != nil {
+		return false, fmt.Errorf("failed to update checkout payment status")
+	}
 
-	expectedSignature := hex.EncodeToString(h.Sum(nil))
+	if err := tx.Where("user_id = ?", checkout.UserID).Delete(&models.Cart{}).Error; err != nil {
+		return false, fmt.Errorf("failed to delete user's cart")
+	}
 
-	return expectedSignature == signature
+	return false, nil
 }
+
 func HandleFailedPayment(c *gin.Context) {
 	log.Println("HandleFailedPayment function started")
 
-	orderIDStr := c.Param("orderID")
-	if orderIDStr == "" {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Order ID is required"})
+	userID, exists := c.Get("userID")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"status": "failed", "message": "user not authorized"})
+		return
+	}
+	userIDUint, ok := userID.(uint)
+	if !ok {
+		c.JSON(http.StatusInternalServerError, gin.H{"status": "failed", "message": "failed to retrieve user information"})
+		return
+	}
+
+	checkoutIDStr := c.Param("checkoutID")
+	if checkoutIDStr == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Checkout ID is required"})
 		return
 	}
 
@@ -251,39 +395,73 @@ func HandleFailedPayment(c *gin.Context) {
 		return
 	}
 
-	var order models.Order
-	if err := database.DB.Where("order_id = ?", orderIDStr).First(&order).Error; err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Order not found"})
+	var checkout models.Checkout
+	if err := database.DB.Where("checkout_id = ? AND user_id = ?", checkoutIDStr, userIDUint).First(&checkout).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Order not found"})
 		return
 	}
 
-	order.FailedPaymentCount++
-	if order.FailedPaymentCount >= 3 {
-		order.PaymentStatus = models.PaymentStatusFailed
+	provider, err := payments.NewProvider()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	tx := database.DB.Begin()
+
+	checkout.FailedPaymentCount++
+	if checkout.FailedPaymentCount >= 3 {
+		checkout.PaymentStatus = models.PaymentStatusFailed
 
 		payment := models.Payment{
-			OrderID:           orderIDStr,
+			OrderID:           "",
+			CheckoutID:        checkout.CheckoutID,
 			WalletPaymentID:   "",
 			RazorpayOrderID:   "",
 			RazorpayPaymentID: "",
 			RazorpaySignature: "",
-			PaymentGateway:    models.Razorpay,
+			PaymentGateway:    provider.Name(),
 			PaymentStatus:     models.PaymentStatusFailed,
 		}
 
-		if err := database.DB.Create(&payment).Error; err != nil {
+		if err := tx.Create(&payment).Error; err != nil {
+			tx.Rollback()
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create payment record"})
 			return
 		}
+
+		if err := tx.Model(&models.Payment{}).Where("checkout_id = ? AND payment_status = ?", checkout.CheckoutID, models.OnlinePaymentPending).
+			Update("payment_status", models.OnlinePaymentFailed).Error; err != nil {
+			tx.Rollback()
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update payment record"})
+			return
+		}
+
+		if err := tx.Model(&models.Order{}).Where("checkout_id = ?", checkout.CheckoutID).
+			Update("payment_status", models.PaymentStatusFailed).Error; err != nil {
+			tx.Rollback()
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update order payment status"})
+			return
+		}
 	}
 
-	if err := database.DB.Save(&order).Error; err != nil {
+	if err := tx.Model(&models.Order{}).Where("checkout_id = ?", checkout.CheckoutID).
+		Update("failed_payment_count", checkout.FailedPaymentCount).Error; err != nil {
+		tx.Rollback()
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update order payment status"})
 		return
 	}
 
+	if err := tx.Save(&checkout).Error; err != nil {
+		tx.Rollback()
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update order payment status"})
+		return
+	}
+
+	tx.Commit()
+
 	statusMessage := "Payment failed, please try again."
-	if order.PaymentStatus == models.PaymentStatusFailed {
+	if checkout.PaymentStatus == models.PaymentStatusFailed {
 		statusMessage = "Order payment status marked as failed after multiple attempts."
 	}
 
@@ -292,14 +470,25 @@ func HandleFailedPayment(c *gin.Context) {
 		"message": statusMessage,
 		"reason":  requestBody.Reason,
 	})
-	fmt.Printf("Order %s failed payment attempt %d. Status: %s\n", orderIDStr, order.FailedPaymentCount, order.PaymentStatus)
+	log.Printf("checkout %s failed payment attempt %d, status %s", checkoutIDStr, checkout.FailedPaymentCount, checkout.PaymentStatus)
 }
 
 func CheckFailedAttempts(c *gin.Context) {
-	orderID := c.Param("orderID")
+	userID, exists := c.Get("userID")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"status": "failed", "message": "user not authorized"})
+		return
+	}
+	userIDUint, ok := userID.(uint)
+	if !ok {
+		c.JSON(http.StatusInternalServerError, gin.H{"status": "failed", "message": "failed to retrieve user information"})
+		return
+	}
+
+	checkoutID := c.Param("checkoutID")
 
-	var order models.Order
-	err := database.DB.Select("failed_payment_count").First(&order, orderID).Error
+	var checkout models.Checkout
+	err := database.DB.Select("failed_payment_count").Where("checkout_id = ? AND user_id = ?", checkoutID, userIDUint).First(&checkout).Error
 
 	if err != nil {
 		if errors.Is(err, gorm.ErrRecordNotFound) {
@@ -310,5 +499,5 @@ func CheckFailedAttempts(c *gin.Context) {
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{"failed_attempts": order.FailedPaymentCount})
+	c.JSON(http.StatusOK, gin.H{"failed_attempts": checkout.FailedPaymentCount})
 }
@@ -0,0 +1,185 @@
+package controllers
+
+import (
+	"errors"
+	"fmt"
+	database "knowledgeMart/config"
+	"knowledgeMart/mailer"
+	"knowledgeMart/models"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const (
+	defaultPaymentTimeoutMinutes = 30
+	paymentExpiryInterval        = time.Minute
+)
+
+var ErrCheckoutExpired = errors.New("checkout expired before the payment was completed")
+
+// PaymentTimeout is how long a gateway checkout may stay unpaid before its
+// orders are canceled, configured in minutes through PAYMENT_TIMEOUT_MINUTES.
+func PaymentTimeout() time.Duration {
+	minutes, err := strconv.Atoi(os.Getenv("PAYMENT_TIMEOUT_MINUTES"))
+	if err != nil || minutes <= 0 {
+		minutes = defaultPaymentTimeoutMinutes
+	}
+	return time.Duration(minutes) * time.Minute
+}
+
+// StartPaymentExpiryScheduler periodically expires unpaid gateway checkouts
+// for as long as the server runs.
+func StartPaymentExpiryScheduler() {
+	go func() {
+		ticker := time.NewTicker(paymentExpiryInterval)
+		defer ticker.Stop()
+
+		for range ticker.C {
+			ExpireUnpaidCheckouts()
+		}
+	}()
+}
+
+// ExpireUnpaidCheckouts cancels the orders of gateway checkouts that were not
+// paid within the payment timeout, and of those that ran out of payment
+// attempts, releasing their stock and coupon.
+func ExpireUnpaidCheckouts() {
+	var checkoutIDs []uint
+	if err := database.DB.Model(&models.Checkout{}).
+		Where("payment_method = ?", models.Razorpay).
+		Where("(payment_status = ? AND created_at < ?) OR payment_status = ?",
+			models.OrderStatusPending, time.Now().Add(-PaymentTimeout()), models.PaymentStatusFailed).
+		Pluck("checkout_id", &checkoutIDs).Error; err != nil {
+		log.Printf("failed to find unpaid checkouts: %v", err)
+		return
+	}
+
+	for _, checkoutID := range checkoutIDs {
+		if err := expireCheckout(checkoutID); err != nil {
+			log.Printf("failed to expire checkout %d: %v", checkoutID, err)
+		}
+	}
+}
+
+func expireCheckout(checkoutID uint) error {
+	tx := database.DB.Begin()
+
+	var checkout models.Checkout
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE", Options: "SKIP LOCKED"}).
+		Where("checkout_id = ?", checkoutID).
+		First(&checkout).Error; err != nil {
+		tx.Rollback()
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			// locked by a payment being confirmed right now
+			return nil
+		}
+		return err
+	}
+
+	if checkout.PaymentStatus != models.OrderStatusPending && checkout.PaymentStatus != models.PaymentStatusFailed {
+		tx.Rollback()
+		return nil
+	}
+
+	actor := OrderActor{Role: models.ActorSystem}
+	reason := "payment not completed in time"
+	if checkout.PaymentStatus == models.PaymentStatusFailed {
+		reason = "payment failed too many times"
+	}
+
+	var orders []models.Order
+	if err := tx.Where("checkout_id = ?", checkout.CheckoutID).Find(&orders).Error; err != nil {
+		tx.Rollback()
+		return fmt.Errorf("failed to retrieve orders: %w", err)
+	}
+
+	orderIDs := make([]string, 0, len(orders))
+	for i := range orders {
+		if err := cancelUnpaidOrder(tx, &orders[i], actor, reason); err != nil {
+			tx.Rollback()
+			return err
+		}
+		orderIDs = append(orderIDs, strconv.Itoa(int(orders[i].OrderID)))
+	}
+
+	if checkout.CouponCode != "" {
+		if err := tx.Model(&models.CouponUsage{}).
+			Where("user_id = ? AND coupon_code = ? AND usage_count > 0", checkout.UserID, checkout.CouponCode).
+			Update("usage_count", gorm.Expr("usage_count - 1")).Error; err != nil {
+			tx.Rollback()
+			return fmt.Errorf("failed to release coupon usage: %w", err)
+		}
+	}
+
+	if err := tx.Model(&models.Payment{}).
+		Where("checkout_id = ? AND payment_status = ?", checkout.CheckoutID, models.OnlinePaymentPending).
+		Update("payment_status", models.PaymentStatusCanceled).Error; err != nil {
+		tx.Rollback()
+		return fmt.Errorf("failed to update payment records: %w", err)
+	}
+
+	if err := tx.Model(&checkout).Update("payment_status", models.PaymentStatusCanceled).Error; err != nil {
+		tx.Rollback()
+		return fmt.Errorf("failed to update checkout: %w", err)
+	}
+
+	queueUserEmail(tx, checkout.UserID, mailer.EventPaymentExpired, map[string]interface{}{
+		"OrderIDs": strings.Join(orderIDs, ", "),
+	})
+
+	return tx.Commit().Error
+}
+
+func cancelUnpaidOrder(tx *gorm.DB, order *models.Order, actor OrderActor, reason string) error {
+	var items []models.OrderItem
+	if err := tx.Where("order_id = ?", order.OrderID).Find(&items).Error; err != nil {
+		return fmt.Errorf("failed to retrieve order items: %w", err)
+	}
+
+	for i := range items {
+		if items[i].Status == models.OrderStatusCanceled {
+			continue
+		}
+		if err := TransitionOrderItemStatus(tx, &items[i], models.OrderStatusCanceled, actor, reason); err != nil {
+			return err
+		}
+		if err := ReleaseProductStock(tx, items[i].ProductID, items[i].Quantity); err != nil {
+			return err
+		}
+	}
+
+	if order.Status != models.OrderStatusCanceled {
+		if err := TransitionOrderStatus(tx, order, models.OrderStatusCanceled, actor, reason); err != nil {
+			return err
+		}
+	}
+
+	if err := tx.Model(&models.Order{}).Where("order_id = ?", order.OrderID).Update("payment_status", models.PaymentStatusCanceled).Error; err != nil {
+		return fmt.Errorf("failed to update order payment status: %w", err)
+	}
+	order.PaymentStatus = models.PaymentStatusCanceled
+
+	return nil
+}
+
+// refundExpiredPayment queues the refund of a payment that was captured after
+// what it paid for had already expired, such as a checkout whose orders are
+// gone. The gateway is called once tx commits; paymentID is the payment record
+// it belongs to, if there is one.
+func refundExpiredPayment(tx *gorm.DB, userID, paymentID uint, gateway, gatewayPaymentID string, amount int64, reason string) error {
+	refund := models.Refund{
+		UserID:           userID,
+		PaymentID:        paymentID,
+		Amount:           float64(amount) / 100,
+		Gateway:          gateway,
+		GatewayPaymentID: gatewayPaymentID,
+		Reason:           reason,
+	}
+	return QueueGatewayRefund(tx, &refund)
+}
@@ -0,0 +1,666 @@
+package controllers
+
+import (
+	"errors"
+	"fmt"
+	database "knowledgeMart/config"
+	"knowledgeMart/models"
+	"knowledgeMart/utils"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-playground/validator/v10"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const defaultPayoutMinimumAmount = 500
+
+// PayoutMinimumAmount is the smallest withdrawal a seller may request,
+// configured through PAYOUT_MINIMUM_AMOUNT.
+func PayoutMinimumAmount() float64 {
+	amount, err := strconv.ParseFloat(os.Getenv("PAYOUT_MINIMUM_AMOUNT"), 64)
+	if err != nil || amount <= 0 {
+		amount = defaultPayoutMinimumAmount
+	}
+	return amount
+}
+
+// payoutDestination is the masked account a payout is sent to, kept on the
+// payout so later changes to the seller's details do not rewrite history.
+func payoutDestination(account models.PayoutAccount) string {
+	if account.Method == models.PayoutMethodUPI {
+		return account.UPIID
+	}
+	number := account.AccountNumber
+	if len(number) > 4 {
+		number = number[len(number)-4:]
+	}
+	return fmt.Sprintf("%s XXXX%s", account.IFSC, number)
+}
+
+func SavePayoutAccount(c *gin.Context) {
+	sellerID, exists := c.Get("sellerID")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{
+			"status":  "failed",
+			"message": "seller not authorized",
+		})
+		return
+	}
+
+	sellerIDUint, ok := sellerID.(uint)
+	if !ok {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"status":  "failed",
+			"message": "failed to retrieve seller information",
+		})
+		return
+	}
+
+	var request models.PayoutAccountRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"status":  "failed",
+			"message": "failed to process the incoming request",
+		})
+		return
+	}
+
+	validate := validator.New()
+	if err := validate.Struct(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"status":  "failed",
+			"message": err.Error(),
+		})
+		return
+	}
+
+	account := models.PayoutAccount{
+		SellerID:          sellerIDUint,
+		Method:            request.Method,
+		AccountHolderName: request.AccountHolderName,
+	}
+	if request.Method == models.PayoutMethodBank {
+		account.AccountNumber = request.AccountNumber
+		account.IFSC = request.IFSC
+	} else {
+		account.UPIID = request.UPIID
+	}
+
+	if err := database.DB.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "seller_id"}},
+		DoUpdates: clause.AssignmentColumns([]string{"method", "account_holder_name", "account_number", "ifsc", "upi_id", "updated_at"}),
+	}).Create(&account).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"status":  "failed",
+			"message": "failed to save payout account",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"status":  "success",
+		"message": "payout account saved successfully",
+		"data": gin.H{
+			"method":      account.Method,
+			"destination": payoutDestination(account),
+		},
+	})
+}
+
+func GetPayoutAccount(c *gin.Context) {
+	sellerID, exists := c.Get("sellerID")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{
+			"status":  "failed",
+			"message": "seller not authorized",
+		})
+		return
+	}
+
+	sellerIDUint, ok := sellerID.(uint)
+	if !ok {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"status":  "failed",
+			"message": "failed to retrieve seller information",
+		})
+		return
+	}
+
+	var account models.PayoutAccount
+	if err := database.DB.Where("seller_id = ?", sellerIDUint).First(&account).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{
+				"status":  "failed",
+				"message": "no payout account registered",
+			})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"status":  "failed",
+			"message": "failed to retrieve payout account",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"status":  "success",
+		"message": "successfully retrieved payout account",
+		"data": gin.H{
+			"method":              account.Method,
+			"account_holder_name": account.AccountHolderName,
+			"destination":         payoutDestination(account),
+			"minimum_withdrawal":  PayoutMinimumAmount(),
+		},
+	})
+}
+
+// RequestWithdrawal moves the requested amount out of the seller's wallet into
+// payout clearing straight away, so it cannot be spent twice while the payout
+// waits for an admin.
+func RequestWithdrawal(c *gin.Context) {
+	sellerID, exists := c.Get("sellerID")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{
+			"status":  "failed",
+			"message": "seller not authorized",
+		})
+		return
+	}
+
+	sellerIDUint, ok := sellerID.(uint)
+	if !ok {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"status":  "failed",
+			"message": "failed to retrieve seller information",
+		})
+		return
+	}
+
+	var request models.WithdrawalRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"status":  "failed",
+			"message": "failed to process the incoming request",
+		})
+		return
+	}
+
+	validate := validator.New()
+	if err := validate.Struct(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"status":  "failed",
+			"message": err.Error(),
+		})
+		return
+	}
+
+	amount := RoundDecimalValue(request.Amount)
+	if minimum := PayoutMinimumAmount(); amount < minimum {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"status":  "failed",
+			"message": fmt.Sprintf("minimum withdrawal amount is %.2f", minimum),
+		})
+		return
+	}
+
+	var account models.PayoutAccount
+	if err := database.DB.Where("seller_id = ?", sellerIDUint).First(&account).Error; err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"status":  "failed",
+			"message": "register a payout account before requesting a withdrawal",
+		})
+		return
+	}
+
+	tx := database.DB.Begin()
+
+	balance, err := LedgerBalance(tx, SellerWalletAccount(sellerIDUint))
+	if err != nil {
+		tx.Rollback()
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"status":  "failed",
+			"message": "failed to retrieve wallet balance",
+		})
+		return
+	}
+
+	if balance < amount {
+		tx.Rollback()
+		c.JSON(http.StatusBadRequest, gin.H{
+			"status":  "failed",
+			"message": fmt.Sprintf("insufficient wallet balance, available %.2f", balance),
+		})
+		return
+	}
+
+	payout := models.Payout{
+		SellerID:    sellerIDUint,
+		Amount:      amount,
+		Status:      models.PayoutStatusRequested,
+		Method:      account.Method,
+		Destination: payoutDestination(account),
+	}
+	if err := tx.Create(&payout).Error; err != nil {
+		tx.Rollback()
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"status":  "failed",
+			"message": "failed to create payout request",
+		})
+		return
+	}
+
+	if _, err := PostJournalEntry(tx, fmt.Sprintf("PAYOUT_%d", payout.ID), "Withdrawal requested",
+		LedgerLine{Account: SellerWalletAccount(sellerIDUint), Amount: -amount},
+		LedgerLine{Account: PlatformAccount(models.LedgerPayoutClearing), Amount: amount},
+	); err != nil {
+		tx.Rollback()
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"status":  "failed",
+			"message": "failed to debit seller wallet",
+		})
+		return
+	}
+
+	if err := recordSellerWalletTransaction(tx, payout.SellerID, 0, models.WalletOutgoing, models.WalletEntryAvailable, payout.Amount, "Withdrawal requested"); err != nil {
+		tx.Rollback()
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"status":  "failed",
+			"message": err.Error(),
+		})
+		return
+	}
+
+	if err := tx.Commit().Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"status":  "failed",
+			"message": "failed to commit transaction",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"status":  "success",
+		"message": "withdrawal requested successfully",
+		"data": gin.H{
+			"payout": payout,
+		},
+	})
+}
+
+func GetSellerPayouts(c *gin.Context) {
+	sellerID, exists := c.Get("sellerID")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{
+			"status":  "failed",
+			"message": "seller not authorized",
+		})
+		return
+	}
+
+	sellerIDUint, ok := sellerID.(uint)
+	if !ok {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"status":  "failed",
+			"message": "failed to retrieve seller information",
+		})
+		return
+	}
+
+	listPayouts(c, database.DB.Model(&models.Payout{}).Where("seller_id = ?", sellerIDUint))
+}
+
+func AdminListPayouts(c *gin.Context) {
+	adminID, exists := c.Get("adminID")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{
+			"status":  "failed",
+			"message": "not authorized ",
+		})
+		return
+	}
+
+	if _, ok := adminID.(uint); !ok {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"status":  "failed",
+			"message": "failed to retrieve admin information",
+		})
+		return
+	}
+
+	query := database.DB.Model(&models.Payout{})
+	if sellerID := c.Query("seller_id"); sellerID != "" {
+		query = query.Where("seller_id = ?", sellerID)
+	}
+	if batchID := c.Query("batch_id"); batchID != "" {
+		query = query.Where("batch_id = ?", batchID)
+	}
+
+	listPayouts(c, query)
+}
+
+func listPayouts(c *gin.Context, query *gorm.DB) {
+	pageRequest, err := utils.ParsePageRequest(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"status":  "failed",
+			"message": err.Error(),
+		})
+		return
+	}
+
+	if status := c.Query("status"); status != "" {
+		query = query.Where("status = ?", status)
+	}
+
+	totalCount, err := pageRequest.Count(query)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"status":  "failed",
+			"message": "failed to count payouts",
+		})
+		return
+	}
+
+	var lastID uint
+	query, err = pageRequest.Apply(query, "id", true, &lastID)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"status":  "failed",
+			"message": err.Error(),
+		})
+		return
+	}
+
+	var payouts []models.Payout
+	if err := query.Find(&payouts).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"status":  "failed",
+			"message": "failed to retrieve payouts",
+		})
+		return
+	}
+
+	hasMore := pageRequest.HasMore(len(payouts), totalCount)
+	if pageRequest.CursorMode && hasMore {
+		payouts = payouts[:pageRequest.Limit]
+	}
+
+	var nextCursor string
+	if len(payouts) > 0 {
+		nextCursor = utils.EncodeCursor(payouts[len(payouts)-1].ID)
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"status":  "success",
+		"message": "successfully retrieved payouts",
+		"data": gin.H{
+			"payouts": payouts,
+		},
+		"pagination": utils.NewPageInfo(c, pageRequest, totalCount, hasMore, nextCursor),
+	})
+}
+
+// ApprovePayouts groups requested payouts into one batch for the admin to
+// send out. Payouts that are no longer requested are skipped.
+func ApprovePayouts(c *gin.Context) {
+	adminID, exists := c.Get("adminID")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{
+			"status":  "failed",
+			"message": "not authorized ",
+		})
+		return
+	}
+
+	adminIDUint, ok := adminID.(uint)
+	if !ok {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"status":  "failed",
+			"message": "failed to retrieve admin information",
+		})
+		return
+	}
+
+	var request models.ApprovePayoutsRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"status":  "failed",
+			"message": "failed to process the incoming request",
+		})
+		return
+	}
+
+	validate := validator.New()
+	if err := validate.Struct(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"status":  "failed",
+			"message": err.Error(),
+		})
+		return
+	}
+
+	tx := database.DB.Begin()
+
+	var payouts []models.Payout
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+		Where("id IN ? AND status = ?", request.PayoutIDs, models.PayoutStatusRequested).
+		Order("id").
+		Find(&payouts).Error; err != nil {
+		tx.Rollback()
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"status":  "failed",
+			"message": "failed to retrieve payouts",
+		})
+		return
+	}
+
+	if len(payouts) == 0 {
+		tx.Rollback()
+		c.JSON(http.StatusBadRequest, gin.H{
+			"status":  "failed",
+			"message": "none of the given payouts are awaiting approval",
+		})
+		return
+	}
+
+	batch := models.PayoutBatch{AdminID: adminIDUint, PayoutCount: len(payouts)}
+	payoutIDs := make([]uint, 0, len(payouts))
+	for _, payout := range payouts {
+		batch.TotalAmount += payout.Amount
+		payoutIDs = append(payoutIDs, payout.ID)
+	}
+	batch.TotalAmount = RoundDecimalValue(batch.TotalAmount)
+
+	if err := tx.Create(&batch).Error; err != nil {
+		tx.Rollback()
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"status":  "failed",
+			"message": "failed to create payout batch",
+		})
+		return
+	}
+
+	if err := tx.Model(&models.Payout{}).Where("id IN ?", payoutIDs).Updates(map[string]interface{}{
+		"status":   models.PayoutStatusApproved,
+		"batch_id": batch.ID,
+	}).Error; err != nil {
+		tx.Rollback()
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"status":  "failed",
+			"message": "failed to approve payouts",
+		})
+		return
+	}
+
+	if err := tx.Commit().Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"status":  "failed",
+			"message": "failed to commit transaction",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"status":  "success",
+		"message": "payouts approved successfully",
+		"data": gin.H{
+			"batch":      batch,
+			"payout_ids": payoutIDs,
+		},
+	})
+}
+
+// UpdatePayout settles an approved payout once the transfer went through, or
+// gives the money back to the seller's wallet when it failed or the request
+// is rejected.
+func UpdatePayout(c *gin.Context) {
+	adminID, exists := c.Get("adminID")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{
+			"status":  "failed",
+			"message": "not authorized ",
+		})
+		return
+	}
+
+	if _, ok := adminID.(uint); !ok {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"status":  "failed",
+			"message": "failed to retrieve admin information",
+		})
+		return
+	}
+
+	var request models.UpdatePayoutRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"status":  "failed",
+			"message": "failed to process the incoming request",
+		})
+		return
+	}
+
+	validate := validator.New()
+	if err := validate.Struct(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"status":  "failed",
+			"message": err.Error(),
+		})
+		return
+	}
+
+	tx := database.DB.Begin()
+
+	var payout models.Payout
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+		Where("id = ?", request.PayoutID).
+		First(&payout).Error; err != nil {
+		tx.Rollback()
+		c.JSON(http.StatusNotFound, gin.H{
+			"status":  "failed",
+			"message": "payout not found",
+		})
+		return
+	}
+
+	from := models.PayoutStatusApproved
+	if request.Action == "reject" {
+		from = models.PayoutStatusRequested
+	}
+	if payout.Status != from {
+		tx.Rollback()
+		c.JSON(http.StatusBadRequest, gin.H{
+			"status":  "failed",
+			"message": fmt.Sprintf("cannot mark a %s payout as %s", payout.Status, request.Action),
+		})
+		return
+	}
+
+	reference := fmt.Sprintf("PAYOUT_%d", payout.ID)
+	updates := map[string]interface{}{}
+
+	switch request.Action {
+	case models.PayoutStatusProcessed:
+		if _, err := PostJournalEntry(tx, reference, "Withdrawal paid out",
+			LedgerLine{Account: PlatformAccount(models.LedgerPayoutClearing), Amount: -payout.Amount},
+			LedgerLine{Account: PlatformAccount(models.LedgerPayoutsSettled), Amount: payout.Amount},
+		); err != nil {
+			tx.Rollback()
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"status":  "failed",
+				"message": "failed to settle payout",
+			})
+			return
+		}
+		now := time.Now()
+		updates["status"] = models.PayoutStatusProcessed
+		updates["reference"] = request.Reference
+		updates["processed_at"] = &now
+	default:
+		status, walletReason := models.PayoutStatusFailed, "Withdrawal failed, amount returned"
+		if request.Action == "reject" {
+			status, walletReason = models.PayoutStatusRejected, "Withdrawal rejected, amount returned"
+		}
+
+		if _, err := PostJournalEntry(tx, reference, walletReason,
+			LedgerLine{Account: PlatformAccount(models.LedgerPayoutClearing), Amount: -payout.Amount},
+			LedgerLine{Account: SellerWalletAccount(payout.SellerID), Amount: payout.Amount},
+		); err != nil {
+			tx.Rollback()
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"status":  "failed",
+				"message": "failed to return payout to seller wallet",
+			})
+			return
+		}
+
+		if err := recordSellerWalletTransaction(tx, payout.SellerID, 0, models.WalletIncoming, models.WalletEntryAvailable, payout.Amount, walletReason); err != nil {
+			tx.Rollback()
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"status":  "failed",
+				"message": err.Error(),
+			})
+			return
+		}
+		updates["status"] = status
+		updates["failure_reason"] = request.Reason
+	}
+
+	if err := tx.Model(&payout).Updates(updates).Error; err != nil {
+		tx.Rollback()
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"status":  "failed",
+			"message": "failed to update payout",
+		})
+		return
+	}
+
+	if err := tx.Commit().Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"status":  "failed",
+			"message": "failed to commit transaction",
+		})
+		return
+	}
+
+	if err := database.DB.Where("id = ?", payout.ID).First(&payout).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"status":  "failed",
+			"message": "payout updated but could not be reloaded",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"status":  "success",
+		"message": "payout updated successfully",
+		"data": gin.H{
+			"payout": payout,
+		},
+	})
+}
@@ -1,6 +1,7 @@
 package controllers
 
 import (
+	"fmt"
 	database "knowledgeMart/config"
 	"knowledgeMart/models"
 	"net/http"
@@ -8,6 +9,8 @@ import (
 
 	"github.com/gin-gonic/gin"
 	"github.com/go-playground/validator/v10"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
 func AddProduct(c *gin.Context) {
@@ -85,15 +88,21 @@ func AddProduct(c *gin.Context) {
 
 	finalAmount := calculateFinalAmount(request.OfferAmount, category.OfferPercentage)
 
+	stockQuantity := request.StockQuantity
+	if stockQuantity == 0 {
+		stockQuantity = 1
+	}
+
 	newProduct := models.Product{
-		SellerID:     sellerID.(uint),
-		CategoryID:   request.CategoryID,
-		Name:         request.Name,
-		Description:  request.Description,
-		Price:        request.Price,
-		OfferAmount:  request.OfferAmount,
-		Image:        request.Image,
-		Availability: true,
+		SellerID:      sellerID.(uint),
+		CategoryID:    request.CategoryID,
+		Name:          request.Name,
+		Description:   request.Description,
+		Price:         request.Price,
+		OfferAmount:   request.OfferAmount,
+		Image:         request.Image,
+		Availability:  true,
+		StockQuantity: stockQuantity,
 	}
 	if err := database.DB.Create(&newProduct).Error; err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{
@@ -107,16 +116,17 @@ func AddProduct(c *gin.Context) {
 		"status":  "success",
 		"message": "successfully added new product",
 		"data": gin.H{
-			"id":           newProduct.ID,
-			"product_name": newProduct.Name,
-			"category_id":  newProduct.CategoryID,
-			"seller_id":    newProduct.SellerID,
-			"describtion":  newProduct.Description,
-			"price":        newProduct.Price,
-			"offer_amount": newProduct.OfferAmount,
-			"final_amount": finalAmount,
-			"image":        newProduct.Image,
-			"availability": newProduct.Availability,
+			"id":             newProduct.ID,
+			"product_name":   newProduct.Name,
+			"category_id":    newProduct.CategoryID,
+			"seller_id":      newProduct.SellerID,
+			"describtion":    newProduct.Description,
+			"price":          newProduct.Price,
+			"offer_amount":   newProduct.OfferAmount,
+			"final_amount":   finalAmount,
+			"image":          newProduct.Image,
+			"availability":   newProduct.Availability,
+			"stock_quantity": newProduct.StockQuantity,
 		},
 	})
 }
@@ -225,8 +235,23 @@ func EditProduct(c *gin.Context) {
 		existingProduct.Image = Request.Image
 	}
 
+	if Request.StockQuantity != nil {
+		existingProduct.StockQuantity = *Request.StockQuantity
+		existingProduct.Availability = existingProduct.StockQuantity > 0
+		existingProduct.SoldOut = existingProduct.StockQuantity == 0
+	}
+
 	if Request.Availability != nil {
 		existingProduct.Availability = *Request.Availability
+		existingProduct.SoldOut = false
+	}
+
+	if existingProduct.Availability && existingProduct.StockQuantity == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"status":  "failed",
+			"message": "product with no stock cannot be marked as available",
+		})
+		return
 	}
 
 	if existingProduct.OfferAmount > existingProduct.Price {
@@ -258,18 +283,31 @@ func EditProduct(c *gin.Context) {
 		return
 	}
 
+	if err := database.DB.Model(&existingProduct).Updates(map[string]interface{}{
+		"stock_quantity": existingProduct.StockQuantity,
+		"availability":   existingProduct.Availability,
+		"sold_out":       existingProduct.SoldOut,
+	}).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"status":  "failed",
+			"message": "failed to update product stock",
+		})
+		return
+	}
+
 	c.JSON(http.StatusOK, gin.H{
 		"status":  "success",
 		"message": "successfully updated product information",
 		"data": gin.H{
-			"id":           existingProduct.ID,
-			"name":         existingProduct.Name,
-			"description":  existingProduct.Description,
-			"price":        existingProduct.Price,
-			"offer_amount": existingProduct.OfferAmount,
-			"image":        existingProduct.Image,
-			"availability": existingProduct.Availability,
-			"categoryID":   existingProduct.CategoryID,
+			"id":             existingProduct.ID,
+			"name":           existingProduct.Name,
+			"description":    existingProduct.Description,
+			"price":          existingProduct.Price,
+			"offer_amount":   existingProduct.OfferAmount,
+			"image":          existingProduct.Image,
+			"availability":   existingProduct.Availability,
+			"stock_quantity": existingProduct.StockQuantity,
+			"categoryID":     existingProduct.CategoryID,
 		},
 	})
 }
@@ -372,19 +410,35 @@ func ListProductBySeller(c *gin.Context) {
 		return
 	}
 
+	productIDs := make([]uint, 0, len(products))
+	for _, product := range products {
+		productIDs = append(productIDs, product.ID)
+	}
+
+	histograms, err := ProductReviewHistograms(productIDs)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"status":  "failed",
+			"message": "failed to retrieve product ratings",
+		})
+		return
+	}
+
 	var productResponse []models.ProductResponse
 
 	for _, product := range products {
 		productResponse = append(productResponse, models.ProductResponse{
-			ID:           product.ID,
-			Name:         product.Name,
-			Price:        product.Price,
-			OfferAmount:  product.OfferAmount,
-			Description:  product.Description,
-			Image:        product.Image,
-			Availability: product.Availability,
-			CategoryID:   product.CategoryID,
-			SellerID:     product.SellerID,
+			ID:            product.ID,
+			Name:          product.Name,
+			Price:         product.Price,
+			OfferAmount:   product.OfferAmount,
+			Description:   product.Description,
+			Image:         product.Image,
+			Availability:  product.Availability,
+			StockQuantity: product.StockQuantity,
+			CategoryID:    product.CategoryID,
+			SellerID:      product.SellerID,
+			ReviewSummary: NewReviewSummary(product, histograms[product.ID]),
 		})
 	}
 
@@ -397,6 +451,48 @@ func ListProductBySeller(c *gin.Context) {
 	})
 }
 
+func ReserveProductStock(tx *gorm.DB, productID uint, quantity uint) error {
+	var product models.Product
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("id = ?", productID).First(&product).Error; err != nil {
+		return fmt.Errorf("failed to find product with ID %d: %w", productID, err)
+	}
+
+	if !product.Availability || product.StockQuantity < quantity {
+		return fmt.Errorf("%s is out of stock", product.Name)
+	}
+
+	product.StockQuantity -= quantity
+	if err := tx.Model(&models.Product{}).Where("id = ?", productID).Updates(map[string]interface{}{
+		"stock_quantity": product.StockQuantity,
+		"availability":   product.StockQuantity > 0,
+		"sold_out":       product.StockQuantity == 0,
+	}).Error; err != nil {
+		return fmt.Errorf("failed to reserve stock for product ID %d: %w", productID, err)
+	}
+
+	return nil
+}
+
+func ReleaseProductStock(tx *gorm.DB, productID uint, quantity uint) error {
+	var product models.Product
+	if err := tx.Unscoped().Clauses(clause.Locking{Strength: "UPDATE"}).Where("id = ?", productID).First(&product).Error; err != nil {
+		return fmt.Errorf("failed to find product with ID %d: %w", productID, err)
+	}
+
+	// a product the seller switched off by hand stays unavailable, only a sold out one comes back
+	availability := product.Availability || product.SoldOut
+
+	if err := tx.Unscoped().Model(&models.Product{}).Where("id = ?", productID).Updates(map[string]interface{}{
+		"stock_quantity": product.StockQuantity + quantity,
+		"availability":   availability,
+		"sold_out":       false,
+	}).Error; err != nil {
+		return fmt.Errorf("failed to release stock for product ID %d: %w", productID, err)
+	}
+
+	return nil
+}
+
 func SellerIdbyProductId(ProductId uint) uint {
 	var Product models.Product
 	if err := database.DB.Where("id = ?", ProductId).First(&Product).Error; err != nil {
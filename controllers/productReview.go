@@ -0,0 +1,416 @@
+package controllers
+
+import (
+	"errors"
+	"fmt"
+	database "knowledgeMart/config"
+	"knowledgeMart/models"
+	"knowledgeMart/utils"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-playground/validator/v10"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+func AddProductReview(c *gin.Context) {
+	userID, exists := c.Get("userID")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{
+			"status":  "failed",
+			"message": "user not authorized",
+		})
+		return
+	}
+
+	userIDUint, ok := userID.(uint)
+	if !ok {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"status":  "failed",
+			"message": "failed to retrieve user information",
+		})
+		return
+	}
+
+	var request models.AddProductReviewRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"status":  "failed",
+			"message": "failed to process the incoming request",
+		})
+		return
+	}
+
+	validate := validator.New()
+	if err := validate.Struct(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"status":  "failed",
+			"message": err.Error(),
+		})
+		return
+	}
+
+	var orderItem models.OrderItem
+	if err := database.DB.Where("user_id = ? AND product_id = ? AND status = ?", userIDUint, request.ProductID, models.OrderStatusDelivered).
+		Order("order_item_id DESC").
+		First(&orderItem).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusForbidden, gin.H{
+				"status":  "failed",
+				"message": "only buyers with a delivered order for this product can review it",
+			})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"status":  "failed",
+			"message": "failed to verify the purchase",
+		})
+		return
+	}
+
+	var existing models.ProductReview
+	if err := database.DB.Where("user_id = ? AND product_id = ?", userIDUint, request.ProductID).First(&existing).Error; err == nil {
+		c.JSON(http.StatusConflict, gin.H{
+			"status":  "failed",
+			"message": "you have already reviewed this product",
+		})
+		return
+	}
+
+	review := models.ProductReview{
+		ProductID:        request.ProductID,
+		UserID:           userIDUint,
+		OrderItemID:      orderItem.OrderItemID,
+		Rating:           request.Rating,
+		Title:            request.Title,
+		Body:             request.Body,
+		Images:           request.Images,
+		VerifiedPurchase: true,
+	}
+
+	tx := database.DB.Begin()
+
+	if err := tx.Create(&review).Error; err != nil {
+		tx.Rollback()
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"status":  "failed",
+			"message": "failed to save review",
+		})
+		return
+	}
+
+	if err := UpdateProductReviewSummary(tx, request.ProductID); err != nil {
+		tx.Rollback()
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"status":  "failed",
+			"message": err.Error(),
+		})
+		return
+	}
+
+	if err := tx.Commit().Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"status":  "failed",
+			"message": "failed to commit transaction",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"status":  "success",
+		"message": "review submitted successfully",
+		"data": gin.H{
+			"review": review,
+		},
+	})
+}
+
+func GetProductReviews(c *gin.Context) {
+	productID := c.Query("product_id")
+	if productID == "" {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"status":  "failed",
+			"message": "product_id is required",
+		})
+		return
+	}
+
+	var product models.Product
+	if err := database.DB.Where("id = ?", productID).First(&product).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{
+			"status":  "failed",
+			"message": "product not found",
+		})
+		return
+	}
+
+	pageRequest, err := utils.ParsePageRequest(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"status":  "failed",
+			"message": err.Error(),
+		})
+		return
+	}
+
+	query := database.DB.Model(&models.ProductReview{}).Where("product_id = ?", product.ID)
+
+	if rating := c.Query("rating"); rating != "" {
+		ratingUint, err := strconv.ParseUint(rating, 10, 64)
+		if err != nil || ratingUint < 1 || ratingUint > 5 {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"status":  "failed",
+				"message": "rating must be between 1 and 5",
+			})
+			return
+		}
+		query = query.Where("rating = ?", ratingUint)
+	}
+
+	totalCount, err := pageRequest.Count(query)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"status":  "failed",
+			"message": "failed to count reviews",
+		})
+		return
+	}
+
+	var lastID uint
+	query, err = pageRequest.Apply(query, "id", true, &lastID)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"status":  "failed",
+			"message": err.Error(),
+		})
+		return
+	}
+
+	var reviews []models.ProductReview
+	if err := query.Preload("User").Find(&reviews).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"status":  "failed",
+			"message": "failed to retrieve reviews",
+		})
+		return
+	}
+
+	hasMore := pageRequest.HasMore(len(reviews), totalCount)
+	if pageRequest.CursorMode && hasMore {
+		reviews = reviews[:pageRequest.Limit]
+	}
+
+	var nextCursor string
+	if len(reviews) > 0 {
+		nextCursor = utils.EncodeCursor(reviews[len(reviews)-1].ID)
+	}
+
+	histograms, err := ProductReviewHistograms([]uint{product.ID})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"status":  "failed",
+			"message": "failed to retrieve rating histogram",
+		})
+		return
+	}
+
+	reviewResponses := []models.ProductReviewResponse{}
+	for _, review := range reviews {
+		reviewResponses = append(reviewResponses, models.ProductReviewResponse{
+			ID:               review.ID,
+			ProductID:        review.ProductID,
+			UserID:           review.UserID,
+			UserName:         review.User.Name,
+			Rating:           review.Rating,
+			Title:            review.Title,
+			Body:             review.Body,
+			Images:           review.Images,
+			VerifiedPurchase: review.VerifiedPurchase,
+			SellerReply:      review.SellerReply,
+			SellerRepliedAt:  review.SellerRepliedAt,
+			CreatedAt:        review.CreatedAt,
+		})
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"status":  "success",
+		"message": "successfully retrieved product reviews",
+		"data": gin.H{
+			"summary": NewReviewSummary(product, histograms[product.ID]),
+			"reviews": reviewResponses,
+		},
+		"pagination": utils.NewPageInfo(c, pageRequest, totalCount, hasMore, nextCursor),
+	})
+}
+
+func ReplyToProductReview(c *gin.Context) {
+	sellerID, exists := c.Get("sellerID")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{
+			"status":  "failed",
+			"message": "seller not authorized",
+		})
+		return
+	}
+
+	sellerIDUint, ok := sellerID.(uint)
+	if !ok {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"status":  "failed",
+			"message": "failed to retrieve seller information",
+		})
+		return
+	}
+
+	var request models.ReplyProductReviewRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"status":  "failed",
+			"message": "failed to process the incoming request",
+		})
+		return
+	}
+
+	validate := validator.New()
+	if err := validate.Struct(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"status":  "failed",
+			"message": err.Error(),
+		})
+		return
+	}
+
+	tx := database.DB.Begin()
+
+	var review models.ProductReview
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("id = ?", request.ReviewID).First(&review).Error; err != nil {
+		tx.Rollback()
+		c.JSON(http.StatusNotFound, gin.H{
+			"status":  "failed",
+			"message": "review not found",
+		})
+		return
+	}
+
+	var product models.Product
+	if err := tx.Unscoped().Where("id = ?", review.ProductID).First(&product).Error; err != nil || product.SellerID != sellerIDUint {
+		tx.Rollback()
+		c.JSON(http.StatusForbidden, gin.H{
+			"status":  "failed",
+			"message": "you can only reply to reviews of your own products",
+		})
+		return
+	}
+
+	if review.SellerReply != "" {
+		tx.Rollback()
+		c.JSON(http.StatusConflict, gin.H{
+			"status":  "failed",
+			"message": "this review already has a reply",
+		})
+		return
+	}
+
+	now := time.Now()
+	if err := tx.Model(&review).Updates(map[string]interface{}{
+		"seller_reply":      request.Reply,
+		"seller_replied_at": now,
+	}).Error; err != nil {
+		tx.Rollback()
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"status":  "failed",
+			"message": "failed to save reply",
+		})
+		return
+	}
+
+	if err := tx.Commit().Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"status":  "failed",
+			"message": "failed to commit transaction",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"status":  "success",
+		"message": "reply added successfully",
+		"data": gin.H{
+			"review_id":         review.ID,
+			"seller_reply":      request.Reply,
+			"seller_replied_at": now,
+		},
+	})
+}
+
+func UpdateProductReviewSummary(tx *gorm.DB, productID uint) error {
+	var summary struct {
+		Average float64
+		Count   uint
+	}
+
+	if err := tx.Model(&models.ProductReview{}).
+		Where("product_id = ?", productID).
+		Select("COALESCE(AVG(rating), 0) AS average, COUNT(*) AS count").
+		Scan(&summary).Error; err != nil {
+		return fmt.Errorf("failed to calculate product rating: %w", err)
+	}
+
+	if err := tx.Model(&models.Product{}).
+		Where("id = ?", productID).
+		Updates(map[string]interface{}{
+			"average_rating": RoundDecimalValue(summary.Average),
+			"review_count":   summary.Count,
+		}).Error; err != nil {
+		return fmt.Errorf("failed to update product rating: %w", err)
+	}
+
+	return nil
+}
+
+// ProductReviewHistograms returns, per product, how many reviews were given
+// for each star rating, using a single grouped query for the whole page.
+func ProductReviewHistograms(productIDs []uint) (map[uint]map[uint]uint64, error) {
+	histograms := make(map[uint]map[uint]uint64)
+	if len(productIDs) == 0 {
+		return histograms, nil
+	}
+
+	var rows []struct {
+		ProductID uint
+		Rating    uint
+		Count     uint64
+	}
+	if err := database.DB.Model(&models.ProductReview{}).
+		Select("product_id, rating, COUNT(*) AS count").
+		Where("product_id IN ?", productIDs).
+		Group("product_id, rating").
+		Scan(&rows).Error; err != nil {
+		return nil, err
+	}
+
+	for _, row := range rows {
+		if histograms[row.ProductID] == nil {
+			histograms[row.ProductID] = make(map[uint]uint64)
+		}
+		histograms[row.ProductID][row.Rating] = row.Count
+	}
+
+	return histograms, nil
+}
+
+func NewReviewSummary(product models.Product, histogram map[uint]uint64) models.ReviewSummary {
+	ratingHistogram := make(map[uint]uint64, 5)
+	for rating := uint(1); rating <= 5; rating++ {
+		ratingHistogram[rating] = histogram[rating]
+	}
+
+	return models.ReviewSummary{
+		AverageRating:   product.AverageRating,
+		ReviewCount:     product.ReviewCount,
+		RatingHistogram: ratingHistogram,
+	}
+}
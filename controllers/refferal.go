@@ -2,11 +2,9 @@ package controllers
 
 import (
 	"errors"
-	"fmt"
 	"gorm.io/gorm"
 	database "knowledgeMart/config"
 	"knowledgeMart/models"
-	"time"
 )
 
 // func ApplyReferralOnCart(c *gin.Context) {
@@ -193,45 +191,22 @@ func GetReferralOffer(userID uint, refCode string) (bool, string) {
 	if currentUser.ReferralCode == refCode {
 		return false, "cannot use your own referral code"
 	}
-	currentUser.WalletAmount += 100
-
-	if err := database.DB.Model(&currentUser).Update("wallet_amount", currentUser.WalletAmount).Error; err != nil {
-		return false, "failed to update wallet amount"
-	}
-
-	newUserWallet := models.UserWallet{
-		WalletPaymentID: fmt.Sprintf("WALLET_%d", time.Now().Unix()),
-		UserID:          currentUser.ID,
-		Type:            "incoming",
-		Amount:          100,
-		CurrentBalance:  currentUser.WalletAmount,
-		Reason:          "Referral bonus for signing up with a referral code",
-	}
-	if err := database.DB.Create(&newUserWallet).Error; err != nil {
-		return false, "failed to log wallet transaction"
-	}
 
 	var referredByUser models.User
 	if err := database.DB.Where("referral_code = ?", refCode).First(&referredByUser).Error; err != nil {
 		return false, "invalid referral code"
 	}
 
-	referredByUser.WalletAmount += 100
+	tx := database.DB.Begin()
 
-	if err := database.DB.Model(&referredByUser).Update("wallet_amount", referredByUser.WalletAmount).Error; err != nil {
+	if err := CreditUserWallet(tx, currentUser.ID, "", 100, "Referral bonus for signing up with a referral code", PlatformAccount(models.LedgerPromotions)); err != nil {
+		tx.Rollback()
 		return false, "failed to update wallet amount"
 	}
 
-	referrerWalletTransaction := models.UserWallet{
-		WalletPaymentID: fmt.Sprintf("WALLET_%d", time.Now().Unix()),
-		UserID:          referredByUser.ID,
-		Type:            "incoming",
-		Amount:          100,
-		CurrentBalance:  referredByUser.WalletAmount,
-		Reason:          "Referral bonus for referring a new user",
-	}
-	if err := database.DB.Create(&referrerWalletTransaction).Error; err != nil {
-		return false, "failed to log referrer's wallet transaction"
+	if err := CreditUserWallet(tx, referredByUser.ID, "", 100, "Referral bonus for referring a new user", PlatformAccount(models.LedgerPromotions)); err != nil {
+		tx.Rollback()
+		return false, "failed to update wallet amount"
 	}
 
 	newReferralHistory := models.UserReferralHistory{
@@ -241,9 +216,14 @@ func GetReferralOffer(userID uint, refCode string) (bool, string) {
 		ReferClaimed: true,
 	}
 
-	if err := database.DB.Create(&newReferralHistory).Error; err != nil {
+	if err := tx.Create(&newReferralHistory).Error; err != nil {
+		tx.Rollback()
 		return false, "referral history creation failed"
 	}
 
+	if err := tx.Commit().Error; err != nil {
+		return false, "failed to commit transaction"
+	}
+
 	return true, ""
 }
@@ -0,0 +1,451 @@
+package controllers
+
+import (
+	"errors"
+	"fmt"
+	database "knowledgeMart/config"
+	"knowledgeMart/mailer"
+	"knowledgeMart/models"
+	"knowledgeMart/payments"
+	"knowledgeMart/utils"
+	"log"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const (
+	refundQueueInterval     = 30 * time.Second
+	refundQueueBatchSize    = 50
+	refundMaxAttempts       = 5
+	refundRetryInitialDelay = time.Minute
+)
+
+// IssueRefund returns amount to the buyer of order and records it. A refund
+// to source is queued for the gateway the order was paid with and sent once
+// the surrounding transaction commits; when the order was not paid through a
+// gateway the buyer's wallet is credited instead and the reason is kept on
+// the record.
+//
+// The money is taken from the from account, the seller's wallet for a normal
+// cancellation or return.
+func IssueRefund(tx *gorm.DB, order models.Order, userID uint, amount float64, reason, destination string, from LedgerAccountRef) (models.Refund, error) {
+	orderIDStr := strconv.Itoa(int(order.OrderID))
+	refund := models.Refund{
+		OrderID:     order.OrderID,
+		UserID:      userID,
+		Amount:      RoundDecimalValue(amount),
+		Destination: models.RefundDestinationWallet,
+		Status:      models.RefundStatusProcessed,
+		Reason:      reason,
+	}
+
+	if destination == models.RefundDestinationSource && amount > 0 {
+		sourceRefund, err := sourceRefundFor(tx, order, refund)
+		if err == nil {
+			if _, err := PostJournalEntry(tx, fmt.Sprintf("REFUND_ORDER_%d", order.OrderID), reason,
+				LedgerLine{Account: from, Amount: -sourceRefund.Amount},
+				LedgerLine{Account: PlatformAccount(models.LedgerGatewayClearing), Amount: sourceRefund.Amount},
+			); err != nil {
+				return models.Refund{}, err
+			}
+			if err := QueueGatewayRefund(tx, &sourceRefund); err != nil {
+				return models.Refund{}, err
+			}
+			notifyRefund(tx, sourceRefund)
+			return sourceRefund, nil
+		}
+
+		log.Printf("refund to source for order %d not possible, crediting wallet instead: %v", order.OrderID, err)
+		refund.PaymentID = sourceRefund.PaymentID
+		refund.Gateway = sourceRefund.Gateway
+		refund.FailureReason = err.Error()
+	}
+
+	if err := CreditUserWallet(tx, userID, orderIDStr, amount, reason, from); err != nil {
+		return models.Refund{}, err
+	}
+
+	if err := tx.Create(&refund).Error; err != nil {
+		return models.Refund{}, fmt.Errorf("failed to create refund record: %w", err)
+	}
+
+	notifyRefund(tx, refund)
+	return refund, nil
+}
+
+func notifyRefund(tx *gorm.DB, refund models.Refund) {
+	if refund.Amount <= 0 {
+		return
+	}
+	destination := "wallet"
+	if refund.Destination == models.RefundDestinationSource {
+		destination = "original payment method"
+	}
+	queueUserEmail(tx, refund.UserID, mailer.EventOrderRefunded, map[string]interface{}{
+		"OrderID":     refund.OrderID,
+		"Amount":      refund.Amount,
+		"Destination": destination,
+		"Reason":      refund.Reason,
+	})
+}
+
+// sourceRefundFor finds the captured gateway payment of order the refund can
+// go back to. The amount refunded to source can never exceed what the order
+// was paid.
+func sourceRefundFor(tx *gorm.DB, order models.Order, refund models.Refund) (models.Refund, error) {
+	if order.PaymentMethod != models.Razorpay {
+		return refund, fmt.Errorf("order was paid by %s, which cannot be refunded to source", order.PaymentMethod)
+	}
+
+	var payment models.Payment
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+		Where("order_id = ? AND payment_status = ? AND razorpay_payment_id <> ''", strconv.Itoa(int(order.OrderID)), models.PaymentStatusPaid).
+		First(&payment).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return refund, fmt.Errorf("no captured gateway payment found for order %d", order.OrderID)
+		}
+		return refund, fmt.Errorf("failed to retrieve payment: %w", err)
+	}
+	refund.PaymentID = payment.ID
+	refund.Gateway = payment.PaymentGateway
+	refund.GatewayPaymentID = payment.RazorpayPaymentID
+
+	var refunded float64
+	if err := tx.Model(&models.Refund{}).
+		Where("payment_id = ? AND destination = ? AND status <> ?", payment.ID, models.RefundDestinationSource, models.RefundStatusFailed).
+		Select("COALESCE(SUM(amount), 0)").
+		Scan(&refunded).Error; err != nil {
+		return refund, fmt.Errorf("failed to calculate refunded amount: %w", err)
+	}
+	if RoundDecimalValue(refunded+refund.Amount) > RoundDecimalValue(payment.AmountPaid) {
+		return refund, fmt.Errorf("refund exceeds the amount captured for order %d", order.OrderID)
+	}
+
+	return refund, nil
+}
+
+// QueueGatewayRefund stores refund as queued for its gateway on tx, so it is
+// only sent once the surrounding transaction commits. The gateway is never
+// called while the caller's rows are locked.
+func QueueGatewayRefund(tx *gorm.DB, refund *models.Refund) error {
+	refund.Destination = models.RefundDestinationSource
+	refund.Status = models.RefundStatusQueued
+	refund.NextAttemptAt = time.Now()
+	if err := tx.Create(refund).Error; err != nil {
+		return fmt.Errorf("failed to create refund record: %w", err)
+	}
+	return nil
+}
+
+// StartRefundQueueScheduler sends queued refunds to their gateway for as long
+// as the server runs.
+func StartRefundQueueScheduler() {
+	go func() {
+		ticker := time.NewTicker(refundQueueInterval)
+		defer ticker.Stop()
+
+		for {
+			SubmitQueuedRefunds()
+			<-ticker.C
+		}
+	}()
+}
+
+// SubmitQueuedRefunds sends every queued refund that is due to its gateway. A
+// failed call is retried with a doubling delay until refundMaxAttempts, after
+// which the buyer's wallet is credited instead.
+func SubmitQueuedRefunds() {
+	var refundIDs []uint
+	if err := database.DB.Model(&models.Refund{}).
+		Where("status = ? AND next_attempt_at <= ?", models.RefundStatusQueued, time.Now()).
+		Order("next_attempt_at").
+		Limit(refundQueueBatchSize).
+		Pluck("id", &refundIDs).Error; err != nil {
+		log.Printf("failed to find queued refunds: %v", err)
+		return
+	}
+
+	for _, refundID := range refundIDs {
+		if err := submitRefund(refundID); err != nil {
+			log.Printf("failed to submit refund %d: %v", refundID, err)
+		}
+	}
+}
+
+// submitRefund claims the refund by pushing its next attempt out, calls the
+// gateway outside of any transaction and then records the outcome. The refund
+// ID goes to the gateway as the idempotency key, so a retry after a lost
+// response cannot refund twice.
+func submitRefund(refundID uint) error {
+	tx := database.DB.Begin()
+
+	var refund models.Refund
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE", Options: "SKIP LOCKED"}).
+		Where("id = ? AND status = ? AND next_attempt_at <= ?", refundID, models.RefundStatusQueued, time.Now()).
+		First(&refund).Error; err != nil {
+		tx.Rollback()
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			// submitted by another worker in the meantime
+			return nil
+		}
+		return err
+	}
+
+	refund.Attempts++
+	if err := tx.Model(&refund).Updates(map[string]interface{}{
+		"attempts":        refund.Attempts,
+		"next_attempt_at": time.Now().Add(refundRetryInitialDelay << (refund.Attempts - 1)),
+	}).Error; err != nil {
+		tx.Rollback()
+		return fmt.Errorf("failed to claim refund: %w", err)
+	}
+	if err := tx.Commit().Error; err != nil {
+		return err
+	}
+
+	result, refundErr := callGatewayRefund(refund)
+
+	tx = database.DB.Begin()
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+		Where("id = ? AND status = ?", refund.ID, models.RefundStatusQueued).
+		First(&refund).Error; err != nil {
+		tx.Rollback()
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil
+		}
+		return err
+	}
+
+	var err error
+	switch {
+	case refundErr == nil:
+		err = recordGatewayRefund(tx, refund, result)
+	case refund.Attempts >= refundMaxAttempts:
+		err = creditFailedRefund(tx, refund, refundErr.Error())
+	default:
+		err = tx.Model(&refund).Update("failure_reason", refundErr.Error()).Error
+	}
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	if err := tx.Commit().Error; err != nil {
+		return err
+	}
+
+	return refundErr
+}
+
+func callGatewayRefund(refund models.Refund) (payments.RefundResult, error) {
+	provider, err := payments.ProviderFor(refund.Gateway)
+	if err != nil {
+		return payments.RefundResult{}, err
+	}
+
+	notes := map[string]string{
+		"refund_id": strconv.Itoa(int(refund.ID)),
+		"reason":    refund.Reason,
+	}
+	if refund.OrderID != 0 {
+		notes["order_id"] = strconv.Itoa(int(refund.OrderID))
+	}
+
+	return provider.Refund(payments.RefundRequest{
+		PaymentID:      refund.GatewayPaymentID,
+		Amount:         int64(math.Round(refund.Amount * 100)),
+		Notes:          notes,
+		IdempotencyKey: fmt.Sprintf("refund_%d", refund.ID),
+	})
+}
+
+// recordGatewayRefund stores the gateway's answer to a queued refund.
+func recordGatewayRefund(tx *gorm.DB, refund models.Refund, result payments.RefundResult) error {
+	status := models.RefundStatusPending
+	if result.Status == models.RefundStatusProcessed {
+		status = models.RefundStatusProcessed
+	}
+
+	if err := tx.Model(&refund).Updates(map[string]interface{}{
+		"gateway_refund_id": result.ID,
+		"status":            status,
+		"failure_reason":    "",
+	}).Error; err != nil {
+		return fmt.Errorf("failed to update refund: %w", err)
+	}
+
+	if status == models.RefundStatusProcessed {
+		return markPaymentRefunded(tx, refund.PaymentID)
+	}
+	return nil
+}
+
+// creditFailedRefund credits the buyer's wallet with a refund to source the
+// gateway did not make. The money never left the gateway, so it comes back
+// from clearing.
+func creditFailedRefund(tx *gorm.DB, refund models.Refund, failureReason string) error {
+	orderIDStr := ""
+	if refund.OrderID != 0 {
+		orderIDStr = strconv.Itoa(int(refund.OrderID))
+	}
+	if err := CreditUserWallet(tx, refund.UserID, orderIDStr, refund.Amount, refund.Reason, PlatformAccount(models.LedgerGatewayClearing)); err != nil {
+		return err
+	}
+
+	if err := tx.Model(&refund).Updates(map[string]interface{}{
+		"destination":    models.RefundDestinationWallet,
+		"status":         models.RefundStatusProcessed,
+		"failure_reason": failureReason,
+	}).Error; err != nil {
+		return fmt.Errorf("failed to update refund: %w", err)
+	}
+	return nil
+}
+
+// markPaymentRefunded marks the payment refunded once refunds to source have
+// given all of it back.
+func markPaymentRefunded(tx *gorm.DB, paymentID uint) error {
+	if paymentID == 0 {
+		return nil
+	}
+
+	var payment models.Payment
+	if err := tx.Where("id = ?", paymentID).First(&payment).Error; err != nil {
+		return fmt.Errorf("failed to retrieve payment: %w", err)
+	}
+
+	var refunded float64
+	if err := tx.Model(&models.Refund{}).
+		Where("payment_id = ? AND destination = ? AND status = ?", payment.ID, models.RefundDestinationSource, models.RefundStatusProcessed).
+		Select("COALESCE(SUM(amount), 0)").
+		Scan(&refunded).Error; err != nil {
+		return fmt.Errorf("failed to calculate refunded amount: %w", err)
+	}
+
+	if RoundDecimalValue(refunded) >= RoundDecimalValue(payment.AmountPaid) {
+		if err := tx.Model(&payment).Update("payment_status", models.PaymentStatusRefund).Error; err != nil {
+			return fmt.Errorf("failed to update payment status: %w", err)
+		}
+	}
+	return nil
+}
+
+// MarkGatewayRefund applies a refund status reported by the gateway. A failed
+// refund to source is credited to the buyer's wallet so the money is not lost.
+func MarkGatewayRefund(tx *gorm.DB, gatewayRefundID, status, failureReason string) (bool, error) {
+	var refund models.Refund
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+		Where("gateway_refund_id = ?", gatewayRefundID).
+		First(&refund).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return false, nil
+		}
+		return false, fmt.Errorf("failed to retrieve refund: %w", err)
+	}
+
+	if refund.Destination != models.RefundDestinationSource || refund.Status != models.RefundStatusPending {
+		return true, nil
+	}
+
+	if status == models.RefundStatusFailed {
+		return true, creditFailedRefund(tx, refund, failureReason)
+	}
+
+	if err := tx.Model(&refund).Update("status", status).Error; err != nil {
+		return true, fmt.Errorf("failed to update refund: %w", err)
+	}
+
+	if status == models.RefundStatusProcessed {
+		return true, markPaymentRefunded(tx, refund.PaymentID)
+	}
+	return true, nil
+}
+
+func GetUserRefunds(c *gin.Context) {
+	userID, exists := c.Get("userID")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{
+			"status":  "failed",
+			"message": "user not authorized",
+		})
+		return
+	}
+
+	userIDUint, ok := userID.(uint)
+	if !ok {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"status":  "failed",
+			"message": "failed to retrieve user information",
+		})
+		return
+	}
+
+	pageRequest, err := utils.ParsePageRequest(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"status":  "failed",
+			"message": err.Error(),
+		})
+		return
+	}
+
+	query := database.DB.Model(&models.Refund{}).Where("user_id = ?", userIDUint)
+	if orderID := c.Query("order_id"); orderID != "" {
+		query = query.Where("order_id = ?", orderID)
+	}
+	if status := c.Query("status"); status != "" {
+		query = query.Where("status = ?", status)
+	}
+
+	totalCount, err := pageRequest.Count(query)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"status":  "failed",
+			"message": "failed to count refunds",
+		})
+		return
+	}
+
+	var lastID uint
+	query, err = pageRequest.Apply(query, "id", true, &lastID)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"status":  "failed",
+			"message": err.Error(),
+		})
+		return
+	}
+
+	var refunds []models.Refund
+	if err := query.Find(&refunds).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"status":  "failed",
+			"message": "failed to retrieve refunds",
+		})
+		return
+	}
+
+	hasMore := pageRequest.HasMore(len(refunds), totalCount)
+	if pageRequest.CursorMode && hasMore {
+		refunds = refunds[:pageRequest.Limit]
+	}
+
+	var nextCursor string
+	if len(refunds) > 0 {
+		nextCursor = utils.EncodeCursor(refunds[len(refunds)-1].ID)
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"status":  "success",
+		"message": "successfully retrieved refunds",
+		"data": gin.H{
+			"refunds": refunds,
+		},
+		"pagination": utils.NewPageInfo(c, pageRequest, totalCount, hasMore, nextCursor),
+	})
+}
@@ -0,0 +1,73 @@
+package controllers
+
+import (
+	database "knowledgeMart/config"
+	"knowledgeMart/models"
+	"testing"
+)
+
+func TestSubmitQueuedRefund(t *testing.T) {
+	useTestDatabase(t)
+	fake := newFakeRazorpay(t)
+	suffix := uniqueSuffix()
+
+	user := createTestUser(t, suffix)
+	payment := models.Payment{
+		OrderID:           "1",
+		RazorpayOrderID:   "order_" + suffix,
+		RazorpayPaymentID: "pay_" + suffix,
+		PaymentGateway:    models.Razorpay,
+		PaymentStatus:     models.PaymentStatusPaid,
+		AmountPaid:        90,
+	}
+	if err := database.DB.Create(&payment).Error; err != nil {
+		t.Fatalf("failed to create payment: %v", err)
+	}
+
+	refund := models.Refund{
+		OrderID:          1,
+		UserID:           user.ID,
+		PaymentID:        payment.ID,
+		Amount:           90,
+		Gateway:          models.Razorpay,
+		GatewayPaymentID: payment.RazorpayPaymentID,
+		Reason:           "Entire order canceled",
+	}
+	if err := QueueGatewayRefund(database.DB, &refund); err != nil {
+		t.Fatalf("failed to queue refund: %v", err)
+	}
+	if len(fake.refundedPayments()) != 0 {
+		t.Fatalf("gateway was called before the refund was submitted")
+	}
+
+	if err := submitRefund(refund.ID); err != nil {
+		t.Fatalf("submitRefund() error = %v", err)
+	}
+
+	database.DB.First(&refund, refund.ID)
+	if refund.Status != models.RefundStatusProcessed || refund.GatewayRefundID == "" || refund.Attempts != 1 {
+		t.Errorf("refund = %s %q after %d attempts, want processed with a gateway refund ID after 1", refund.Status, refund.GatewayRefundID, refund.Attempts)
+	}
+	database.DB.First(&payment, payment.ID)
+	if payment.PaymentStatus != models.PaymentStatusRefund {
+		t.Errorf("payment status = %q, want %q", payment.PaymentStatus, models.PaymentStatusRefund)
+	}
+
+	// a retry after a lost response must get the same refund back
+	database.DB.Model(&refund).Updates(map[string]interface{}{
+		"status":          models.RefundStatusQueued,
+		"next_attempt_at": refund.CreatedAt,
+	})
+	gatewayRefundID := refund.GatewayRefundID
+	if err := submitRefund(refund.ID); err != nil {
+		t.Fatalf("submitRefund() retry error = %v", err)
+	}
+
+	database.DB.First(&refund, refund.ID)
+	if refund.GatewayRefundID != gatewayRefundID {
+		t.Errorf("retried refund = %q, want %q again", refund.GatewayRefundID, gatewayRefundID)
+	}
+	if refunded := fake.refundedPayments(); len(refunded) != 1 {
+		t.Errorf("gateway refunded %d times, want once", len(refunded))
+	}
+}
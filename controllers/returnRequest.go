@@ -0,0 +1,515 @@
+package controllers
+
+import (
+	"errors"
+	"fmt"
+	database "knowledgeMart/config"
+	"knowledgeMart/models"
+	"knowledgeMart/utils"
+	"math"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-playground/validator/v10"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const defaultReturnWindowDays = 7
+
+// returnRequestActions maps each seller action to the return request status it
+// is allowed from and the status it moves the request to.
+var returnRequestActions = map[string]struct {
+	From string
+	To   string
+}{
+	"approve": {models.ReturnStatusRequested, models.ReturnStatusApproved},
+	"reject":  {models.ReturnStatusRequested, models.ReturnStatusRejected},
+	"pickup":  {models.ReturnStatusApproved, models.ReturnStatusPickedUp},
+	"receive": {models.ReturnStatusPickedUp, models.ReturnStatusReceived},
+}
+
+// ReturnWindow is how long after delivery a buyer may ask for a return,
+// configured in days through RETURN_WINDOW_DAYS.
+func ReturnWindow() time.Duration {
+	days, err := strconv.Atoi(os.Getenv("RETURN_WINDOW_DAYS"))
+	if err != nil || days < 0 {
+		days = defaultReturnWindowDays
+	}
+	return time.Duration(days) * 24 * time.Hour
+}
+
+// OrderItemDeliveredAt returns when the item was first delivered. Deliveries
+// restored by a rejected return do not restart the window, and orders
+// delivered before status history was kept fall back to the order date.
+func OrderItemDeliveredAt(tx *gorm.DB, item models.OrderItem) (time.Time, error) {
+	var history models.OrderStatusHistory
+	err := tx.Where("order_id = ? AND (order_item_id = ? OR order_item_id = 0) AND to_status = ? AND from_status <> ?",
+		item.OrderID, item.OrderItemID, models.OrderStatusDelivered, models.OrderStatusReturnRequested).
+		Order("changed_at ASC").
+		First(&history).Error
+	if err == nil {
+		return history.ChangedAt, nil
+	}
+	if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return time.Time{}, fmt.Errorf("failed to retrieve delivery date: %w", err)
+	}
+
+	var order models.Order
+	if err := tx.Where("order_id = ?", item.OrderID).First(&order).Error; err != nil {
+		return time.Time{}, fmt.Errorf("failed to find order with ID %d: %w", item.OrderID, err)
+	}
+	return order.OrderedAt, nil
+}
+
+func ReturnOrder(c *gin.Context) {
+	userID, exists := c.Get("userID")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{
+			"status":  "failed",
+			"message": "user not authorized",
+		})
+		return
+	}
+
+	userIDUint, ok := userID.(uint)
+	if !ok {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"status":  "failed",
+			"message": "failed to retrieve user information",
+		})
+		return
+	}
+
+	var request models.ReturnOrderRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"status":  "failed",
+			"message": "failed to process the incoming request",
+		})
+		return
+	}
+
+	validate := validator.New()
+	if err := validate.Struct(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"status":  "failed",
+			"message": err.Error(),
+		})
+		return
+	}
+
+	refundTo := request.RefundTo
+	if refundTo == "" {
+		refundTo = models.RefundDestinationWallet
+	}
+
+	var order models.Order
+	if err := database.DB.Where("user_id = ? AND order_id = ?", userIDUint, request.OrderID).First(&order).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{
+			"status":  "failed",
+			"message": "order not found for this user",
+		})
+		return
+	}
+
+	var orderItems []models.OrderItem
+	query := database.DB.Where("order_id = ?", order.OrderID)
+	if request.OrderItemID != 0 {
+		query = query.Where("order_item_id = ?", request.OrderItemID)
+	} else {
+		query = query.Where("status = ?", models.OrderStatusDelivered)
+	}
+	if err := query.Find(&orderItems).Error; err != nil || len(orderItems) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"status":  "failed",
+			"message": "no delivered items to return in this order",
+		})
+		return
+	}
+
+	window := ReturnWindow()
+	for _, orderItem := range orderItems {
+		if orderItem.Status == models.OrderStatusReturnRequested {
+			c.JSON(http.StatusConflict, gin.H{
+				"status":  "failed",
+				"message": "a return has already been requested for this item",
+			})
+			return
+		}
+
+		if !CanTransitionOrderStatus(orderItem.Status, models.OrderStatusReturnRequested) {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"status":  "failed",
+				"message": "item not delivered yet",
+			})
+			return
+		}
+
+		deliveredAt, err := OrderItemDeliveredAt(database.DB, orderItem)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"status":  "failed",
+				"message": err.Error(),
+			})
+			return
+		}
+
+		if time.Since(deliveredAt) > window {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"status":  "failed",
+				"message": fmt.Sprintf("the return window of %d days for this item has closed", int(window.Hours()/24)),
+			})
+			return
+		}
+	}
+
+	actor := OrderActor{Role: models.ActorUser, ID: userIDUint}
+
+	tx := database.DB.Begin()
+
+	var returnRequests []models.ReturnRequest
+	for i := range orderItems {
+		returnRequest := models.ReturnRequest{
+			OrderID:      order.OrderID,
+			OrderItemID:  orderItems[i].OrderItemID,
+			UserID:       userIDUint,
+			SellerID:     orderItems[i].SellerID,
+			Reason:       request.Reason,
+			Images:       request.Images,
+			Status:       models.ReturnStatusRequested,
+			RefundAmount: RoundDecimalValue(orderItems[i].FinalAmount),
+			RefundTo:     refundTo,
+		}
+		if err := tx.Create(&returnRequest).Error; err != nil {
+			tx.Rollback()
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"status":  "failed",
+				"message": "failed to create return request",
+			})
+			return
+		}
+
+		if err := TransitionOrderItemStatus(tx, &orderItems[i], models.OrderStatusReturnRequested, actor, request.Reason); err != nil {
+			tx.Rollback()
+			c.JSON(statusTransitionHTTPCode(err), gin.H{
+				"status":  "failed",
+				"message": "failed to update order item status: " + err.Error(),
+			})
+			return
+		}
+
+		returnRequests = append(returnRequests, returnRequest)
+	}
+
+	if err := tx.Commit().Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"status":  "failed",
+			"message": "failed to commit transaction",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"status":  "success",
+		"message": "return requested, the seller will review it shortly",
+		"data": gin.H{
+			"return_requests": returnRequests,
+		},
+	})
+}
+
+func GetUserReturnRequests(c *gin.Context) {
+	userID, exists := c.Get("userID")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{
+			"status":  "failed",
+			"message": "user not authorized",
+		})
+		return
+	}
+
+	userIDUint, ok := userID.(uint)
+	if !ok {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"status":  "failed",
+			"message": "failed to retrieve user information",
+		})
+		return
+	}
+
+	listReturnRequests(c, database.DB.Model(&models.ReturnRequest{}).Where("user_id = ?", userIDUint))
+}
+
+func GetSellerReturnRequests(c *gin.Context) {
+	sellerID, exists := c.Get("sellerID")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{
+			"status":  "failed",
+			"message": "seller not authorized",
+		})
+		return
+	}
+
+	sellerIDUint, ok := sellerID.(uint)
+	if !ok {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"status":  "failed",
+			"message": "failed to retrieve seller information",
+		})
+		return
+	}
+
+	listReturnRequests(c, database.DB.Model(&models.ReturnRequest{}).Where("seller_id = ?", sellerIDUint))
+}
+
+func listReturnRequests(c *gin.Context, query *gorm.DB) {
+	pageRequest, err := utils.ParsePageRequest(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"status":  "failed",
+			"message": err.Error(),
+		})
+		return
+	}
+
+	if status := c.Query("status"); status != "" {
+		query = query.Where("status = ?", status)
+	}
+
+	totalCount, err := pageRequest.Count(query)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"status":  "failed",
+			"message": "failed to count return requests",
+		})
+		return
+	}
+
+	var lastID uint
+	query, err = pageRequest.Apply(query, "return_request_id", true, &lastID)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"status":  "failed",
+			"message": err.Error(),
+		})
+		return
+	}
+
+	var returnRequests []models.ReturnRequest
+	if err := query.Find(&returnRequests).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"status":  "failed",
+			"message": "failed to retrieve return requests",
+		})
+		return
+	}
+
+	hasMore := pageRequest.HasMore(len(returnRequests), totalCount)
+	if pageRequest.CursorMode && hasMore {
+		returnRequests = returnRequests[:pageRequest.Limit]
+	}
+
+	var nextCursor string
+	if len(returnRequests) > 0 {
+		nextCursor = utils.EncodeCursor(returnRequests[len(returnRequests)-1].ReturnRequestID)
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"status":  "success",
+		"message": "successfully retrieved return requests",
+		"data": gin.H{
+			"return_requests": returnRequests,
+		},
+		"pagination": utils.NewPageInfo(c, pageRequest, totalCount, hasMore, nextCursor),
+	})
+}
+
+func SellerUpdateReturnRequest(c *gin.Context) {
+	sellerID, exists := c.Get("sellerID")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{
+			"status":  "failed",
+			"message": "seller not authorized",
+		})
+		return
+	}
+
+	sellerIDUint, ok := sellerID.(uint)
+	if !ok {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"status":  "failed",
+			"message": "failed to retrieve seller information",
+		})
+		return
+	}
+
+	var request models.UpdateReturnRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"status":  "failed",
+			"message": "failed to process the incoming request",
+		})
+		return
+	}
+
+	validate := validator.New()
+	if err := validate.Struct(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"status":  "failed",
+			"message": err.Error(),
+		})
+		return
+	}
+
+	action := returnRequestActions[request.Action]
+
+	tx := database.DB.Begin()
+
+	var returnRequest models.ReturnRequest
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+		Where("return_request_id = ? AND seller_id = ?", request.ReturnRequestID, sellerIDUint).
+		First(&returnRequest).Error; err != nil {
+		tx.Rollback()
+		c.JSON(http.StatusNotFound, gin.H{
+			"status":  "failed",
+			"message": "return request not found for this seller",
+		})
+		return
+	}
+
+	if returnRequest.Status != action.From {
+		tx.Rollback()
+		c.JSON(http.StatusBadRequest, gin.H{
+			"status":  "failed",
+			"message": fmt.Sprintf("cannot %s a return request that is %s", request.Action, returnRequest.Status),
+		})
+		return
+	}
+
+	actor := OrderActor{Role: models.ActorSeller, ID: sellerIDUint}
+
+	switch action.To {
+	case models.ReturnStatusRejected:
+		var orderItem models.OrderItem
+		if err := tx.Where("order_item_id = ?", returnRequest.OrderItemID).First(&orderItem).Error; err != nil {
+			tx.Rollback()
+			c.JSON(http.StatusNotFound, gin.H{
+				"status":  "failed",
+				"message": "order item not found",
+			})
+			return
+		}
+
+		if err := TransitionOrderItemStatus(tx, &orderItem, models.OrderStatusDelivered, actor, "return rejected by seller"); err != nil {
+			tx.Rollback()
+			c.JSON(statusTransitionHTTPCode(err), gin.H{
+				"status":  "failed",
+				"message": "failed to update order item status: " + err.Error(),
+			})
+			return
+		}
+	case models.ReturnStatusReceived:
+		if err := completeReturn(tx, &returnRequest, actor); err != nil {
+			tx.Rollback()
+			c.JSON(statusTransitionHTTPCode(err), gin.H{
+				"status":  "failed",
+				"message": err.Error(),
+			})
+			return
+		}
+	}
+
+	if err := tx.Model(&returnRequest).Updates(map[string]interface{}{
+		"status":      action.To,
+		"seller_note": request.Note,
+	}).Error; err != nil {
+		tx.Rollback()
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"status":  "failed",
+			"message": "failed to update return request",
+		})
+		return
+	}
+
+	if err := tx.Commit().Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"status":  "failed",
+			"message": "failed to commit transaction",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"status":  "success",
+		"message": "return request updated successfully",
+		"data": gin.H{
+			"return_request_id": returnRequest.ReturnRequestID,
+			"status":            action.To,
+		},
+	})
+}
+
+// completeReturn runs once the seller has the item back: the item is marked
+// returned, its stock released and the buyer refunded. When this was the last
+// active item the rest of the order total (delivery charge) is refunded too.
+func completeReturn(tx *gorm.DB, returnRequest *models.ReturnRequest, actor OrderActor) error {
+	var orderItem models.OrderItem
+	if err := tx.Where("order_item_id = ?", returnRequest.OrderItemID).First(&orderItem).Error; err != nil {
+		return fmt.Errorf("order item not found")
+	}
+
+	var order models.Order
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("order_id = ?", returnRequest.OrderID).First(&order).Error; err != nil {
+		return fmt.Errorf("order not found")
+	}
+
+	if err := TransitionOrderItemStatus(tx, &orderItem, models.OrderStatusReturned, actor, "return received by seller"); err != nil {
+		return err
+	}
+
+	if err := ReleaseProductStock(tx, orderItem.ProductID, orderItem.Quantity); err != nil {
+		return fmt.Errorf("failed to update product availability")
+	}
+
+	orderTotal := order.FinalAmount
+	refundAmount := orderItem.FinalAmount
+	order.FinalAmount = RoundDecimalValue(order.FinalAmount - orderItem.FinalAmount)
+
+	if err := SyncOrderStatus(tx, &order, actor, "return received by seller"); err != nil {
+		return fmt.Errorf("failed to update order status")
+	}
+
+	if order.Status == models.OrderStatusReturned {
+		refundAmount += math.Max(0, order.FinalAmount)
+		order.FinalAmount = 0
+	}
+
+	wasPaid := order.PaymentStatus == models.PaymentStatusPaid
+	if order.Status == models.OrderStatusReturned {
+		order.PaymentStatus = models.PaymentStatusRefund
+	}
+
+	if err := tx.Model(&order).Updates(map[string]interface{}{
+		"final_amount":   order.FinalAmount,
+		"payment_status": order.PaymentStatus,
+	}).Error; err != nil {
+		return fmt.Errorf("failed to update order total")
+	}
+
+	if wasPaid {
+		if err := RefundToUser(tx, returnRequest.UserID, strconv.Itoa(int(order.OrderID)), refundAmount, orderTotal, "Item returned", false, returnRequest.RefundTo); err != nil {
+			return fmt.Errorf("failed to refund amount")
+		}
+	}
+
+	returnRequest.RefundAmount = RoundDecimalValue(refundAmount)
+	if err := tx.Model(returnRequest).Update("refund_amount", returnRequest.RefundAmount).Error; err != nil {
+		return fmt.Errorf("failed to update return request")
+	}
+
+	return nil
+}
@@ -165,7 +165,11 @@ func TotalOrders(From string, Till string, PaymentStatus string, SellerID uint)
 		AccountInformation.TotalDeliveryCharges += RoundDecimalValue(order.DeliveryCharge)
 		AccountInformation.TotalCategoryOfferDeduction += RoundDecimalValue(order.CategoryDiscountAmount)
 		AccountInformation.TotalAmountAfterDeduction += RoundDecimalValue(order.FinalAmount)
+		AccountInformation.TotalCommission += RoundDecimalValue(order.CommissionAmount - order.CommissionRefunded)
+		AccountInformation.TotalGatewayFees += RoundDecimalValue(order.GatewayFeeAmount)
 	}
+	AccountInformation.TotalSellerEarnings = RoundDecimalValue(AccountInformation.TotalAmountAfterDeduction -
+		AccountInformation.TotalCommission - AccountInformation.TotalGatewayFees)
 
 	type StatusCount struct {
 		Status string
@@ -411,6 +415,12 @@ func GenerateSalesReportPDF(orderCount models.OrderCount, amountInfo models.Amou
 	pdf.Cell(40, 10, "Delivery Charges: "+fmt.Sprintf("%.2f", amountInfo.TotalDeliveryCharges))
 	pdf.Ln(8)
 	pdf.Cell(40, 10, "Total Amount After Deduction: "+fmt.Sprintf("%.2f", amountInfo.TotalAmountAfterDeduction))
+	pdf.Ln(8)
+	pdf.Cell(40, 10, "Platform Commission: "+fmt.Sprintf("%.2f", amountInfo.TotalCommission))
+	pdf.Ln(8)
+	pdf.Cell(40, 10, "Payment Gateway Fees: "+fmt.Sprintf("%.2f", amountInfo.TotalGatewayFees))
+	pdf.Ln(8)
+	pdf.Cell(40, 10, "Seller Earnings: "+fmt.Sprintf("%.2f", amountInfo.TotalSellerEarnings))
 	pdf.Ln(12)
 
 	// Order Status Summary Table
@@ -568,25 +578,34 @@ func GenerateSalesReportExcel(orderCount models.OrderCount, amountInfo models.Am
 	f.SetCellValue("Sheet1", "A12", "Total Amount After Deduction")
 	f.SetCellValue("Sheet1", "B12", fmt.Sprintf("%.2f", amountInfo.TotalAmountAfterDeduction))
 
+	f.SetCellValue("Sheet1", "A13", "Platform Commission")
+	f.SetCellValue("Sheet1", "B13", fmt.Sprintf("%.2f", amountInfo.TotalCommission))
+
+	f.SetCellValue("Sheet1", "A14", "Payment Gateway Fees")
+	f.SetCellValue("Sheet1", "B14", fmt.Sprintf("%.2f", amountInfo.TotalGatewayFees))
+
+	f.SetCellValue("Sheet1", "A15", "Seller Earnings")
+	f.SetCellValue("Sheet1", "B15", fmt.Sprintf("%.2f", amountInfo.TotalSellerEarnings))
+
 	// Adding Order Status Summary
-	f.SetCellValue("Sheet1", "A14", "Order Status Summary")
-	f.SetCellValue("Sheet1", "A15", "Total Pending Orders")
-	f.SetCellValue("Sheet1", "B15", strconv.Itoa(int(orderCount.TotalPending)))
+	f.SetCellValue("Sheet1", "A18", "Order Status Summary")
+	f.SetCellValue("Sheet1", "A19", "Total Pending Orders")
+	f.SetCellValue("Sheet1", "B19", strconv.Itoa(int(orderCount.TotalPending)))
 
-	f.SetCellValue("Sheet1", "A16", "Total Confirmed Orders")
-	f.SetCellValue("Sheet1", "B16", strconv.Itoa(int(orderCount.TotalConfirmed)))
+	f.SetCellValue("Sheet1", "A20", "Total Confirmed Orders")
+	f.SetCellValue("Sheet1", "B20", strconv.Itoa(int(orderCount.TotalConfirmed)))
 
-	f.SetCellValue("Sheet1", "A17", "Total Shipped Orders")
-	f.SetCellValue("Sheet1", "B17", strconv.Itoa(int(orderCount.TotalShipped)))
+	f.SetCellValue("Sheet1", "A21", "Total Shipped Orders")
+	f.SetCellValue("Sheet1", "B21", strconv.Itoa(int(orderCount.TotalShipped)))
 
-	f.SetCellValue("Sheet1", "A18", "Total Delivered Orders")
-	f.SetCellValue("Sheet1", "B18", strconv.Itoa(int(orderCount.TotalDelivered)))
+	f.SetCellValue("Sheet1", "A22", "Total Delivered Orders")
+	f.SetCellValue("Sheet1", "B22", strconv.Itoa(int(orderCount.TotalDelivered)))
 
-	f.SetCellValue("Sheet1", "A19", "Total Cancelled Orders")
-	f.SetCellValue("Sheet1", "B19", strconv.Itoa(int(orderCount.TotalCancelled)))
+	f.SetCellValue("Sheet1", "A23", "Total Cancelled Orders")
+	f.SetCellValue("Sheet1", "B23", strconv.Itoa(int(orderCount.TotalCancelled)))
 
-	f.SetCellValue("Sheet1", "A20", "Total Returned Orders")
-	f.SetCellValue("Sheet1", "B20", strconv.Itoa(int(orderCount.TotalReturned)))
+	f.SetCellValue("Sheet1", "A24", "Total Returned Orders")
+	f.SetCellValue("Sheet1", "B24", strconv.Itoa(int(orderCount.TotalReturned)))
 
 	// Write to buffer
 	var buf bytes.Buffer
@@ -716,8 +735,8 @@ func GeneratePDFInvoice(order models.Order, orderItems []models.OrderItem, user
 
 	// Table header
 	pdf.SetFont("Arial", "B", 10)
-	tableHeaders := []string{"Product", "Description", "Price", "Product Offer", "Category Offer", "Other Offers", "Final Amount"}
-	headerWidths := []float64{25, 60, 20, 24, 26, 22, 23}
+	tableHeaders := []string{"Product", "Description", "Qty", "Price", "Product Offer", "Category Offer", "Other Offers", "Final Amount"}
+	headerWidths := []float64{25, 50, 10, 20, 24, 26, 22, 23}
 
 	for i, header := range tableHeaders {
 		pdf.CellFormat(headerWidths[i], 10, header, "1", 0, "C", false, 0, "")
@@ -733,7 +752,8 @@ func GeneratePDFInvoice(order models.Order, orderItems []models.OrderItem, user
 		// x, y := pdf.GetXY()
 		// pdf.MultiCell(50, 10, item.Product.Description, "1", "L", false)
 		// pdf.SetXY(x+50, y)
-		pdf.CellFormat(60, 10, item.Product.Description, "1", 0, "C", false, 0, "")
+		pdf.CellFormat(50, 10, item.Product.Description, "1", 0, "C", false, 0, "")
+		pdf.CellFormat(10, 10, fmt.Sprintf("%d", item.Quantity), "1", 0, "C", false, 0, "")
 		pdf.CellFormat(20, 10, fmt.Sprintf("%.2f", item.Price), "1", 0, "C", false, 0, "")
 		pdf.CellFormat(24, 10, fmt.Sprintf("%.2f", item.ProductOfferAmount), "1", 0, "C", false, 0, "")
 		pdf.CellFormat(26, 10, fmt.Sprintf("%.2f", item.CategoryOfferAmount), "1", 0, "C", false, 0, "")
@@ -746,7 +766,7 @@ func GeneratePDFInvoice(order models.Order, orderItems []models.OrderItem, user
 		totalProductOffer += item.ProductOfferAmount
 		totalCategoryOffer += item.CategoryOfferAmount
 		totalOtherOffers += item.OtherOffers
-		totalPrice += item.Price
+		totalPrice += item.Price * float64(item.Quantity)
 	}
 
 	pdf.Ln(5)
@@ -760,6 +780,24 @@ func GeneratePDFInvoice(order models.Order, orderItems []models.OrderItem, user
 	pdf.CellFormat(23, 10, fmt.Sprintf("%.2f", totalFinalAmount), "1", 0, "C", false, 0, "")
 	pdf.Ln(12)
 
+	// Marketplace fees taken from the seller's share of this order
+	if order.CommissionAmount > 0 || order.GatewayFeeAmount > 0 {
+		commission := RoundDecimalValue(order.CommissionAmount - order.CommissionRefunded)
+		pdf.SetFont("Arial", "B", 10)
+		pdf.Cell(0, 6, "Marketplace Fees (charged to seller)")
+		pdf.Ln(6)
+		pdf.SetFont("Arial", "", 10)
+		pdf.CellFormat(95, 6, "Platform Commission", "", 0, "L", false, 0, "")
+		pdf.CellFormat(0, 6, fmt.Sprintf("%.2f", commission), "", 0, "R", false, 0, "")
+		pdf.Ln(6)
+		pdf.CellFormat(95, 6, "Payment Gateway Fee", "", 0, "L", false, 0, "")
+		pdf.CellFormat(0, 6, fmt.Sprintf("%.2f", order.GatewayFeeAmount), "", 0, "R", false, 0, "")
+		pdf.Ln(6)
+		pdf.CellFormat(95, 6, "Seller Earnings", "", 0, "L", false, 0, "")
+		pdf.CellFormat(0, 6, fmt.Sprintf("%.2f", RoundDecimalValue(order.FinalAmount-commission-order.GatewayFeeAmount)), "", 0, "R", false, 0, "")
+		pdf.Ln(8)
+	}
+
 	pdf.SetFont("Arial", "B", 12)
 	pdf.Ln(5)
 	pdf.CellFormat(0, 10, "Thank you for shopping with Knowledge Mart!", "", 1, "C", false, 0, "")
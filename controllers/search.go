@@ -2,47 +2,364 @@ package controllers
 
 import (
 	"fmt"
+	"html"
 	database "knowledgeMart/config"
 	"knowledgeMart/models"
+	"knowledgeMart/utils"
 	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
 
 	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
 )
 
+// The snippet marks matches with control characters rather than <mark> tags
+// so the seller's text can be HTML-escaped before the tags are put in.
+const (
+	snippetStartSel       = "\x02"
+	snippetStopSel        = "\x03"
+	productSnippetOptions = "StartSel=" + snippetStartSel + ", StopSel=" + snippetStopSel + ", MaxWords=25, MinWords=10, MaxFragments=2"
+)
+
+var searchTermPattern = regexp.MustCompile(`[\p{L}\p{N}]+`)
+
+type productSearchResult struct {
+	models.Product
+	SellerRating  float64
+	SearchRank    float64
+	SearchSnippet string
+}
+
+// productSearchFilter is one condition of a search, tagged with the facet
+// dimension it narrows so that facet can be counted without it.
+type productSearchFilter struct {
+	dimension string
+	clause    string
+	args      []interface{}
+}
+
+// filteredProducts returns the product search query with every filter applied
+// except those of the given dimension.
+func filteredProducts(filters []productSearchFilter, except string) *gorm.DB {
+	query := database.DB.Model(&models.Product{}).
+		Joins("JOIN sellers ON sellers.id = products.seller_id").
+		Joins("LEFT JOIN categories ON categories.id = products.category_id")
+
+	for _, filter := range filters {
+		if filter.dimension != "" && filter.dimension == except {
+			continue
+		}
+		query = query.Where(filter.clause, filter.args...)
+	}
+	return query
+}
+
+// highlightSnippet escapes a snippet for use as HTML and turns its match
+// markers into <mark> tags.
+func highlightSnippet(snippet string) string {
+	return strings.NewReplacer(snippetStartSel, "<mark>", snippetStopSel, "</mark>").Replace(html.EscapeString(snippet))
+}
+
+// buildPrefixTSQuery turns free text into a to_tsquery expression where every
+// term must match, each as a prefix ("math boo" -> "math:* & boo:*").
+func buildPrefixTSQuery(q string) string {
+	terms := searchTermPattern.FindAllString(strings.ToLower(q), -1)
+	for i, term := range terms {
+		terms[i] = term + ":*"
+	}
+	return strings.Join(terms, " & ")
+}
+
+var priceBands = []struct {
+	Label string
+	Min   float64
+	Max   float64
+}{
+	{"under 100", 0, 100},
+	{"100 - 250", 100, 250},
+	{"250 - 500", 250, 500},
+	{"500 - 1000", 500, 1000},
+	{"1000 & above", 1000, 0},
+}
+
+var ratingBuckets = []float64{4, 3, 2, 1}
+
+// productSearchFacets counts the products matched by filters per category,
+// price band, seller rating and availability. Each facet is counted with every
+// filter but its own, so picking a category still shows how many products the
+// other categories have. Rating buckets are cumulative ("3 & up" includes 4
+// and 5 stars) so that each maps onto min_rating.
+func productSearchFacets(filters []productSearchFilter) (models.ProductSearchFacets, error) {
+	facets := models.ProductSearchFacets{
+		Categories: []models.CategoryFacet{},
+	}
+
+	if err := filteredProducts(filters, "category").
+		Select("products.category_id, categories.name AS category_name, COUNT(*) AS count").
+		Group("products.category_id, categories.name").
+		Order("count DESC").
+		Scan(&facets.Categories).Error; err != nil {
+		return facets, err
+	}
+
+	bandCase := "CASE"
+	for i, band := range priceBands {
+		if band.Max == 0 {
+			bandCase += fmt.Sprintf(" ELSE %d", i)
+			continue
+		}
+		bandCase += fmt.Sprintf(" WHEN products.offer_amount < %v THEN %d", band.Max, i)
+	}
+	bandCase += " END"
+
+	var bandCounts []struct {
+		Band  int
+		Count int64
+	}
+	if err := filteredProducts(filters, "price").
+		Select(bandCase + " AS band, COUNT(*) AS count").
+		Group("band").
+		Scan(&bandCounts).Error; err != nil {
+		return facets, err
+	}
+
+	counts := make(map[int]int64)
+	for _, bandCount := range bandCounts {
+		counts[bandCount.Band] = bandCount.Count
+	}
+	for i, band := range priceBands {
+		facets.PriceBands = append(facets.PriceBands, models.PriceBandFacet{
+			Label:    band.Label,
+			MinPrice: band.Min,
+			MaxPrice: band.Max,
+			Count:    counts[i],
+		})
+	}
+
+	var ratingCounts []struct {
+		Rating float64
+		Count  int64
+	}
+	if err := filteredProducts(filters, "rating").
+		Select("FLOOR(COALESCE(sellers.average_rating, 0)) AS rating, COUNT(*) AS count").
+		Group("rating").
+		Scan(&ratingCounts).Error; err != nil {
+		return facets, err
+	}
+
+	for _, minRating := range ratingBuckets {
+		bucket := models.RatingFacet{
+			Label:     fmt.Sprintf("%.0f & up", minRating),
+			MinRating: minRating,
+		}
+		for _, ratingCount := range ratingCounts {
+			if ratingCount.Rating >= minRating {
+				bucket.Count += ratingCount.Count
+			}
+		}
+		facets.Ratings = append(facets.Ratings, bucket)
+	}
+
+	var availabilityCounts []struct {
+		Availability bool
+		Count        int64
+	}
+	if err := filteredProducts(filters, "availability").
+		Select("products.availability, COUNT(*) AS count").
+		Group("products.availability").
+		Scan(&availabilityCounts).Error; err != nil {
+		return facets, err
+	}
+
+	for _, availabilityCount := range availabilityCounts {
+		if availabilityCount.Availability {
+			facets.Availability.Available = availabilityCount.Count
+		} else {
+			facets.Availability.Unavailable = availabilityCount.Count
+		}
+	}
+
+	return facets, nil
+}
+
 func SearchProducts(c *gin.Context) {
-	var products []models.Product
+	var results []productSearchResult
 	var productResponse []models.ProductResponse
 
+	searchText := strings.TrimSpace(c.Query("q"))
 	categoryID := c.Query("category_id")
 	sortBy := c.Query("sort_by")
 	filterAvailable := c.Query("available")
 
-	query := database.DB.Model(&products)
+	pageRequest, err := utils.ParsePageRequest(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"status":  "failed",
+			"message": err.Error(),
+		})
+		return
+	}
+
+	if pageRequest.CursorMode && (sortBy != "" || searchText != "") {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"status":  "failed",
+			"message": "cursor pagination cannot be combined with sort_by or q, use page and limit instead",
+		})
+		return
+	}
+
+	tsQuery := buildPrefixTSQuery(searchText)
+	if searchText != "" && tsQuery == "" {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"status":  "failed",
+			"message": "search query must contain at least one letter or number",
+		})
+		return
+	}
+
+	var filters []productSearchFilter
 
 	if filterAvailable == "true" {
-		query = query.Where("availability = ?", true)
+		filters = append(filters, productSearchFilter{"availability", "products.availability = ?", []interface{}{true}})
 	}
 
 	if categoryID != "" {
-		query = query.Where("category_id = ?", categoryID)
+		filters = append(filters, productSearchFilter{"category", "products.category_id = ?", []interface{}{categoryID}})
+	}
+
+	if sellerID := c.Query("seller_id"); sellerID != "" {
+		sellerIDUint, err := strconv.ParseUint(sellerID, 10, 64)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"status":  "failed",
+				"message": "seller_id must be a valid number",
+			})
+			return
+		}
+		filters = append(filters, productSearchFilter{"seller", "products.seller_id = ?", []interface{}{sellerIDUint}})
+	}
+
+	for _, filter := range []struct {
+		param     string
+		dimension string
+		clause    string
+	}{
+		{"min_price", "price", "products.offer_amount >= ?"},
+		{"max_price", "price", "products.offer_amount <= ?"},
+		{"min_rating", "rating", "sellers.average_rating >= ?"},
+	} {
+		value := c.Query(filter.param)
+		if value == "" {
+			continue
+		}
+		number, err := strconv.ParseFloat(value, 64)
+		if err != nil || number < 0 {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"status":  "failed",
+				"message": fmt.Sprintf("%s must be a non-negative number", filter.param),
+			})
+			return
+		}
+		filters = append(filters, productSearchFilter{filter.dimension, filter.clause, []interface{}{number}})
+	}
+
+	searchMode := ""
+	var totalCount int64
+
+	if tsQuery != "" {
+		searchMode = "fulltext"
+		filters = append(filters, productSearchFilter{"", "products.search_vector @@ to_tsquery('english', ?)", []interface{}{tsQuery}})
+
+		totalCount, err = pageRequest.Count(filteredProducts(filters, ""))
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"status":  "failed",
+				"message": "failed to count products",
+			})
+			return
+		}
+
+		// Nothing matched word-for-word, so fall back to trigram similarity on
+		// the product name to tolerate typos such as "phyics".
+		if totalCount == 0 {
+			searchMode = "fuzzy"
+			filters[len(filters)-1] = productSearchFilter{"", "products.name % ?", []interface{}{searchText}}
+
+			totalCount, err = pageRequest.Count(filteredProducts(filters, ""))
+			if err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{
+					"status":  "failed",
+					"message": "failed to count products",
+				})
+				return
+			}
+		}
+	} else {
+		totalCount, err = pageRequest.Count(filteredProducts(filters, ""))
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"status":  "failed",
+				"message": "failed to count products",
+			})
+			return
+		}
+	}
+
+	facets, err := productSearchFacets(filters)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"status":  "failed",
+			"message": "failed to compute search facets",
+		})
+		return
+	}
+
+	query := filteredProducts(filters, "")
+	switch searchMode {
+	case "fulltext":
+		query = query.Select(fmt.Sprintf("products.*, sellers.average_rating AS seller_rating, ts_rank(products.search_vector, to_tsquery('english', ?)) AS search_rank, ts_headline('english', products.description, to_tsquery('english', ?), '%s') AS search_snippet",
+			productSnippetOptions), tsQuery, tsQuery)
+	case "fuzzy":
+		// the typo never appears in the text, so the snippet marks the name
+		// that was close enough to match instead
+		query = query.Select("products.*, sellers.average_rating AS seller_rating, similarity(products.name, ?) AS search_rank, ? || products.name || ? AS search_snippet",
+			searchText, snippetStartSel, snippetStopSel)
+	default:
+		query = query.Select("products.*, sellers.average_rating AS seller_rating")
 	}
 
 	switch sortBy {
 	case "price_asc":
-		query = query.Order("offer_amount ASC")
+		query = query.Order("products.offer_amount ASC")
 	case "price_desc":
-		query = query.Order("offer_amount DESC")
+		query = query.Order("products.offer_amount DESC")
 	case "newest":
-		query = query.Order("created_at DESC")
+		query = query.Order("products.created_at DESC")
 	case "name_asc":
-		query = query.Order("LOWER(name) ASC")
+		query = query.Order("LOWER(products.name) ASC")
 	case "name_desc":
-		query = query.Order("LOWER(name) DESC")
+		query = query.Order("LOWER(products.name) DESC")
 	case "high_rating":
-		query = query.Joins("JOIN sellers ON sellers.id = products.seller_id").Order("sellers.average_rating DESC")
+		query = query.Order("sellers.average_rating DESC")
+	default:
+		if searchMode != "" {
+			query = query.Order("search_rank DESC")
+		}
 	}
 
-	tx := query.Find(&products)
+	var lastID uint
+	query, err = pageRequest.Apply(query, "products.id", false, &lastID)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"status":  "failed",
+			"message": err.Error(),
+		})
+		return
+	}
+
+	tx := query.Find(&results)
 	if tx.Error != nil {
 		c.JSON(http.StatusNotFound, gin.H{
 			"status":  "failed",
@@ -51,35 +368,63 @@ func SearchProducts(c *gin.Context) {
 		return
 	}
 
-	for _, product := range products {
-		var seller models.Seller
-		if err := database.DB.Where("id = ?", product.SellerID).Select("average_rating").First(&seller).Error; err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{
-				"status":  "failed",
-				"message": "failed to retrieve seller rating",
-			})
-			return
-		}
+	hasMore := pageRequest.HasMore(len(results), totalCount)
+	if pageRequest.CursorMode && hasMore {
+		results = results[:pageRequest.Limit]
+	}
+
+	var nextCursor string
+	if len(results) > 0 {
+		nextCursor = utils.EncodeCursor(results[len(results)-1].ID)
+	}
+
+	productIDs := make([]uint, 0, len(results))
+	for _, result := range results {
+		productIDs = append(productIDs, result.ID)
+	}
+
+	histograms, err := ProductReviewHistograms(productIDs)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"status":  "failed",
+			"message": "failed to retrieve product ratings",
+		})
+		return
+	}
+
+	for _, result := range results {
+		product := result.Product
 		productResponse = append(productResponse, models.ProductResponse{
-			ID:           product.ID,
-			Name:         product.Name,
-			Description:  product.Description,
-			Price:        product.Price,
-			OfferAmount:  product.OfferAmount,
-			Image:        product.Image,
-			Availability: product.Availability,
-			SellerID:     product.SellerID,
-			CategoryID:   product.CategoryID,
-			SellerRating: seller.AverageRating,
+			ID:            product.ID,
+			Name:          product.Name,
+			Description:   product.Description,
+			Price:         product.Price,
+			OfferAmount:   product.OfferAmount,
+			Image:         product.Image,
+			Availability:  product.Availability,
+			StockQuantity: product.StockQuantity,
+			SellerID:      product.SellerID,
+			CategoryID:    product.CategoryID,
+			SellerRating:  result.SellerRating,
+			Relevance:     result.SearchRank,
+			Snippet:       highlightSnippet(result.SearchSnippet),
+			ReviewSummary: NewReviewSummary(product, histograms[product.ID]),
 		})
 	}
 
+	data := gin.H{
+		"products": productResponse,
+		"facets":   facets,
+	}
+	if searchMode != "" {
+		data["search_mode"] = searchMode
+	}
+
 	c.JSON(http.StatusOK, gin.H{
-		"status":  "success",
-		"message": "successfully retrieved products",
-		"data": gin.H{
-			"products": productResponse,
-		},
+		"status":     "success",
+		"message":    "successfully retrieved products",
+		"data":       data,
+		"pagination": utils.NewPageInfo(c, pageRequest, totalCount, hasMore, nextCursor),
 	})
 }
 
@@ -110,7 +455,7 @@ func TopSellingProduct(c *gin.Context) {
 	var topProducts []ProductSales
 
 	if err := database.DB.Table("order_items").
-		Select("order_items.product_id, COUNT(*) as count").
+		Select("order_items.product_id, SUM(order_items.quantity) as count").
 		Joins("JOIN products ON products.id = order_items.product_id").
 		Where("products.seller_id = ?", sellerIDUint).
 		Group("order_items.product_id").
@@ -147,16 +492,17 @@ func TopSellingProduct(c *gin.Context) {
 		fmt.Println(productSale.Count)
 
 		productResponse = append(productResponse, models.ProductResponse{
-			ID:           product.ID,
-			Name:         product.Name,
-			Description:  product.Description,
-			Price:        product.Price,
-			OfferAmount:  product.OfferAmount,
-			Image:        product.Image,
-			Availability: product.Availability,
-			SellerID:     product.SellerID,
-			CategoryID:   product.CategoryID,
-			SellerRating: seller.AverageRating,
+			ID:            product.ID,
+			Name:          product.Name,
+			Description:   product.Description,
+			Price:         product.Price,
+			OfferAmount:   product.OfferAmount,
+			Image:         product.Image,
+			Availability:  product.Availability,
+			StockQuantity: product.StockQuantity,
+			SellerID:      product.SellerID,
+			CategoryID:    product.CategoryID,
+			SellerRating:  seller.AverageRating,
 			//SalesCount:   productSale.Count,
 		})
 	}
@@ -197,7 +543,7 @@ func TopSellingCategory(c *gin.Context) {
 	var topCategories []CategorySales
 
 	if err := database.DB.Table("order_items").
-		Select("products.category_id, categories.name as category_name, COUNT(*) as count").
+		Select("products.category_id, categories.name as category_name, SUM(order_items.quantity) as count").
 		Joins("JOIN products ON products.id = order_items.product_id").
 		Joins("JOIN categories ON categories.id = products.category_id").
 		Where("products.seller_id = ?", sellerIDUint).
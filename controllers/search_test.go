@@ -0,0 +1,23 @@
+package controllers
+
+import "testing"
+
+func TestHighlightSnippet(t *testing.T) {
+	tests := []struct {
+		name    string
+		snippet string
+		want    string
+	}{
+		{"empty", "", ""},
+		{"plain text", "intro to algebra", "intro to algebra"},
+		{"match is marked", "intro to \x02algebra\x03 notes", "intro to <mark>algebra</mark> notes"},
+		{"markup in the text is escaped", "<script>alert(1)</script> \x02notes\x03", "&lt;script&gt;alert(1)&lt;/script&gt; <mark>notes</mark>"},
+		{"markup inside a match is escaped", "\x02<b>notes</b>\x03", "<mark>&lt;b&gt;notes&lt;/b&gt;</mark>"},
+	}
+
+	for _, test := range tests {
+		if got := highlightSnippet(test.snippet); got != test.want {
+			t.Errorf("%s: highlightSnippet(%q) = %q, want %q", test.name, test.snippet, got, test.want)
+		}
+	}
+}
@@ -1,12 +1,16 @@
 package controllers
 
 import (
+	"errors"
 	"fmt"
 	database "knowledgeMart/config"
 	"knowledgeMart/models"
+	"knowledgeMart/utils"
 	"net/http"
 
 	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
 func ListAllSellers(c *gin.Context) {
@@ -30,11 +34,45 @@ func ListAllSellers(c *gin.Context) {
 		return
 	}
 
+	pageRequest, err := utils.ParsePageRequest(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"status":  "failed",
+			"message": err.Error(),
+		})
+		return
+	}
+
 	var sellerResponse []models.SellerResponse
 	var sellers []models.Seller
 
+	query := database.DB.Model(&models.Seller{})
+
+	if verified := c.Query("verified"); verified != "" {
+		query = query.Where("is_verified = ?", verified == "true")
+	}
+
+	totalCount, err := pageRequest.Count(query)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"status":  "failed",
+			"message": "failed to count sellers",
+		})
+		return
+	}
+
+	var lastID uint
+	query, err = pageRequest.Apply(query, "id", false, &lastID)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"status":  "failed",
+			"message": err.Error(),
+		})
+		return
+	}
+
 	// Preload the User data for each seller
-	tx := database.DB.Preload("User").Find(&sellers)
+	tx := query.Preload("User").Find(&sellers)
 	if tx.Error != nil {
 		c.JSON(http.StatusNotFound, gin.H{
 			"status":  "failed",
@@ -43,6 +81,16 @@ func ListAllSellers(c *gin.Context) {
 		return
 	}
 
+	hasMore := pageRequest.HasMore(len(sellers), totalCount)
+	if pageRequest.CursorMode && hasMore {
+		sellers = sellers[:pageRequest.Limit]
+	}
+
+	var nextCursor string
+	if len(sellers) > 0 {
+		nextCursor = utils.EncodeCursor(sellers[len(sellers)-1].ID)
+	}
+
 	for _, seller := range sellers {
 		sellerResponse = append(sellerResponse, models.SellerResponse{
 			ID:           seller.ID,
@@ -63,6 +111,7 @@ func ListAllSellers(c *gin.Context) {
 		"data": gin.H{
 			"sellers": sellerResponse,
 		},
+		"pagination": utils.NewPageInfo(c, pageRequest, totalCount, hasMore, nextCursor),
 	})
 }
 
@@ -184,6 +233,15 @@ func NotVerifySeller(c *gin.Context) {
 		})
 		return
 	}
+
+	if err := RevokeSessions(database.DB, models.RoleSeller, seller.ID, "seller verification revoked", 0); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"status":  "failed",
+			"message": err.Error(),
+		})
+		return
+	}
+
 	c.JSON(http.StatusOK, gin.H{
 		"status":  "Success",
 		"message": "successfully verify the seller",
@@ -218,8 +276,30 @@ func SellerRating(c *gin.Context) {
 		return
 	}
 
+	var order models.Order
+	if err := database.DB.Where("order_id = ? AND user_id = ?", req.OrderID, userIDUint).First(&order).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{
+			"status":  "failed",
+			"message": "order not found",
+		})
+		return
+	}
+
+	if order.Status != models.OrderStatusDelivered {
+		c.JSON(http.StatusForbidden, gin.H{
+			"status":  "failed",
+			"message": "you can only rate a seller after the order is delivered",
+		})
+		return
+	}
+
+	tx := database.DB.Begin()
+
+	// Lock the seller first so that concurrent ratings for the same seller
+	// recompute the average one after another.
 	var seller models.Seller
-	if err := database.DB.Where("id = ?", req.SellerID).First(&seller).Error; err != nil {
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("id = ?", order.SellerID).First(&seller).Error; err != nil {
+		tx.Rollback()
 		c.JSON(http.StatusNotFound, gin.H{
 			"status":  "failed",
 			"message": "seller not found",
@@ -227,20 +307,80 @@ func SellerRating(c *gin.Context) {
 		return
 	}
 
-	newRating := models.SellerRating{
-		UserID:   userIDUint,
-		SellerID: req.SellerID,
-		Rating:   req.Rating,
+	var rating models.SellerRating
+	var oldRating float64
+	updated := false
+
+	err := tx.Where("user_id = ? AND order_id = ?", userIDUint, order.OrderID).First(&rating).Error
+	switch {
+	case err == nil:
+		if rating.Rating == req.Rating {
+			tx.Rollback()
+			c.JSON(http.StatusOK, gin.H{
+				"status":  "success",
+				"message": "rating is unchanged",
+				"data": gin.H{
+					"order_id":  order.OrderID,
+					"seller_id": order.SellerID,
+					"rating":    rating.Rating,
+				},
+			})
+			return
+		}
+
+		oldRating = rating.Rating
+		updated = true
+		if err := tx.Model(&rating).Update("rating", req.Rating).Error; err != nil {
+			tx.Rollback()
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"status":  "failed",
+				"message": "failed to update rating: " + err.Error(),
+			})
+			return
+		}
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		rating = models.SellerRating{
+			UserID:   userIDUint,
+			SellerID: order.SellerID,
+			OrderID:  order.OrderID,
+			Rating:   req.Rating,
+		}
+		if err := tx.Create(&rating).Error; err != nil {
+			tx.Rollback()
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"status":  "failed",
+				"message": "failed to save rating: " + err.Error(),
+			})
+			return
+		}
+	default:
+		tx.Rollback()
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"status":  "failed",
+			"message": "failed to retrieve existing rating",
+		})
+		return
 	}
-	if err := database.DB.Create(&newRating).Error; err != nil {
+
+	history := models.SellerRatingHistory{
+		SellerRatingID: rating.ID,
+		UserID:         userIDUint,
+		SellerID:       order.SellerID,
+		OrderID:        order.OrderID,
+		OldRating:      oldRating,
+		NewRating:      req.Rating,
+	}
+	if err := tx.Create(&history).Error; err != nil {
+		tx.Rollback()
 		c.JSON(http.StatusInternalServerError, gin.H{
 			"status":  "failed",
-			"message": "failed to save rating: " + err.Error(),
+			"message": "failed to record rating history",
 		})
 		return
 	}
 
-	if err := UpdateSellerAverageRating(req.SellerID); err != nil {
+	if err := UpdateSellerAverageRating(tx, order.SellerID); err != nil {
+		tx.Rollback()
 		c.JSON(http.StatusInternalServerError, gin.H{
 			"status":  "failed",
 			"message": "failed to update seller average rating: " + err.Error(),
@@ -248,42 +388,46 @@ func SellerRating(c *gin.Context) {
 		return
 	}
 
+	if err := tx.Commit().Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"status":  "failed",
+			"message": "failed to commit transaction",
+		})
+		return
+	}
+
+	message := "Rating successfully submitted and seller rating updated"
+	if updated {
+		message = "Rating successfully updated and seller rating recalculated"
+	}
+
 	c.JSON(http.StatusOK, gin.H{
 		"status":  "success",
-		"message": "Rating successfully submitted and seller rating updated",
+		"message": message,
 		"data": gin.H{
-			"user_id":   userIDUint,
-			"seller_id": req.SellerID,
-			"rating":    req.Rating,
+			"user_id":    userIDUint,
+			"order_id":   order.OrderID,
+			"seller_id":  order.SellerID,
+			"rating":     req.Rating,
+			"old_rating": oldRating,
 		},
 	})
 }
 
-func UpdateSellerAverageRating(sellerID uint) error {
-	var totalRatingSum float64
-	var ratingCount int64
-
-	if err := database.DB.Model(&models.SellerRating{}).
-		Where("seller_id = ?", sellerID).
-		Select("COALESCE(SUM(rating), 0)").Scan(&totalRatingSum).Error; err != nil {
-		return fmt.Errorf("failed to calculate total rating sum: %w", err)
-	}
+// UpdateSellerAverageRating recomputes the seller's average from ratings that
+// are tied to an order; older free-form ratings without an order are ignored.
+func UpdateSellerAverageRating(tx *gorm.DB, sellerID uint) error {
+	var averageRating float64
 
-	if err := database.DB.Model(&models.SellerRating{}).
-		Where("seller_id = ?", sellerID).
-		Count(&ratingCount).Error; err != nil {
-		return fmt.Errorf("failed to count total ratings: %w", err)
+	if err := tx.Model(&models.SellerRating{}).
+		Where("seller_id = ? AND order_id > 0", sellerID).
+		Select("COALESCE(AVG(rating), 0)").Scan(&averageRating).Error; err != nil {
+		return fmt.Errorf("failed to calculate average rating: %w", err)
 	}
 
-	if ratingCount == 0 {
-		return nil
-	}
-
-	averageRating := totalRatingSum / float64(ratingCount)
-
-	if err := database.DB.Model(&models.Seller{}).
+	if err := tx.Model(&models.Seller{}).
 		Where("id = ?", sellerID).
-		Update("average_rating", averageRating).Error; err != nil {
+		Update("average_rating", RoundDecimalValue(averageRating)).Error; err != nil {
 		return fmt.Errorf("failed to update seller average rating: %w", err)
 	}
 
@@ -213,6 +213,15 @@ func EditSellerPassword(c *gin.Context) {
 		return
 	}
 
+	// other devices have to log in again with the new password
+	if err := RevokeSessions(database.DB, models.RoleSeller, existingSeller.ID, "password changed", c.GetUint("sessionID")); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"status":  "failed",
+			"message": err.Error(),
+		})
+		return
+	}
+
 	c.JSON(http.StatusOK, gin.H{
 		"status":  "success",
 		"message": "successfully updated user password",
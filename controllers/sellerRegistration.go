@@ -7,7 +7,6 @@ import (
 	"gorm.io/gorm"
 	database "knowledgeMart/config"
 	"knowledgeMart/models"
-	"knowledgeMart/utils"
 	"net/http"
 )
 
@@ -176,7 +175,7 @@ func SellerLogin(c *gin.Context) {
 		return
 	}
 
-	token, err := utils.GenerateJWT(seller.ID, "seller")
+	token, refreshToken, err := StartSession(models.RoleSeller, seller.ID)
 	if token == "" || err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{
 			"status":  "failed",
@@ -189,9 +188,10 @@ func SellerLogin(c *gin.Context) {
 		"status":  "success",
 		"message": "Seller Login successfully",
 		"data": gin.H{
-			"token":    token,
-			"username": seller.UserName,
-			"verified": seller.IsVerified,
+			"token":         token,
+			"refresh_token": refreshToken,
+			"username":      seller.UserName,
+			"verified":      seller.IsVerified,
 		},
 	})
 }
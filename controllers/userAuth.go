@@ -7,12 +7,12 @@ import (
 	"fmt"
 	"io"
 	database "knowledgeMart/config"
+	"knowledgeMart/mailer"
 	"knowledgeMart/models"
 	"knowledgeMart/utils"
 	"log"
 	"math/rand"
 	"net/http"
-	"net/smtp"
 	"os"
 	"strconv"
 	"strings"
@@ -20,7 +20,6 @@ import (
 
 	"github.com/gin-gonic/gin"
 	"github.com/go-playground/validator/v10"
-	"github.com/joho/godotenv"
 	"golang.org/x/crypto/bcrypt"
 	"golang.org/x/oauth2"
 	"golang.org/x/oauth2/google"
@@ -29,111 +28,181 @@ import (
 
 var Validate *validator.Validate
 
-var googleOauthConfig = &oauth2.Config{
-	RedirectURL:  "https://www.knowledgemart.online/api/v1/googlecallback",
-	ClientID:     os.Getenv("CLIENTID"),
-	ClientSecret: os.Getenv("CLIENTSECRET"),
-	Scopes: []string{"https://www.googleapis.com/auth/userinfo.email",
-		"https://www.googleapis.com/auth/userinfo.profile"},
-	Endpoint: google.Endpoint,
-}
+const (
+	defaultGoogleRedirectURL = "https://www.knowledgemart.online/api/v1/googlecallback"
+	googleStateCookie        = "oauth_state"
+	googleStatePurposeLogin  = "login"
+	googleStatePurposeLink   = "link"
+)
 
-func GoogleHandleLogin(c *gin.Context) {
-	state := "nadbfyuhadVFYU6781235"
-	url := googleOauthConfig.AuthCodeURL(state)
-	c.Redirect(http.StatusTemporaryRedirect, url)
-	c.Next()
+// googleOauthConfig is built per request so GOOGLE_REDIRECT_URL can point
+// each environment at its own callback.
+func googleOauthConfig() *oauth2.Config {
+	redirectURL := os.Getenv("GOOGLE_REDIRECT_URL")
+	if redirectURL == "" {
+		redirectURL = defaultGoogleRedirectURL
+	}
+	return &oauth2.Config{
+		RedirectURL:  redirectURL,
+		ClientID:     os.Getenv("CLIENTID"),
+		ClientSecret: os.Getenv("CLIENTSECRET"),
+		Scopes: []string{"https://www.googleapis.com/auth/userinfo.email",
+			"https://www.googleapis.com/auth/userinfo.profile"},
+		Endpoint: google.Endpoint,
+	}
 }
 
-func GoogleHandleCallback(c *gin.Context) {
-	fmt.Println("Starting to handle callback")
-	fmt.Printf("Callback URL Params: %v\n", c.Request.URL.Query())
-
-	//code := c.Query("code")
-	code := strings.TrimSpace(c.Query("code"))
+// googleAuthURL starts an OAuth round trip for purpose and binds its state to
+// the calling browser through a short-lived cookie.
+func googleAuthURL(c *gin.Context, purpose string, userID uint) (string, error) {
+	state, nonce, err := utils.NewOAuthState(purpose, userID)
+	if err != nil {
+		return "", err
+	}
+	c.SetSameSite(http.SameSiteLaxMode)
+	c.SetCookie(googleStateCookie, nonce, int(utils.OAuthStateTTL.Seconds()), "/", "", c.Request.TLS != nil, true)
+	return googleOauthConfig().AuthCodeURL(state), nil
+}
 
-	if code == "" {
-		c.JSON(http.StatusBadRequest, gin.H{
+func GoogleHandleLogin(c *gin.Context) {
+	url, err := googleAuthURL(c, googleStatePurposeLogin, 0)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
 			"status":  "failed",
-			"message": "missing code parameter",
+			"message": err.Error(),
 		})
 		return
 	}
-	token, err := googleOauthConfig.Exchange(context.Background(), code)
+	c.Redirect(http.StatusTemporaryRedirect, url)
+}
+
+// fetchGoogleUser exchanges the authorization code and reads the profile of
+// the Google account that granted it.
+func fetchGoogleUser(code string) (models.GoogleResponse, error) {
+	token, err := googleOauthConfig().Exchange(context.Background(), code)
 	if err != nil {
 		log.Printf("Token Exchange Error: %v", err)
-		c.JSON(http.StatusBadRequest, gin.H{
-			"status":  "failed",
-			"message": "failed to exchange token",
-		})
-		return
+		return models.GoogleResponse{}, fmt.Errorf("failed to exchange token")
 	}
 
 	response, err := http.Get("https://www.googleapis.com/oauth2/v2/userinfo?access_token=" + token.AccessToken)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{
-			"status":  "failed",
-			"message": "failed to get user information",
-		})
-		return
+		return models.GoogleResponse{}, fmt.Errorf("failed to get user information")
 	}
 	defer response.Body.Close()
 
 	content, err := io.ReadAll(response.Body)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{
+		return models.GoogleResponse{}, fmt.Errorf("failed to read user information")
+	}
+
+	var googleUser models.GoogleResponse
+	if err := json.Unmarshal(content, &googleUser); err != nil || googleUser.ID == "" {
+		return models.GoogleResponse{}, fmt.Errorf("failed to parse user information")
+	}
+	return googleUser, nil
+}
+
+func GoogleHandleCallback(c *gin.Context) {
+	nonce, _ := c.Cookie(googleStateCookie)
+	c.SetCookie(googleStateCookie, "", -1, "/", "", c.Request.TLS != nil, true)
+
+	state, err := utils.ParseOAuthState(c.Query("state"), nonce)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
 			"status":  "failed",
-			"message": "failed to read user information",
+			"message": err.Error(),
 		})
 		return
 	}
 
-	var googleUser models.GoogleResponse
-	err = json.Unmarshal(content, &googleUser)
+	code := strings.TrimSpace(c.Query("code"))
+	if code == "" {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"status":  "failed",
+			"message": "missing code parameter",
+		})
+		return
+	}
+
+	googleUser, err := fetchGoogleUser(code)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{
+		c.JSON(http.StatusBadRequest, gin.H{
 			"status":  "failed",
-			"message": "failed to parse user information",
+			"message": err.Error(),
 		})
 		return
 	}
 
-	var refCode string
+	if state.Purpose == googleStatePurposeLink {
+		linkGoogleAccount(c, state.UserID, googleUser)
+		return
+	}
 
 	var existingUser models.User
-
-	if err := database.DB.Where("email = ?", googleUser.Email).First(&existingUser).Error; err != nil {
-		if err == gorm.ErrRecordNotFound {
-			refCode = utils.GenerateRandomString(5)
-
-			newUser := models.User{
+	err = database.DB.Where("google_id = ?", googleUser.ID).First(&existingUser).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		err = database.DB.Where("email = ?", googleUser.Email).First(&existingUser).Error
+		switch {
+		case errors.Is(err, gorm.ErrRecordNotFound):
+			if !googleUser.VerifiedEmail {
+				c.JSON(http.StatusBadRequest, gin.H{
+					"status":  "failed",
+					"message": "google account email is not verified",
+				})
+				return
+			}
+			existingUser = models.User{
 				Email:        googleUser.Email,
 				Name:         googleUser.Name,
 				Picture:      googleUser.Picture,
 				LoginMethod:  "google",
+				GoogleID:     googleUser.ID,
 				IsVerified:   true,
-				ReferralCode: refCode,
+				ReferralCode: utils.GenerateRandomString(5),
 			}
-			if err := database.DB.Create(&newUser).Error; err != nil {
+			if err := database.DB.Create(&existingUser).Error; err != nil {
 				c.JSON(http.StatusInternalServerError, gin.H{
 					"status":  "failed",
 					"message": "failed to create new user",
 				})
 				return
 			}
-			existingUser = newUser
-		} else {
+		case err != nil:
 			c.JSON(http.StatusInternalServerError, gin.H{
 				"status":  "failed",
 				"message": "failed to fetch user from database",
 			})
 			return
+		case existingUser.LoginMethod == "google" && existingUser.GoogleID == "":
+			// signed up with Google before identities were recorded
+			if err := database.DB.Model(&existingUser).Update("google_id", googleUser.ID).Error; err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{
+					"status":  "failed",
+					"message": "failed to update user",
+				})
+				return
+			}
+		default:
+			// an email-password account is only reachable through Google
+			// once its owner has linked it while logged in
+			c.JSON(http.StatusConflict, gin.H{
+				"status":  "failed",
+				"message": "an account with this email already exists, log in with your password and link Google from your profile",
+			})
+			return
 		}
-	} else {
-		if existingUser.ReferralCode == "" {
-			existingUser.ReferralCode = utils.GenerateRandomString(5)
-			database.DB.Save(&existingUser)
-		}
+	} else if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"status":  "failed",
+			"message": "failed to fetch user from database",
+		})
+		return
+	}
+
+	if existingUser.ReferralCode == "" {
+		existingUser.ReferralCode = utils.GenerateRandomString(5)
+		database.DB.Save(&existingUser)
 	}
 
 	if existingUser.Blocked {
@@ -144,7 +213,7 @@ func GoogleHandleCallback(c *gin.Context) {
 		return
 	}
 
-	tokenstring, err := utils.GenerateJWT(existingUser.ID, "user")
+	tokenstring, refreshToken, err := StartSession(models.RoleUser, existingUser.ID)
 	if tokenstring == "" || err != nil {
 		c.JSON(http.StatusUnauthorized, gin.H{
 			"status":  "failed",
@@ -157,8 +226,9 @@ func GoogleHandleCallback(c *gin.Context) {
 		"status":  "success",
 		"message": "login successful",
 		"data": gin.H{
-			"token": tokenstring,
-			"user":  existingUser,
+			"token":         tokenstring,
+			"refresh_token": refreshToken,
+			"user":          existingUser,
 		},
 	})
 }
@@ -336,7 +406,7 @@ func EmailLogin(c *gin.Context) {
 		}
 	}
 
-	token, err := utils.GenerateJWT(User.ID, "user")
+	token, refreshToken, err := StartSession(models.RoleUser, User.ID)
 	if token == "" || err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{
 			"status":  "failed",
@@ -351,40 +421,24 @@ func EmailLogin(c *gin.Context) {
 		"status":  "success",
 		"message": "Login successful",
 		"data": gin.H{
-			"token":        token,
-			"id":           User.ID,
-			"name":         User.Name,
-			"email":        User.Email,
-			"phone_number": User.PhoneNumber,
-			"picture":      User.Picture,
-			"block_status": User.Blocked,
-			"verified":     User.IsVerified,
+			"token":         token,
+			"refresh_token": refreshToken,
+			"id":            User.ID,
+			"name":          User.Name,
+			"email":         User.Email,
+			"phone_number":  User.PhoneNumber,
+			"picture":       User.Picture,
+			"block_status":  User.Blocked,
+			"verified":      User.IsVerified,
 		},
 	})
 
 }
 
 func sendOTPEmail(to string, otp uint64) error {
-	from := "knowledgemartv01@gmail.com"
-	err := godotenv.Load(".env")
-	if err != nil {
-		fmt.Println("Error loading .env file")
-	}
-	appPassword := os.Getenv("SMTPAPP")
-	fmt.Println(from)
-
-	auth := smtp.PlainAuth("", from, appPassword, "smtp.gmail.com")
-
-	msg := []byte("Subject: Verify your email\n\n" +
-		fmt.Sprintf("Your OTP is %d", otp))
-	err = smtp.SendMail("smtp.gmail.com:587", auth, from, []string{to}, msg)
-	fmt.Println("send OTP:", otp)
-	if err != nil {
-		fmt.Printf("Error in sending email: %v\n", err)
-		return errors.New("failed to send email ")
-	}
-	return nil
-
+	return QueueEmail(database.DB, to, mailer.EventVerifyEmail, map[string]interface{}{
+		"OTP": otp,
+	})
 }
 
 func VarifyEmail(c *gin.Context) {
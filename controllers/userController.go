@@ -3,6 +3,7 @@ package controllers
 import (
 	database "knowledgeMart/config"
 	"knowledgeMart/models"
+	"knowledgeMart/utils"
 	"net/http"
 
 	"github.com/gin-gonic/gin"
@@ -27,10 +28,48 @@ func ListAllUsers(c *gin.Context) {
 		return
 	}
 
+	pageRequest, err := utils.ParsePageRequest(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"status":  "failed",
+			"message": err.Error(),
+		})
+		return
+	}
+
 	var userResponse []models.UserResponse
 	var users []models.User
 
-	tx := database.DB.Find(&users)
+	query := database.DB.Model(&models.User{})
+
+	if blocked := c.Query("blocked"); blocked != "" {
+		query = query.Where("blocked = ?", blocked == "true")
+	}
+
+	if verified := c.Query("verified"); verified != "" {
+		query = query.Where("is_verified = ?", verified == "true")
+	}
+
+	totalCount, err := pageRequest.Count(query)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"status":  "failed",
+			"message": "failed to count users",
+		})
+		return
+	}
+
+	var lastID uint
+	query, err = pageRequest.Apply(query, "id", false, &lastID)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"status":  "failed",
+			"message": err.Error(),
+		})
+		return
+	}
+
+	tx := query.Find(&users)
 	if tx.Error != nil {
 		c.JSON(http.StatusNotFound, gin.H{
 			"status":  "failed",
@@ -38,6 +77,17 @@ func ListAllUsers(c *gin.Context) {
 		})
 		return
 	}
+
+	hasMore := pageRequest.HasMore(len(users), totalCount)
+	if pageRequest.CursorMode && hasMore {
+		users = users[:pageRequest.Limit]
+	}
+
+	var nextCursor string
+	if len(users) > 0 {
+		nextCursor = utils.EncodeCursor(users[len(users)-1].ID)
+	}
+
 	for _, user := range users {
 		userResponse = append(userResponse, models.UserResponse{
 			ID:          user.ID,
@@ -57,6 +107,7 @@ func ListAllUsers(c *gin.Context) {
 		"data": gin.H{
 			"users": userResponse,
 		},
+		"pagination": utils.NewPageInfo(c, pageRequest, totalCount, hasMore, nextCursor),
 	})
 }
 
@@ -117,6 +168,15 @@ func BlockUser(c *gin.Context) {
 		})
 		return
 	}
+
+	if err := RevokeSessions(database.DB, models.RoleUser, user.ID, "user blocked", 0); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"status":  "failed",
+			"message": err.Error(),
+		})
+		return
+	}
+
 	c.JSON(http.StatusOK, gin.H{
 		"status":  "failed",
 		"message": "successfully blocked the user",
@@ -1,67 +1,61 @@
 package controllers
 
 import (
+	"crypto/rand"
+	"encoding/hex"
 	"errors"
 	"fmt"
 	database "knowledgeMart/config"
 	"knowledgeMart/models"
+	"knowledgeMart/utils"
+	"log"
 	"net/http"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/gin-gonic/gin"
 	"gorm.io/gorm"
 )
 
-func AddMoneyToSellerWallet(OrderID string) bool {
+// AddMoneyToSellerWallet holds the amount paid for an order in the seller's
+// escrow. It becomes available to the seller once the order's return window
+// has closed, see ReleaseDueEscrow.
+func AddMoneyToSellerWallet(tx *gorm.DB, OrderID string) bool {
 	var order models.Order
-	if err := database.DB.Where("order_id = ?", OrderID).First(&order).Error; err != nil {
-		fmt.Println("Error fetching order:", err)
-		return false
-	}
-
-	var seller models.Seller
-	if err := database.DB.Where("id = ?", order.SellerID).First(&seller).Error; err != nil {
-		fmt.Println("Error fetching seller:", err)
+	if err := tx.Where("order_id = ?", OrderID).First(&order).Error; err != nil {
+		log.Printf("failed to fetch order %s: %v", OrderID, err)
 		return false
 	}
 
 	finalAmount := RoundDecimalValue(order.FinalAmount)
-	fmt.Println("Final Amount (Rounded):", finalAmount)
-
 	if finalAmount < 0 {
-		fmt.Println("Error: Negative final amount:", finalAmount)
+		log.Printf("order %s has a negative final amount %.2f", OrderID, finalAmount)
 		return false
 	}
 
-	seller.WalletAmount += finalAmount
-	fmt.Println("Updated Wallet Amount:", seller.WalletAmount)
-
-	sellerWallet := models.SellerWallet{
-		TransactionTime: time.Now(),
-		Type:            models.WalletIncoming,
-		OrderID:         order.OrderID,
-		SellerID:        order.SellerID,
-		Amount:          RoundDecimalValue(finalAmount),
-		CurrentBalance:  RoundDecimalValue(seller.WalletAmount),
-		Reason:          "Order Payment",
-	}
-
-	if err := database.DB.Create(&sellerWallet).Error; err != nil {
-		fmt.Println("Error creating seller wallet record:", err)
+	if _, err := PostJournalEntry(tx, fmt.Sprintf("ORDER_%d", order.OrderID), "Order payment",
+		LedgerLine{Account: PlatformAccount(models.LedgerGatewayClearing), Amount: -finalAmount},
+		LedgerLine{Account: SellerEscrowAccount(order.SellerID), Amount: finalAmount},
+	); err != nil {
+		log.Printf("failed to post payment of order %s to the ledger: %v", OrderID, err)
 		return false
 	}
 
-	if err := database.DB.Model(&seller).Update("wallet_amount", sellerWallet.CurrentBalance).Error; err != nil {
-		fmt.Println("Error updating seller's wallet balance:", err)
+	if err := holdOrderProceeds(tx, order, finalAmount); err != nil {
+		log.Printf("failed to hold payment of order %s in escrow: %v", OrderID, err)
 		return false
 	}
 
-	fmt.Println("Seller wallet updated successfully")
 	return true
 }
 
-func RefundToUser(tx *gorm.DB, userID uint, orderIDStr string, amount float64, reason string, isSeller bool) error {
+// RefundToUser takes the refund back from the seller and returns it to the
+// buyer, to the original payment instrument when destination asks for it and
+// the gateway accepts the refund, otherwise to the buyer's wallet. orderTotal
+// is the order total before this refund, the base the returned commission is
+// worked out from.
+func RefundToUser(tx *gorm.DB, userID uint, orderIDStr string, amount, orderTotal float64, reason string, isSeller bool, destination string) error {
 	orderIDUint, err := strconv.ParseUint(orderIDStr, 10, 32)
 	if err != nil {
 		return fmt.Errorf("invalid orderID format: %w", err)
@@ -73,127 +67,94 @@ func RefundToUser(tx *gorm.DB, userID uint, orderIDStr string, amount float64, r
 		return fmt.Errorf("failed to find order with ID %d: %w", orderID, err)
 	}
 
-	if !isSeller {
-		var wallet models.UserWallet
-
-		err = tx.Where("user_id = ?", userID).First(&wallet).Error
-		if err != nil {
-			if errors.Is(err, gorm.ErrRecordNotFound) {
-				wallet = models.UserWallet{
-					UserID:         userID,
-					CurrentBalance: RoundDecimalValue(amount),
-				}
-				if err := tx.Create(&wallet).Error; err != nil {
-					return fmt.Errorf("failed to create new wallet: %w", err)
-				}
-			} else {
-				return fmt.Errorf("failed to retrieve wallet: %w", err)
-			}
-		} else {
-			wallet.CurrentBalance += amount
-		}
-
-		walletTransaction := models.UserWallet{
-			UserID:          userID,
-			WalletPaymentID: fmt.Sprintf("WALLET_%d", time.Now().Unix()),
-			Type:            "incoming",
-			OrderID:         orderIDStr,
-			Amount:          RoundDecimalValue(amount),
-			CurrentBalance:  RoundDecimalValue(wallet.CurrentBalance),
-			Reason:          reason,
-			TransactionTime: time.Now(),
-		}
-
-		if err := tx.Create(&walletTransaction).Error; err != nil {
-			return fmt.Errorf("failed to create wallet transaction: %w", err)
-		}
-
-		if err := tx.Model(&wallet).Where("user_id = ?", userID).Update("current_balance", wallet.CurrentBalance).Error; err != nil {
-			return fmt.Errorf("failed to update wallet balance: %w", err)
-		}
-
-		if err := tx.Model(&models.User{}).Where("id = ?", userID).Update("wallet_amount", wallet.CurrentBalance).Error; err != nil {
-			return fmt.Errorf("failed to update user wallet balance: %w", err)
-		}
-
-		var seller models.Seller
-		if err := tx.Where("id = ?", order.SellerID).First(&seller).Error; err != nil {
-			return fmt.Errorf("failed to find seller with ID %d: %w", order.SellerID, err)
-		}
-
-		seller.WalletAmount -= amount
-		if err := tx.Model(&seller).Update("wallet_amount", seller.WalletAmount).Error; err != nil {
-			return fmt.Errorf("failed to update seller wallet amount: %w", err)
-		}
+	sellerReason := "Refund due to user-initiated return/cancellation"
+	if isSeller {
+		userID = order.UserID
+		sellerReason = "Refund for order cancellation initiated by seller"
+	}
 
-		sellerWalletTransaction := models.SellerWallet{
-			TransactionTime: time.Now(),
-			Type:            "outgoing",
-			OrderID:         order.OrderID,
-			SellerID:        seller.ID,
-			Amount:          RoundDecimalValue(amount),
-			CurrentBalance:  RoundDecimalValue(seller.WalletAmount),
-			Reason:          "Refund due to user-initiated return/cancellation",
-		}
+	from, status, err := sellerRefundAccount(tx, order.OrderID, amount)
+	if err != nil {
+		return err
+	}
 
-		if err := tx.Create(&sellerWalletTransaction).Error; err != nil {
-			return fmt.Errorf("failed to create seller wallet transaction: %w", err)
-		}
+	if err := returnCommission(tx, order.OrderID, amount, orderTotal, from, status); err != nil {
+		return err
+	}
 
-		return nil
+	if _, err := IssueRefund(tx, order, userID, amount, reason, destination, from); err != nil {
+		return err
 	}
 
-	var seller models.Seller
-	if err := tx.Where("id = ?", order.SellerID).First(&seller).Error; err != nil {
-		return fmt.Errorf("failed to find seller with ID %d: %w", order.SellerID, err)
+	return recordSellerWalletTransaction(tx, order.SellerID, order.OrderID, models.WalletOutgoing, status, RoundDecimalValue(amount), sellerReason)
+}
+
+// recordSellerWalletTransaction writes a line of the seller's wallet history
+// along with the available and pending balances left after it.
+func recordSellerWalletTransaction(tx *gorm.DB, sellerID, orderID uint, walletType, status string, amount float64, reason string) error {
+	available, err := LedgerBalance(tx, SellerWalletAccount(sellerID))
+	if err != nil {
+		return err
 	}
 
-	seller.WalletAmount -= amount
-	if err := tx.Model(&seller).Update("wallet_amount", seller.WalletAmount).Error; err != nil {
-		return fmt.Errorf("failed to update seller wallet amount: %w", err)
+	pending, err := LedgerBalance(tx, SellerEscrowAccount(sellerID))
+	if err != nil {
+		return err
 	}
 
-	sellerWalletTransaction := models.SellerWallet{
+	sellerWallet := models.SellerWallet{
 		TransactionTime: time.Now(),
-		Type:            "outgoing",
-		OrderID:         order.OrderID,
-		SellerID:        seller.ID,
-		Amount:          RoundDecimalValue(amount),
-		CurrentBalance:  RoundDecimalValue(seller.WalletAmount),
-		Reason:          "Refund for order cancellation initiated by seller",
+		Type:            walletType,
+		OrderID:         orderID,
+		SellerID:        sellerID,
+		Amount:          amount,
+		CurrentBalance:  available,
+		PendingBalance:  pending,
+		Status:          status,
+		Reason:          reason,
 	}
-
-	if err := tx.Create(&sellerWalletTransaction).Error; err != nil {
+	if err := tx.Create(&sellerWallet).Error; err != nil {
 		return fmt.Errorf("failed to create seller wallet transaction: %w", err)
 	}
+	return nil
+}
+
+// newWalletPaymentID returns a reference for a wallet transaction. The random
+// suffix keeps references apart when several are written in the same second,
+// as a referral credits both users at once.
+func newWalletPaymentID() string {
+	suffix := make([]byte, 4)
+	if _, err := rand.Read(suffix); err != nil {
+		return fmt.Sprintf("WALLET_%d", time.Now().UnixNano())
+	}
+	return fmt.Sprintf("WALLET_%d_%s", time.Now().Unix(), hex.EncodeToString(suffix))
+}
 
-	UserIDstr := order.UserID
+// CreditUserWallet moves amount from the given ledger account into the user's
+// wallet and records it in the wallet history.
+func CreditUserWallet(tx *gorm.DB, userID uint, orderIDStr string, amount float64, reason string, from LedgerAccountRef) error {
+	amount = RoundDecimalValue(amount)
+	walletPaymentID := newWalletPaymentID()
 
-	var wallet models.UserWallet
-	err = tx.Where("user_id = ?", UserIDstr).First(&wallet).Error
+	if _, err := PostJournalEntry(tx, walletPaymentID, reason,
+		LedgerLine{Account: from, Amount: -amount},
+		LedgerLine{Account: UserWalletAccount(userID), Amount: amount},
+	); err != nil {
+		return err
+	}
+
+	balance, err := LedgerBalance(tx, UserWalletAccount(userID))
 	if err != nil {
-		if errors.Is(err, gorm.ErrRecordNotFound) {
-			wallet = models.UserWallet{
-				UserID:         UserIDstr,
-				CurrentBalance: RoundDecimalValue(amount),
-			}
-			if err := tx.Create(&wallet).Error; err != nil {
-				return fmt.Errorf("failed to create new wallet: %w", err)
-			}
-		} else {
-			return fmt.Errorf("failed to retrieve wallet: %w", err)
-		}
-	} else {
-		wallet.CurrentBalance += amount
+		return err
 	}
 
 	walletTransaction := models.UserWallet{
-		UserID:          UserIDstr,
-		WalletPaymentID: fmt.Sprintf("WALLET_%d", time.Now().Unix()),
-		Type:            "incoming",
+		UserID:          userID,
+		WalletPaymentID: walletPaymentID,
+		Type:            models.WalletIncoming,
 		OrderID:         orderIDStr,
-		Amount:          RoundDecimalValue(amount),
-		CurrentBalance:  RoundDecimalValue(wallet.CurrentBalance),
+		Amount:          amount,
+		CurrentBalance:  balance,
 		Reason:          reason,
 		TransactionTime: time.Now(),
 	}
@@ -202,130 +163,97 @@ func RefundToUser(tx *gorm.DB, userID uint, orderIDStr string, amount float64, r
 		return fmt.Errorf("failed to create wallet transaction: %w", err)
 	}
 
-	if err := tx.Model(&wallet).Where("user_id = ?", userID).Update("current_balance", wallet.CurrentBalance).Error; err != nil {
-		return fmt.Errorf("failed to update wallet balance: %w", err)
-	}
-
-	fmt.Println("wallet amount")
-	fmt.Println(wallet.CurrentBalance)
-
-	if err := tx.Model(&models.User{}).Where("id = ?", userID).Update("wallet_amount", wallet.CurrentBalance).Error; err != nil {
-		return fmt.Errorf("failed to update user wallet balance: %w", err)
-	}
-
 	return nil
 }
 
-func ProcessWalletPayment(userID uint, orderIDStr string, tx *gorm.DB) (models.UserWallet, error) {
+func ProcessWalletPayment(userID uint, checkoutID uint, tx *gorm.DB) (models.UserWallet, error) {
 	var user models.User
 	if err := tx.Where("id = ?", userID).First(&user).Error; err != nil {
 		return models.UserWallet{}, fmt.Errorf("failed to find user with ID %d: %v", userID, err)
 	}
 
-	var order models.Order
-	if err := tx.Where("order_id = ? AND user_id = ?", orderIDStr, userID).First(&order).Error; err != nil {
-		return models.UserWallet{}, fmt.Errorf("failed to find order %s for user %d: %v", orderIDStr, userID, err)
+	var checkout models.Checkout
+	if err := tx.Where("checkout_id = ? AND user_id = ?", checkoutID, userID).First(&checkout).Error; err != nil {
+		return models.UserWallet{}, fmt.Errorf("failed to find checkout %d for user %d: %v", checkoutID, userID, err)
 	}
 
-	if order.FinalAmount > user.WalletAmount {
-		return models.UserWallet{}, fmt.Errorf("insufficient wallet balance to pay for this order")
+	if checkout.PaymentMethod != models.Wallet {
+		return models.UserWallet{}, fmt.Errorf("incorrect payment method for wallet processing")
 	}
 
-	if order.PaymentMethod != models.Wallet {
-		return models.UserWallet{}, fmt.Errorf("incorrect payment method for wallet processing")
+	var orders []models.Order
+	if err := tx.Where("checkout_id = ?", checkoutID).Find(&orders).Error; err != nil {
+		return models.UserWallet{}, fmt.Errorf("failed to find orders for checkout %d", checkoutID)
 	}
 
-	newBalance := user.WalletAmount - order.FinalAmount
-	if err := tx.Model(&user).Update("wallet_amount", newBalance).Error; err != nil {
+	// the buyer is charged exactly what the sellers are credited, so the
+	// entry balances even when the checkout total was rounded differently
+	orderIDs := make([]string, len(orders))
+	lines := make([]LedgerLine, 0, len(orders)+1)
+	var amount float64
+	for i, order := range orders {
+		orderIDs[i] = strconv.Itoa(int(order.OrderID))
+		orderAmount := RoundDecimalValue(order.FinalAmount)
+		amount += orderAmount
+		lines = append(lines, LedgerLine{Account: SellerEscrowAccount(order.SellerID), Amount: orderAmount})
+	}
+	amount = RoundDecimalValue(amount)
+	lines = append(lines, LedgerLine{Account: UserWalletAccount(userID), Amount: -amount})
+
+	walletPaymentID := newWalletPaymentID()
+	if _, err := PostJournalEntry(tx, walletPaymentID, "Order payment using wallet", lines...); err != nil {
+		if errors.Is(err, ErrInsufficientWalletFunds) {
+			return models.UserWallet{}, fmt.Errorf("insufficient wallet balance to pay for this order")
+		}
+		return models.UserWallet{}, fmt.Errorf("failed to update user wallet balance")
+	}
+
+	newBalance, err := LedgerBalance(tx, UserWalletAccount(userID))
+	if err != nil {
 		return models.UserWallet{}, fmt.Errorf("failed to update user wallet balance")
 	}
 
 	newUserWallet := models.UserWallet{
 		UserID:          userID,
-		WalletPaymentID: fmt.Sprintf("WALLET_%d", time.Now().Unix()),
-		Type:            "outgoing",
-		OrderID:         orderIDStr,
-		Amount:          order.FinalAmount,
-		CurrentBalance:  RoundDecimalValue(newBalance),
+		WalletPaymentID: walletPaymentID,
+		Type:            models.WalletOutgoing,
+		OrderID:         strings.Join(orderIDs, ","),
+		Amount:          amount,
+		CurrentBalance:  newBalance,
 		Reason:          "Order payment using wallet",
 		TransactionTime: time.Now(),
 	}
 	if err := tx.Create(&newUserWallet).Error; err != nil {
-		tx.Rollback()
 		return models.UserWallet{}, fmt.Errorf("failed to create user wallet transaction record")
 	}
 
-	var seller models.Seller
-	if err := tx.Where("id = ?", order.SellerID).First(&seller).Error; err != nil {
-		tx.Rollback()
-		return models.UserWallet{}, fmt.Errorf("failed to find seller with ID %d", order.SellerID)
-	}
-
-	newSellerBalance := seller.WalletAmount + order.FinalAmount
-	if err := tx.Model(&seller).Update("wallet_amount", newSellerBalance).Error; err != nil {
-		tx.Rollback()
-		return models.UserWallet{}, fmt.Errorf("failed to update seller wallet balance")
-	}
-
-	newSellerWallet := models.SellerWallet{
-		TransactionTime: time.Now(),
-		Type:            "incoming",
-		OrderID:         order.OrderID,
-		SellerID:        seller.ID,
-		Amount:          order.FinalAmount,
-		CurrentBalance:  RoundDecimalValue(newSellerBalance),
-		Reason:          "Order payment credited",
-	}
-	if err := tx.Create(&newSellerWallet).Error; err != nil {
-		tx.Rollback()
-		return models.UserWallet{}, fmt.Errorf("failed to create seller wallet transaction record")
-	}
-
-	payment := models.Payment{
-		OrderID:         orderIDStr,
-		WalletPaymentID: newUserWallet.WalletPaymentID,
-		PaymentGateway:  models.Wallet,
-		PaymentStatus:   models.PaymentStatusPaid,
-	}
-	if err := tx.Create(&payment).Error; err != nil {
-		tx.Rollback()
-		return models.UserWallet{}, fmt.Errorf("failed to create payment record")
-	}
-
-	order.PaymentStatus = models.PaymentStatusPaid
-	order.Status = models.OrderStatusConfirmed
-	if err := tx.Model(&order).Updates(map[string]interface{}{
-		"status":         order.Status,
-		"payment_status": order.PaymentStatus,
-	}).Error; err != nil {
-		tx.Rollback()
-		return models.UserWallet{}, fmt.Errorf("failed to update payment and order status")
-	}
+	for _, order := range orders {
+		if err := holdOrderProceeds(tx, order, RoundDecimalValue(order.FinalAmount)); err != nil {
+			return models.UserWallet{}, fmt.Errorf("failed to create seller wallet transaction record")
+		}
 
-	var orderItems []models.OrderItem
-	if err := tx.Where("order_id = ?", orderIDStr).Find(&orderItems).Error; err != nil {
-		tx.Rollback()
-		return models.UserWallet{}, fmt.Errorf("failed to find the order items")
-	}
+		payment := models.Payment{
+			OrderID:         strconv.Itoa(int(order.OrderID)),
+			CheckoutID:      checkoutID,
+			WalletPaymentID: newUserWallet.WalletPaymentID,
+			PaymentGateway:  models.Wallet,
+			PaymentStatus:   models.PaymentStatusPaid,
+			AmountPaid:      order.FinalAmount,
+		}
+		if err := tx.Create(&payment).Error; err != nil {
+			return models.UserWallet{}, fmt.Errorf("failed to create payment record")
+		}
 
-	for _, orderItem := range orderItems {
-		orderItem.Status = models.OrderStatusConfirmed
-		if err := tx.Model(&orderItem).Update("status", orderItem.Status).Error; err != nil {
-			tx.Rollback()
-			return models.UserWallet{}, fmt.Errorf("failed to update order item status for item ID %d", orderItem.ProductID)
+		if err := ConfirmOrderPayment(tx, &order, OrderActor{Role: models.ActorUser, ID: userID}, "paid from wallet"); err != nil {
+			return models.UserWallet{}, fmt.Errorf("failed to update payment and order status")
 		}
 	}
 
-	for _, orderItem := range orderItems {
-		if err := tx.Model(&models.Product{}).
-			Where("id = ?", orderItem.ProductID).
-			Update("availability", false).Error; err != nil {
-			tx.Rollback()
-			return models.UserWallet{}, fmt.Errorf("failed to update product availability for product ID %d", orderItem.ProductID)
-		}
+	if err := tx.Model(&checkout).Update("payment_status", models.PaymentStatusPaid).Error; err != nil {
+		return models.UserWallet{}, fmt.Errorf("failed to update checkout payment status")
 	}
+
 	if err := tx.Where("user_id = ?", userID).Delete(&models.Cart{}).Error; err != nil {
-		tx.Rollback()
 		return models.UserWallet{}, fmt.Errorf("failed to delete user's cart")
 	}
 
@@ -350,8 +278,44 @@ func GetUserWalletHistory(c *gin.Context) {
 		})
 		return
 	}
+	pageRequest, err := utils.ParsePageRequest(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"status": "failed",
+			"error":  err.Error(),
+		})
+		return
+	}
+
 	var walletHistory []models.UserWallet
-	if err := database.DB.Where("user_id = ?", uint(userIDUint)).Order("transaction_time desc").Find(&walletHistory).Error; err != nil {
+	query := database.DB.Model(&models.UserWallet{}).Where("user_id = ?", uint(userIDUint))
+
+	if transactionType := c.Query("type"); transactionType != "" {
+		query = query.Where("type = ?", strings.ToUpper(transactionType))
+	}
+
+	totalCount, err := pageRequest.Count(query)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":  "Failed to count wallet history",
+			"status": "failed",
+		})
+		return
+	}
+
+	// entries are written in time order and ids never repeat, unlike
+	// transaction times, so the id is what the cursor points at
+	var lastID uint
+	query, err = pageRequest.Apply(query, "id", true, &lastID)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"status": "failed",
+			"error":  err.Error(),
+		})
+		return
+	}
+
+	if err := query.Find(&walletHistory).Error; err != nil {
 		if err == gorm.ErrRecordNotFound {
 			c.JSON(http.StatusNotFound, gin.H{
 				"status": "failed",
@@ -366,9 +330,20 @@ func GetUserWalletHistory(c *gin.Context) {
 		return
 	}
 
+	hasMore := pageRequest.HasMore(len(walletHistory), totalCount)
+	if pageRequest.CursorMode && hasMore {
+		walletHistory = walletHistory[:pageRequest.Limit]
+	}
+
+	var nextCursor string
+	if len(walletHistory) > 0 {
+		nextCursor = utils.EncodeCursor(walletHistory[len(walletHistory)-1].ID)
+	}
+
 	c.JSON(http.StatusOK, gin.H{
 		"status":         "success",
 		"wallet_history": walletHistory,
+		"pagination":     utils.NewPageInfo(c, pageRequest, totalCount, hasMore, nextCursor),
 	})
 }
 
@@ -390,8 +365,59 @@ func GetSellerWalletHistory(c *gin.Context) {
 		})
 		return
 	}
+	pageRequest, err := utils.ParsePageRequest(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"status": "failed",
+			"error":  err.Error(),
+		})
+		return
+	}
+
 	var walletHistory []models.SellerWallet
-	if err := database.DB.Where("seller_id = ?", uint(sellerIDUint)).Order("transaction_time desc").Find(&walletHistory).Error; err != nil {
+	query := database.DB.Model(&models.SellerWallet{}).Where("seller_id = ?", uint(sellerIDUint))
+
+	if transactionType := c.Query("type"); transactionType != "" {
+		query = query.Where("type = ?", strings.ToUpper(transactionType))
+	}
+	if status := c.Query("status"); status != "" {
+		query = query.Where("status = ?", status)
+	}
+
+	balances := map[string]float64{}
+	var accounts []models.LedgerAccount
+	if err := database.DB.Where("owner_id = ? AND type IN ?", sellerIDUint, []string{models.LedgerSellerWallet, models.LedgerSellerEscrow}).
+		Find(&accounts).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":  "Failed to fetch wallet balance",
+			"status": "failed",
+		})
+		return
+	}
+	for _, account := range accounts {
+		balances[account.Type] = account.Balance
+	}
+
+	totalCount, err := pageRequest.Count(query)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":  "Failed to count wallet history",
+			"status": "failed",
+		})
+		return
+	}
+
+	var lastID uint
+	query, err = pageRequest.Apply(query, "id", true, &lastID)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"status": "failed",
+			"error":  err.Error(),
+		})
+		return
+	}
+
+	if err := query.Find(&walletHistory).Error; err != nil {
 		if err == gorm.ErrRecordNotFound {
 			c.JSON(http.StatusNotFound, gin.H{
 				"status": "failed",
@@ -406,8 +432,21 @@ func GetSellerWalletHistory(c *gin.Context) {
 		return
 	}
 
+	hasMore := pageRequest.HasMore(len(walletHistory), totalCount)
+	if pageRequest.CursorMode && hasMore {
+		walletHistory = walletHistory[:pageRequest.Limit]
+	}
+
+	var nextCursor string
+	if len(walletHistory) > 0 {
+		nextCursor = utils.EncodeCursor(walletHistory[len(walletHistory)-1].ID)
+	}
+
 	c.JSON(http.StatusOK, gin.H{
-		"status":         "success",
-		"wallet_history": walletHistory,
+		"status":            "success",
+		"available_balance": balances[models.LedgerSellerWallet],
+		"pending_balance":   balances[models.LedgerSellerEscrow],
+		"wallet_history":    walletHistory,
+		"pagination":        utils.NewPageInfo(c, pageRequest, totalCount, hasMore, nextCursor),
 	})
 }
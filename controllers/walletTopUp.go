@@ -0,0 +1,441 @@
+package controllers
+
+import (
+	"errors"
+	"fmt"
+	database "knowledgeMart/config"
+	"knowledgeMart/models"
+	"knowledgeMart/payments"
+	"math"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-playground/validator/v10"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var ErrTopUpExpired = errors.New("wallet top-up expired before the payment was completed")
+
+const (
+	defaultTopUpDailyLimit   = 10000
+	defaultTopUpMonthlyLimit = 50000
+)
+
+// TopUpLimits returns how much a user may add to their wallet in a day and in
+// a month, configured through WALLET_TOPUP_DAILY_LIMIT and
+// WALLET_TOPUP_MONTHLY_LIMIT.
+func TopUpLimits() (daily, monthly float64) {
+	daily, err := strconv.ParseFloat(os.Getenv("WALLET_TOPUP_DAILY_LIMIT"), 64)
+	if err != nil || daily <= 0 {
+		daily = defaultTopUpDailyLimit
+	}
+	monthly, err = strconv.ParseFloat(os.Getenv("WALLET_TOPUP_MONTHLY_LIMIT"), 64)
+	if err != nil || monthly <= 0 {
+		monthly = defaultTopUpMonthlyLimit
+	}
+	return daily, monthly
+}
+
+// toppedUpSince totals the user's completed top-ups since the given time,
+// along with pending ones still young enough to be paid.
+func toppedUpSince(tx *gorm.DB, userID uint, since time.Time) (float64, error) {
+	var total float64
+	if err := tx.Model(&models.WalletTopUp{}).
+		Where("user_id = ? AND created_at >= ?", userID, since).
+		Where("status = ? OR (status = ? AND created_at >= ?)", models.TopUpStatusCompleted, models.TopUpStatusPending, time.Now().Add(-PaymentTimeout())).
+		Select("COALESCE(SUM(amount), 0)").
+		Scan(&total).Error; err != nil {
+		return 0, fmt.Errorf("failed to calculate wallet top-ups: %w", err)
+	}
+	return total, nil
+}
+
+func CreateWalletTopUp(c *gin.Context) {
+	userID, exists := c.Get("userID")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{
+			"status":  "failed",
+			"message": "user not authorized",
+		})
+		return
+	}
+
+	userIDUint, ok := userID.(uint)
+	if !ok {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"status":  "failed",
+			"message": "failed to retrieve user information",
+		})
+		return
+	}
+
+	var request models.WalletTopUpRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"status":  "failed",
+			"message": "failed to process the incoming request",
+		})
+		return
+	}
+
+	validate := validator.New()
+	if err := validate.Struct(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"status":  "failed",
+			"message": err.Error(),
+		})
+		return
+	}
+
+	amount := RoundDecimalValue(request.Amount)
+	dailyLimit, monthlyLimit := TopUpLimits()
+
+	now := time.Now()
+	startOfDay := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+	startOfMonth := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, now.Location())
+
+	// the wallet account stays locked until the top-up is stored, so two
+	// requests at once cannot both pass the limit check
+	tx := database.DB.Begin()
+
+	if _, err := lockLedgerAccount(tx, UserWalletAccount(userIDUint)); err != nil {
+		tx.Rollback()
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"status":  "failed",
+			"message": err.Error(),
+		})
+		return
+	}
+
+	today, err := toppedUpSince(tx, userIDUint, startOfDay)
+	if err != nil {
+		tx.Rollback()
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"status":  "failed",
+			"message": err.Error(),
+		})
+		return
+	}
+	if today+amount > dailyLimit {
+		tx.Rollback()
+		c.JSON(http.StatusBadRequest, gin.H{
+			"status":  "failed",
+			"message": fmt.Sprintf("daily top-up limit is %.2f, you can add %.2f more today", dailyLimit, math.Max(dailyLimit-today, 0)),
+		})
+		return
+	}
+
+	thisMonth, err := toppedUpSince(tx, userIDUint, startOfMonth)
+	if err != nil {
+		tx.Rollback()
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"status":  "failed",
+			"message": err.Error(),
+		})
+		return
+	}
+	if thisMonth+amount > monthlyLimit {
+		tx.Rollback()
+		c.JSON(http.StatusBadRequest, gin.H{
+			"status":  "failed",
+			"message": fmt.Sprintf("monthly top-up limit is %.2f, you can add %.2f more this month", monthlyLimit, math.Max(monthlyLimit-thisMonth, 0)),
+		})
+		return
+	}
+
+	provider, err := payments.NewProvider()
+	if err != nil {
+		tx.Rollback()
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"status":  "failed",
+			"message": err.Error(),
+		})
+		return
+	}
+
+	gatewayAmount := int64(math.Round(amount * 100))
+	intent, err := provider.CreateIntent(payments.IntentRequest{
+		Amount:   gatewayAmount,
+		Currency: "INR",
+		Receipt:  fmt.Sprintf("topup_%d_%d", userIDUint, now.Unix()),
+		Notes: map[string]string{
+			"purpose": "wallet_topup",
+			"user_id": strconv.Itoa(int(userIDUint)),
+		},
+	})
+	if err != nil {
+		tx.Rollback()
+		c.JSON(http.StatusBadGateway, gin.H{
+			"status":  "failed",
+			"message": "failed to create payment order",
+		})
+		return
+	}
+
+	topUp := models.WalletTopUp{
+		UserID:         userIDUint,
+		Amount:         amount,
+		GatewayAmount:  gatewayAmount,
+		Gateway:        provider.Name(),
+		GatewayOrderID: intent.ID,
+		Status:         models.TopUpStatusPending,
+	}
+	if err := tx.Create(&topUp).Error; err != nil {
+		tx.Rollback()
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"status":  "failed",
+			"message": "failed to create wallet top-up",
+		})
+		return
+	}
+
+	if err := tx.Commit().Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"status":  "failed",
+			"message": "failed to commit transaction",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"status":  "success",
+		"message": "wallet top-up created, complete the payment to add money",
+		"data": gin.H{
+			"topup_id":    topUp.ID,
+			"order_id":    intent.ID,
+			"amount":      topUp.GatewayAmount,
+			"currency":    "INR",
+			"provider":    provider.Name(),
+			"client_data": provider.ClientData(intent.ID),
+		},
+	})
+}
+
+func VerifyWalletTopUp(c *gin.Context) {
+	userID, exists := c.Get("userID")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{
+			"status":  "failed",
+			"message": "user not authorized",
+		})
+		return
+	}
+
+	userIDUint, ok := userID.(uint)
+	if !ok {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"status":  "failed",
+			"message": "failed to retrieve user information",
+		})
+		return
+	}
+
+	var request models.VerifyWalletTopUpRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"status":  "failed",
+			"message": "failed to process the incoming request",
+		})
+		return
+	}
+
+	validate := validator.New()
+	if err := validate.Struct(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"status":  "failed",
+			"message": err.Error(),
+		})
+		return
+	}
+
+	var topUp models.WalletTopUp
+	if err := database.DB.Where("gateway_order_id = ? AND user_id = ?", request.OrderID, userIDUint).First(&topUp).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{
+			"status":  "failed",
+			"message": "wallet top-up not found",
+		})
+		return
+	}
+
+	provider, err := payments.ProviderFor(topUp.Gateway)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"status":  "failed",
+			"message": err.Error(),
+		})
+		return
+	}
+
+	if err := provider.VerifyPayment(payments.Verification{
+		IntentID:  request.OrderID,
+		PaymentID: request.PaymentID,
+		Signature: request.Signature,
+	}); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"status":  "failed",
+			"message": "payment verification failed",
+		})
+		return
+	}
+
+	gatewayPayment, err := provider.FetchStatus(request.PaymentID)
+	if err != nil {
+		c.JSON(http.StatusBadGateway, gin.H{
+			"status":  "failed",
+			"message": "failed to fetch payment from the gateway",
+		})
+		return
+	}
+	if gatewayPayment.IntentID != request.OrderID {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"status":  "failed",
+			"message": "payment does not belong to this top-up",
+		})
+		return
+	}
+	if gatewayPayment.Status != payments.PaymentCaptured {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"status":  "failed",
+			"message": "payment has not been captured",
+		})
+		return
+	}
+
+	tx := database.DB.Begin()
+
+	alreadyCompleted, err := completeWalletTopUp(tx, request.OrderID, request.PaymentID, gatewayPayment.Amount)
+	if errors.Is(err, ErrTopUpExpired) {
+		if err := tx.Commit().Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"status":  "failed",
+				"message": "failed to commit transaction",
+			})
+			return
+		}
+		c.JSON(http.StatusGone, gin.H{
+			"status":  "failed",
+			"message": "this top-up expired before the payment completed, the amount has been refunded",
+		})
+		return
+	}
+	if err != nil {
+		tx.Rollback()
+		status := http.StatusInternalServerError
+		if errors.Is(err, ErrPaymentMismatch) {
+			status = http.StatusBadRequest
+		}
+		c.JSON(status, gin.H{
+			"status":  "failed",
+			"message": err.Error(),
+		})
+		return
+	}
+
+	balance, err := LedgerBalance(tx, UserWalletAccount(userIDUint))
+	if err != nil {
+		tx.Rollback()
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"status":  "failed",
+			"message": err.Error(),
+		})
+		return
+	}
+
+	if err := tx.Commit().Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"status":  "failed",
+			"message": "failed to commit transaction",
+		})
+		return
+	}
+
+	message := "money added to wallet successfully"
+	if alreadyCompleted {
+		message = "money was already added to wallet"
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"status":  "success",
+		"message": message,
+		"data": gin.H{
+			"topup_id":       topUp.ID,
+			"amount":         topUp.Amount,
+			"wallet_balance": balance,
+		},
+	})
+}
+
+// completeWalletTopUp credits the user's wallet for a captured top-up payment.
+// Both the verification callback and the webhook end up here, so a top-up that
+// is already completed is left untouched and reported through the flag. A
+// top-up paid after PaymentTimeout no longer counts against the limits, so it
+// is expired and the payment refunded instead of credited.
+func completeWalletTopUp(tx *gorm.DB, gatewayOrderID, gatewayPaymentID string, amountPaid int64) (bool, error) {
+	var topUp models.WalletTopUp
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+		Where("gateway_order_id = ?", gatewayOrderID).
+		First(&topUp).Error; err != nil {
+		return false, fmt.Errorf("wallet top-up not found")
+	}
+
+	if topUp.Status == models.TopUpStatusCompleted {
+		return true, nil
+	}
+
+	if amountPaid != topUp.GatewayAmount {
+		return false, fmt.Errorf("%w: paid %d, expected %d", ErrPaymentMismatch, amountPaid, topUp.GatewayAmount)
+	}
+
+	if topUp.Status == models.TopUpStatusExpired || time.Since(topUp.CreatedAt) > PaymentTimeout() {
+		if topUp.Status != models.TopUpStatusExpired || topUp.GatewayPaymentID != gatewayPaymentID {
+			if err := refundExpiredPayment(tx, topUp.UserID, 0, topUp.Gateway, gatewayPaymentID, amountPaid, "wallet top-up expired"); err != nil {
+				return false, fmt.Errorf("failed to refund payment for expired wallet top-up: %w", err)
+			}
+			if err := tx.Model(&topUp).Updates(map[string]interface{}{
+				"status":             models.TopUpStatusExpired,
+				"gateway_payment_id": gatewayPaymentID,
+			}).Error; err != nil {
+				return false, fmt.Errorf("failed to update wallet top-up: %w", err)
+			}
+		}
+		return false, ErrTopUpExpired
+	}
+
+	reason := "Wallet top-up"
+	if _, err := PostJournalEntry(tx, fmt.Sprintf("TOPUP_%d", topUp.ID), reason,
+		LedgerLine{Account: PlatformAccount(models.LedgerGatewayClearing), Amount: -topUp.Amount},
+		LedgerLine{Account: UserWalletAccount(topUp.UserID), Amount: topUp.Amount},
+	); err != nil {
+		return false, err
+	}
+
+	balance, err := LedgerBalance(tx, UserWalletAccount(topUp.UserID))
+	if err != nil {
+		return false, err
+	}
+
+	walletTransaction := models.UserWallet{
+		UserID:          topUp.UserID,
+		WalletPaymentID: gatewayPaymentID,
+		Type:            models.WalletIncoming,
+		Amount:          topUp.Amount,
+		CurrentBalance:  balance,
+		Reason:          reason,
+		TransactionTime: time.Now(),
+	}
+	if err := tx.Create(&walletTransaction).Error; err != nil {
+		return false, fmt.Errorf("failed to create wallet transaction: %w", err)
+	}
+
+	if err := tx.Model(&topUp).Updates(map[string]interface{}{
+		"status":             models.TopUpStatusCompleted,
+		"gateway_payment_id": gatewayPaymentID,
+	}).Error; err != nil {
+		return false, fmt.Errorf("failed to update wallet top-up: %w", err)
+	}
+
+	return false, nil
+}
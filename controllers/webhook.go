@@ -0,0 +1,292 @@
+package controllers
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	database "knowledgeMart/config"
+	"knowledgeMart/models"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+type razorpayWebhookEvent struct {
+	Event   string `json:"event"`
+	Payload struct {
+		Payment struct {
+			Entity razorpayPaymentEntity `json:"entity"`
+		} `json:"payment"`
+		Refund struct {
+			Entity razorpayRefundEntity `json:"entity"`
+		} `json:"refund"`
+	} `json:"payload"`
+}
+
+type razorpayPaymentEntity struct {
+	ID      string `json:"id"`
+	OrderID string `json:"order_id"`
+	Amount  int64  `json:"amount"`
+	Status  string `json:"status"`
+	// Razorpay sends notes as an object, or as an empty array when unset.
+	Notes json.RawMessage `json:"notes"`
+}
+
+type razorpayRefundEntity struct {
+	ID        string `json:"id"`
+	PaymentID string `json:"payment_id"`
+	Amount    int64  `json:"amount"`
+	Status    string `json:"status"`
+}
+
+var errWebhookCheckoutNotFound = errors.New("checkout not found for this payment")
+
+func RazorpayWebhook(c *gin.Context) {
+	body, err := io.ReadAll(c.Request.Body)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"status": "failed", "message": "failed to read request body"})
+		return
+	}
+
+	secret := os.Getenv("RAZORPAY_WEBHOOK_SECRET")
+	if secret == "" {
+		log.Println("RAZORPAY_WEBHOOK_SECRET is not configured")
+		c.JSON(http.StatusInternalServerError, gin.H{"status": "failed", "message": "webhook is not configured"})
+		return
+	}
+
+	if !verifyWebhookSignature(body, c.GetHeader("X-Razorpay-Signature"), secret) {
+		c.JSON(http.StatusBadRequest, gin.H{"status": "failed", "message": "invalid webhook signature"})
+		return
+	}
+
+	var event razorpayWebhookEvent
+	if err := json.Unmarshal(body, &event); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"status": "failed", "message": "invalid webhook payload"})
+		return
+	}
+
+	eventID := c.GetHeader("X-Razorpay-Event-Id")
+	if eventID != "" {
+		var processed int64
+		if err := database.DB.Model(&models.WebhookEvent{}).
+			Where("provider = ? AND event_id = ?", models.Razorpay, eventID).
+			Count(&processed).Error; err == nil && processed > 0 {
+			c.JSON(http.StatusOK, gin.H{"status": "success", "message": "event already processed"})
+			return
+		}
+	}
+
+	tx := database.DB.Begin()
+
+	var result string
+	switch event.Event {
+	case "payment.captured":
+		result, err = handleRazorpayPaymentCaptured(tx, event.Payload.Payment.Entity)
+	case "payment.failed":
+		result, err = handleRazorpayPaymentFailed(tx, event.Payload.Payment.Entity)
+	case "refund.processed":
+		result, err = handleRazorpayRefundProcessed(tx, event.Payload.Refund.Entity)
+	case "refund.failed":
+		result, err = handleRazorpayRefundFailed(tx, event.Payload.Refund.Entity)
+	default:
+		result = "event ignored"
+	}
+
+	if err != nil {
+		tx.Rollback()
+		log.Printf("razorpay webhook %s failed: %v", event.Event, err)
+		status := http.StatusInternalServerError
+		if errors.Is(err, errWebhookCheckoutNotFound) {
+			status = http.StatusNotFound
+		} else if errors.Is(err, ErrPaymentMismatch) {
+			status = http.StatusBadRequest
+		}
+		c.JSON(status, gin.H{"status": "failed", "message": err.Error()})
+		return
+	}
+
+	if eventID != "" {
+		if err := tx.Create(&models.WebhookEvent{
+			Provider: models.Razorpay,
+			EventID:  eventID,
+			Event:    event.Event,
+		}).Error; err != nil {
+			tx.Rollback()
+			c.JSON(http.StatusInternalServerError, gin.H{"status": "failed", "message": "failed to record webhook event"})
+			return
+		}
+	}
+
+	if err := tx.Commit().Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"status": "failed", "message": "failed to commit transaction"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"status": "success", "message": result})
+}
+
+func verifyWebhookSignature(body []byte, signature, secret string) bool {
+	h := hmac.New(sha256.New, []byte(secret))
+	h.Write(body)
+	expectedSignature := hex.EncodeToString(h.Sum(nil))
+
+	return hmac.Equal([]byte(expectedSignature), []byte(signature))
+}
+
+func handleRazorpayPaymentCaptured(tx *gorm.DB, payment razorpayPaymentEntity) (string, error) {
+	if isWalletTopUp(tx, payment.OrderID) {
+		alreadyCompleted, err := completeWalletTopUp(tx, payment.OrderID, payment.ID, payment.Amount)
+		if errors.Is(err, ErrTopUpExpired) {
+			return "wallet top-up expired, payment refunded", nil
+		}
+		if err != nil {
+			return "", err
+		}
+		if alreadyCompleted {
+			return "wallet top-up already completed", nil
+		}
+		return "wallet top-up completed", nil
+	}
+
+	checkoutID, err := razorpayCheckoutID(tx, payment)
+	if err != nil {
+		return "", err
+	}
+
+	alreadyPaid, err := confirmGatewayCheckout(tx, checkoutID, models.Razorpay, payment.OrderID, payment.ID, "", payment.Amount)
+	if errors.Is(err, ErrCheckoutExpired) {
+		return "checkout expired, payment refunded", nil
+	}
+	if err != nil {
+		return "", err
+	}
+	if alreadyPaid {
+		return "checkout already paid", nil
+	}
+	return "checkout confirmed", nil
+}
+
+// handleRazorpayPaymentFailed keeps a record of the failed gateway payment. The
+// retry counter is left to the checkout page, which also reports dismissals
+// that never reach Razorpay.
+func handleRazorpayPaymentFailed(tx *gorm.DB, payment razorpayPaymentEntity) (string, error) {
+	if isWalletTopUp(tx, payment.OrderID) {
+		// the user may still retry the same top-up order, so it stays pending
+		// unless it was already completed by another payment
+		return "wallet top-up payment failed", nil
+	}
+
+	checkoutID, err := razorpayCheckoutID(tx, payment)
+	if err != nil {
+		return "", err
+	}
+
+	var existing int64
+	if err := tx.Model(&models.Payment{}).
+		Where("razorpay_payment_id = ?", payment.ID).
+		Count(&existing).Error; err != nil {
+		return "", fmt.Errorf("failed to check payment records: %w", err)
+	}
+	if existing > 0 {
+		return "payment already recorded", nil
+	}
+
+	failedPayment := models.Payment{
+		OrderID:           "",
+		CheckoutID:        checkoutID,
+		RazorpayOrderID:   payment.OrderID,
+		RazorpayPaymentID: payment.ID,
+		PaymentGateway:    models.Razorpay,
+		PaymentStatus:     models.PaymentStatusFailed,
+		AmountPaid:        0,
+	}
+	if err := tx.Create(&failedPayment).Error; err != nil {
+		return "", fmt.Errorf("failed to create payment record: %w", err)
+	}
+
+	return "failed payment recorded", nil
+}
+
+// handleRazorpayRefundProcessed settles refunds we started. Refunds issued
+// from the Razorpay dashboard have no record here, so the payment itself is
+// marked refunded.
+func handleRazorpayRefundProcessed(tx *gorm.DB, refund razorpayRefundEntity) (string, error) {
+	tracked, err := MarkGatewayRefund(tx, refund.ID, models.RefundStatusProcessed, "")
+	if err != nil {
+		return "", err
+	}
+	if tracked {
+		return "refund recorded", nil
+	}
+
+	update := tx.Model(&models.Payment{}).
+		Where("razorpay_payment_id = ? AND payment_status <> ?", refund.PaymentID, models.PaymentStatusRefund).
+		Update("payment_status", models.PaymentStatusRefund)
+	if update.Error != nil {
+		return "", fmt.Errorf("failed to update payment status: %w", update.Error)
+	}
+	if update.RowsAffected == 0 {
+		return "refund already recorded", nil
+	}
+	return "refund recorded", nil
+}
+
+// razorpayCheckoutID finds the checkout a gateway payment belongs to, first
+// from the checkout_id note set on the Razorpay order and payment, then from
+// an earlier payment record for the same Razorpay order.
+func razorpayCheckoutID(tx *gorm.DB, payment razorpayPaymentEntity) (uint, error) {
+	if notes := bytes.TrimSpace(payment.Notes); len(notes) > 0 && notes[0] == '{' {
+		var values map[string]interface{}
+		if err := json.Unmarshal(notes, &values); err == nil {
+			switch checkoutID := values["checkout_id"].(type) {
+			case string:
+				if id, err := strconv.ParseUint(checkoutID, 10, 64); err == nil {
+					return uint(id), nil
+				}
+			case float64:
+				return uint(checkoutID), nil
+			}
+		}
+	}
+
+	var existing models.Payment
+	if payment.OrderID != "" {
+		if err := tx.Where("razorpay_order_id = ? AND checkout_id > 0", payment.OrderID).First(&existing).Error; err == nil {
+			return existing.CheckoutID, nil
+		}
+	}
+
+	return 0, errWebhookCheckoutNotFound
+}
+
+func handleRazorpayRefundFailed(tx *gorm.DB, refund razorpayRefundEntity) (string, error) {
+	tracked, err := MarkGatewayRefund(tx, refund.ID, models.RefundStatusFailed, "refund failed at the gateway")
+	if err != nil {
+		return "", err
+	}
+	if !tracked {
+		return "refund not found", nil
+	}
+	return "refund failure recorded", nil
+}
+
+// isWalletTopUp reports whether the Razorpay order was opened for a wallet
+// top-up rather than a checkout.
+func isWalletTopUp(tx *gorm.DB, gatewayOrderID string) bool {
+	if gatewayOrderID == "" {
+		return false
+	}
+	var count int64
+	tx.Model(&models.WalletTopUp{}).Where("gateway_order_id = ?", gatewayOrderID).Count(&count)
+	return count > 0
+}
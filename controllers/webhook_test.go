@@ -0,0 +1,556 @@
+package controllers
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	database "knowledgeMart/config"
+	"knowledgeMart/models"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+const testWebhookSecret = "test-webhook-secret"
+
+// fakeRazorpay stands in for Razorpay: it signs and delivers webhook events to
+// the app and answers the refund calls the app makes back to the API.
+type fakeRazorpay struct {
+	api *httptest.Server
+	app *httptest.Server
+
+	mu      sync.Mutex
+	refunds []map[string]interface{}
+}
+
+func newFakeRazorpay(t *testing.T) *fakeRazorpay {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+
+	fake := &fakeRazorpay{}
+
+	fake.api = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		path := strings.TrimPrefix(r.URL.Path, "/v1/payments/")
+		paymentID, isRefund := strings.CutSuffix(path, "/refund")
+		if !isRefund {
+			paymentID, isRefund = strings.CutSuffix(path, "/refunds")
+		}
+		if !isRefund || paymentID == path {
+			http.NotFound(w, r)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		fake.mu.Lock()
+		defer fake.mu.Unlock()
+
+		switch r.Method {
+		case http.MethodGet:
+			items := []interface{}{}
+			for _, refund := range fake.refunds {
+				if refund["payment_id"] == paymentID {
+					items = append(items, refund)
+				}
+			}
+			json.NewEncoder(w).Encode(map[string]interface{}{"count": len(items), "items": items})
+		case http.MethodPost:
+			var request struct {
+				Amount  int64  `json:"amount"`
+				Receipt string `json:"receipt"`
+			}
+			json.NewDecoder(r.Body).Decode(&request)
+
+			refund := map[string]interface{}{
+				"id":         fmt.Sprintf("rfnd_test_%d", len(fake.refunds)+1),
+				"payment_id": paymentID,
+				"amount":     request.Amount,
+				"receipt":    request.Receipt,
+				"status":     "processed",
+			}
+			fake.refunds = append(fake.refunds, refund)
+			json.NewEncoder(w).Encode(refund)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	t.Cleanup(fake.api.Close)
+
+	router := gin.New()
+	router.POST("/webhooks/razorpay", RazorpayWebhook)
+	fake.app = httptest.NewServer(router)
+	t.Cleanup(fake.app.Close)
+
+	t.Setenv("RAZORPAY_WEBHOOK_SECRET", testWebhookSecret)
+	t.Setenv("RAZORPAY_KEY_ID", "rzp_test_key")
+	t.Setenv("RAZORPAY_KEY_SECRET", "rzp_test_secret")
+	t.Setenv("RAZORPAY_API_URL", fake.api.URL)
+
+	return fake
+}
+
+type webhookReply struct {
+	code    int
+	Status  string `json:"status"`
+	Message string `json:"message"`
+}
+
+// deliver posts event to the app the way Razorpay does, signed with secret.
+func (f *fakeRazorpay) deliver(t *testing.T, eventID, secret string, event map[string]interface{}) webhookReply {
+	t.Helper()
+
+	body, err := json.Marshal(event)
+	if err != nil {
+		t.Fatalf("failed to encode event: %v", err)
+	}
+
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+
+	request, _ := http.NewRequest(http.MethodPost, f.app.URL+"/webhooks/razorpay", bytes.NewReader(body))
+	request.Header.Set("Content-Type", "application/json")
+	request.Header.Set("X-Razorpay-Signature", hex.EncodeToString(mac.Sum(nil)))
+	if eventID != "" {
+		request.Header.Set("X-Razorpay-Event-Id", eventID)
+	}
+
+	response, err := http.DefaultClient.Do(request)
+	if err != nil {
+		t.Fatalf("failed to deliver webhook: %v", err)
+	}
+	defer response.Body.Close()
+
+	reply := webhookReply{code: response.StatusCode}
+	json.NewDecoder(response.Body).Decode(&reply)
+	return reply
+}
+
+func (f *fakeRazorpay) refundedPayments() []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	paymentIDs := make([]string, 0, len(f.refunds))
+	for _, refund := range f.refunds {
+		paymentIDs = append(paymentIDs, refund["payment_id"].(string))
+	}
+	return paymentIDs
+}
+
+func paymentEvent(event, paymentID, orderID string, amount int64, notes map[string]string) map[string]interface{} {
+	entity := map[string]interface{}{
+		"id":       paymentID,
+		"order_id": orderID,
+		"amount":   amount,
+		"status":   strings.TrimPrefix(event, "payment."),
+		"notes":    []interface{}{},
+	}
+	if len(notes) > 0 {
+		entity["notes"] = notes
+	}
+	return map[string]interface{}{
+		"event":   event,
+		"payload": map[string]interface{}{"payment": map[string]interface{}{"entity": entity}},
+	}
+}
+
+func refundEvent(event, refundID, paymentID string, amount int64) map[string]interface{} {
+	return map[string]interface{}{
+		"event": event,
+		"payload": map[string]interface{}{"refund": map[string]interface{}{"entity": map[string]interface{}{
+			"id":         refundID,
+			"payment_id": paymentID,
+			"amount":     amount,
+			"status":     strings.TrimPrefix(event, "refund."),
+		}}},
+	}
+}
+
+var (
+	testDBOnce sync.Once
+	testDBErr  error
+)
+
+// useTestDatabase points database.DB at the Postgres database in
+// TEST_DATABASE_DSN and migrates it. Tests needing it are skipped without one.
+func useTestDatabase(t *testing.T) {
+	t.Helper()
+
+	dsn := os.Getenv("TEST_DATABASE_DSN")
+	if dsn == "" {
+		t.Skip("TEST_DATABASE_DSN is not set")
+	}
+
+	testDBOnce.Do(func() {
+		database.DB, testDBErr = gorm.Open(postgres.Open(dsn), &gorm.Config{
+			Logger: logger.Default.LogMode(logger.Silent),
+		})
+		if testDBErr == nil {
+			testDBErr = database.Migrate()
+		}
+	})
+	if testDBErr != nil {
+		t.Fatalf("failed to set up test database: %v", testDBErr)
+	}
+}
+
+// uniqueSuffix keeps rows of different tests and runs apart in a shared
+// database.
+func uniqueSuffix() string {
+	return strconv.FormatInt(time.Now().UnixNano(), 36)
+}
+
+func createTestUser(t *testing.T, suffix string) models.User {
+	t.Helper()
+	user := models.User{
+		Name:        "Test Buyer",
+		Email:       "buyer_" + suffix + "@example.com",
+		PhoneNumber: "phone_" + suffix,
+		Password:    "not-a-real-hash",
+		LoginMethod: "email",
+		IsVerified:  true,
+	}
+	if err := database.DB.Create(&user).Error; err != nil {
+		t.Fatalf("failed to create user: %v", err)
+	}
+	return user
+}
+
+// createPendingCheckout stores a checkout of one order waiting on a Razorpay
+// order, as CreateOrder leaves it.
+func createPendingCheckout(t *testing.T, suffix string, amount float64) (models.Checkout, models.Order, models.Payment) {
+	t.Helper()
+
+	buyer := createTestUser(t, suffix)
+	sellerUser := createTestUser(t, "seller_"+suffix)
+	seller := models.Seller{
+		UserID:      sellerUser.ID,
+		UserName:    "seller_" + suffix,
+		Password:    "not-a-real-hash",
+		Description: "test seller",
+	}
+	if err := database.DB.Create(&seller).Error; err != nil {
+		t.Fatalf("failed to create seller: %v", err)
+	}
+
+	checkout := models.Checkout{
+		UserID:        buyer.ID,
+		TotalAmount:   amount,
+		FinalAmount:   amount,
+		PaymentMethod: models.Razorpay,
+		PaymentStatus: models.OrderStatusPending,
+	}
+	if err := database.DB.Create(&checkout).Error; err != nil {
+		t.Fatalf("failed to create checkout: %v", err)
+	}
+
+	order := models.Order{
+		UserID:        buyer.ID,
+		CheckoutID:    checkout.CheckoutID,
+		SellerID:      seller.ID,
+		TotalAmount:   amount,
+		FinalAmount:   amount,
+		PaymentMethod: models.Razorpay,
+		PaymentStatus: models.OrderStatusPending,
+		Status:        models.OrderStatusPending,
+	}
+	if err := database.DB.Create(&order).Error; err != nil {
+		t.Fatalf("failed to create order: %v", err)
+	}
+
+	gatewayOrder := models.Payment{
+		CheckoutID:      checkout.CheckoutID,
+		RazorpayOrderID: "order_" + suffix,
+		PaymentGateway:  models.Razorpay,
+		PaymentStatus:   models.OnlinePaymentPending,
+		GatewayAmount:   checkoutGatewayAmount(checkout),
+	}
+	if err := database.DB.Create(&gatewayOrder).Error; err != nil {
+		t.Fatalf("failed to create payment record: %v", err)
+	}
+
+	return checkout, order, gatewayOrder
+}
+
+// createSourceRefund stores a refund to the original payment that is waiting
+// for the gateway to settle it.
+func createSourceRefund(t *testing.T, suffix string, amount float64) (models.User, models.Payment, models.Refund) {
+	t.Helper()
+
+	user := createTestUser(t, suffix)
+
+	payment := models.Payment{
+		OrderID:           "1",
+		RazorpayOrderID:   "order_" + suffix,
+		RazorpayPaymentID: "pay_" + suffix,
+		PaymentGateway:    models.Razorpay,
+		PaymentStatus:     models.PaymentStatusPaid,
+		AmountPaid:        amount,
+	}
+	if err := database.DB.Create(&payment).Error; err != nil {
+		t.Fatalf("failed to create payment: %v", err)
+	}
+
+	refund := models.Refund{
+		OrderID:         1,
+		UserID:          user.ID,
+		PaymentID:       payment.ID,
+		Amount:          amount,
+		Destination:     models.RefundDestinationSource,
+		Gateway:         models.Razorpay,
+		GatewayRefundID: "rfnd_" + suffix,
+		Status:          models.RefundStatusPending,
+		Reason:          "Entire order canceled",
+	}
+	if err := database.DB.Create(&refund).Error; err != nil {
+		t.Fatalf("failed to create refund: %v", err)
+	}
+
+	return user, payment, refund
+}
+
+func TestRazorpayWebhookRejectsBadSignature(t *testing.T) {
+	fake := newFakeRazorpay(t)
+	event := paymentEvent("payment.captured", "pay_forged", "order_forged", 100, nil)
+
+	reply := fake.deliver(t, "evt_forged", "some-other-secret", event)
+	if reply.code != http.StatusBadRequest || reply.Message != "invalid webhook signature" {
+		t.Errorf("forged webhook got %d %q, want 400 invalid webhook signature", reply.code, reply.Message)
+	}
+}
+
+func TestRazorpayWebhookPaymentCaptured(t *testing.T) {
+	useTestDatabase(t)
+	fake := newFakeRazorpay(t)
+	suffix := uniqueSuffix()
+
+	checkout, order, gatewayOrder := createPendingCheckout(t, suffix, 499.50)
+	event := paymentEvent("payment.captured", "pay_"+suffix, gatewayOrder.RazorpayOrderID, gatewayOrder.GatewayAmount,
+		map[string]string{"checkout_id": strconv.Itoa(int(checkout.CheckoutID))})
+
+	reply := fake.deliver(t, "evt_"+suffix, testWebhookSecret, event)
+	if reply.code != http.StatusOK || reply.Message != "checkout confirmed" {
+		t.Fatalf("payment.captured got %d %q, want 200 checkout confirmed", reply.code, reply.Message)
+	}
+
+	database.DB.First(&checkout, checkout.CheckoutID)
+	if checkout.PaymentStatus != models.PaymentStatusPaid {
+		t.Errorf("checkout payment status = %q, want %q", checkout.PaymentStatus, models.PaymentStatusPaid)
+	}
+	database.DB.First(&order, order.OrderID)
+	if order.Status != models.OrderStatusConfirmed || order.PaymentStatus != models.PaymentStatusPaid {
+		t.Errorf("order = %s/%s, want %s/%s", order.Status, order.PaymentStatus, models.OrderStatusConfirmed, models.PaymentStatusPaid)
+	}
+	database.DB.First(&gatewayOrder, gatewayOrder.ID)
+	if gatewayOrder.PaymentStatus != models.OnlinePaymentConfirmed || gatewayOrder.RazorpayPaymentID != "pay_"+suffix {
+		t.Errorf("gateway order = %s/%s, want confirmed for pay_%s", gatewayOrder.PaymentStatus, gatewayOrder.RazorpayPaymentID, suffix)
+	}
+}
+
+func TestRazorpayWebhookPaymentCapturedWrongAmount(t *testing.T) {
+	useTestDatabase(t)
+	fake := newFakeRazorpay(t)
+	suffix := uniqueSuffix()
+
+	checkout, _, gatewayOrder := createPendingCheckout(t, suffix, 250)
+	event := paymentEvent("payment.captured", "pay_"+suffix, gatewayOrder.RazorpayOrderID, gatewayOrder.GatewayAmount-100,
+		map[string]string{"checkout_id": strconv.Itoa(int(checkout.CheckoutID))})
+
+	reply := fake.deliver(t, "evt_"+suffix, testWebhookSecret, event)
+	if reply.code != http.StatusBadRequest {
+		t.Fatalf("underpaid payment.captured got %d %q, want 400", reply.code, reply.Message)
+	}
+
+	database.DB.First(&checkout, checkout.CheckoutID)
+	if checkout.PaymentStatus == models.PaymentStatusPaid {
+		t.Errorf("underpaid checkout was marked paid")
+	}
+}
+
+func TestRazorpayWebhookWalletTopUpCaptured(t *testing.T) {
+	useTestDatabase(t)
+	fake := newFakeRazorpay(t)
+
+	tests := []struct {
+		name        string
+		age         time.Duration
+		wantMessage string
+		wantStatus  string
+		wantCredit  bool
+		wantRefund  bool
+	}{
+		{"recent top-up is credited", 0, "wallet top-up completed", models.TopUpStatusCompleted, true, false},
+		{"expired top-up is refunded", 2 * PaymentTimeout(), "wallet top-up expired, payment refunded", models.TopUpStatusExpired, false, true},
+	}
+
+	for _, test := range tests {
+		suffix := uniqueSuffix()
+		user := createTestUser(t, suffix)
+
+		topUp := models.WalletTopUp{
+			UserID:         user.ID,
+			Amount:         150,
+			GatewayAmount:  15000,
+			Gateway:        models.Razorpay,
+			GatewayOrderID: "order_" + suffix,
+			Status:         models.TopUpStatusPending,
+		}
+		if err := database.DB.Create(&topUp).Error; err != nil {
+			t.Fatalf("failed to create wallet top-up: %v", err)
+		}
+		if test.age > 0 {
+			database.DB.Model(&topUp).UpdateColumn("created_at", time.Now().Add(-test.age))
+		}
+
+		reply := fake.deliver(t, "evt_"+suffix, testWebhookSecret, paymentEvent("payment.captured", "pay_"+suffix, topUp.GatewayOrderID, topUp.GatewayAmount, nil))
+		if reply.code != http.StatusOK || reply.Message != test.wantMessage {
+			t.Errorf("%s: got %d %q, want 200 %q", test.name, reply.code, reply.Message, test.wantMessage)
+			continue
+		}
+
+		database.DB.First(&topUp, topUp.ID)
+		if topUp.Status != test.wantStatus {
+			t.Errorf("%s: top-up status = %q, want %q", test.name, topUp.Status, test.wantStatus)
+		}
+
+		var credits int64
+		database.DB.Model(&models.UserWallet{}).Where("user_id = ? AND type = ?", user.ID, models.WalletIncoming).Count(&credits)
+		if (credits > 0) != test.wantCredit {
+			t.Errorf("%s: %d wallet credits, want credited = %v", test.name, credits, test.wantCredit)
+		}
+
+		SubmitQueuedRefunds()
+		refunded := false
+		for _, paymentID := range fake.refundedPayments() {
+			if paymentID == "pay_"+suffix {
+				refunded = true
+			}
+		}
+		if refunded != test.wantRefund {
+			t.Errorf("%s: refunded at Razorpay = %v, want %v", test.name, refunded, test.wantRefund)
+		}
+	}
+}
+
+func TestRazorpayWebhookPaymentFailed(t *testing.T) {
+	useTestDatabase(t)
+	fake := newFakeRazorpay(t)
+	suffix := uniqueSuffix()
+
+	checkout, _, gatewayOrder := createPendingCheckout(t, suffix, 120)
+	event := paymentEvent("payment.failed", "pay_"+suffix, gatewayOrder.RazorpayOrderID, gatewayOrder.GatewayAmount, nil)
+
+	reply := fake.deliver(t, "evt_"+suffix, testWebhookSecret, event)
+	if reply.code != http.StatusOK || reply.Message != "failed payment recorded" {
+		t.Fatalf("payment.failed got %d %q, want 200 failed payment recorded", reply.code, reply.Message)
+	}
+
+	var failed models.Payment
+	if err := database.DB.Where("razorpay_payment_id = ?", "pay_"+suffix).First(&failed).Error; err != nil {
+		t.Fatalf("failed payment was not recorded: %v", err)
+	}
+	if failed.CheckoutID != checkout.CheckoutID || failed.PaymentStatus != models.PaymentStatusFailed {
+		t.Errorf("failed payment = checkout %d/%s, want checkout %d/%s", failed.CheckoutID, failed.PaymentStatus, checkout.CheckoutID, models.PaymentStatusFailed)
+	}
+
+	database.DB.First(&checkout, checkout.CheckoutID)
+	if checkout.PaymentStatus == models.PaymentStatusPaid {
+		t.Errorf("checkout was marked paid by a failed payment")
+	}
+}
+
+func TestRazorpayWebhookRefundProcessed(t *testing.T) {
+	useTestDatabase(t)
+	fake := newFakeRazorpay(t)
+	suffix := uniqueSuffix()
+
+	_, payment, refund := createSourceRefund(t, suffix, 80)
+
+	reply := fake.deliver(t, "evt_"+suffix, testWebhookSecret, refundEvent("refund.processed", refund.GatewayRefundID, payment.RazorpayPaymentID, 8000))
+	if reply.code != http.StatusOK || reply.Message != "refund recorded" {
+		t.Fatalf("refund.processed got %d %q, want 200 refund recorded", reply.code, reply.Message)
+	}
+
+	database.DB.First(&refund, refund.ID)
+	if refund.Status != models.RefundStatusProcessed || refund.Destination != models.RefundDestinationSource {
+		t.Errorf("refund = %s to %s, want %s to %s", refund.Status, refund.Destination, models.RefundStatusProcessed, models.RefundDestinationSource)
+	}
+	database.DB.First(&payment, payment.ID)
+	if payment.PaymentStatus != models.PaymentStatusRefund {
+		t.Errorf("payment status = %q, want %q", payment.PaymentStatus, models.PaymentStatusRefund)
+	}
+}
+
+func TestRazorpayWebhookRefundFailed(t *testing.T) {
+	useTestDatabase(t)
+	fake := newFakeRazorpay(t)
+	suffix := uniqueSuffix()
+
+	user, payment, refund := createSourceRefund(t, suffix, 65)
+
+	reply := fake.deliver(t, "evt_"+suffix, testWebhookSecret, refundEvent("refund.failed", refund.GatewayRefundID, payment.RazorpayPaymentID, 6500))
+	if reply.code != http.StatusOK || reply.Message != "refund failure recorded" {
+		t.Fatalf("refund.failed got %d %q, want 200 refund failure recorded", reply.code, reply.Message)
+	}
+
+	database.DB.First(&refund, refund.ID)
+	if refund.Destination != models.RefundDestinationWallet || refund.Status != models.RefundStatusProcessed || refund.FailureReason == "" {
+		t.Errorf("refund = %s to %s (%q), want processed to wallet with a failure reason", refund.Status, refund.Destination, refund.FailureReason)
+	}
+
+	var credit models.UserWallet
+	if err := database.DB.Where("user_id = ? AND type = ?", user.ID, models.WalletIncoming).First(&credit).Error; err != nil {
+		t.Fatalf("failed refund was not credited to the wallet: %v", err)
+	}
+	if credit.Amount != 65 {
+		t.Errorf("wallet credit = %v, want 65", credit.Amount)
+	}
+}
+
+func TestRazorpayWebhookReplayIsIgnored(t *testing.T) {
+	useTestDatabase(t)
+	fake := newFakeRazorpay(t)
+	suffix := uniqueSuffix()
+
+	user, payment, refund := createSourceRefund(t, suffix, 40)
+	event := refundEvent("refund.failed", refund.GatewayRefundID, payment.RazorpayPaymentID, 4000)
+
+	if reply := fake.deliver(t, "evt_"+suffix, testWebhookSecret, event); reply.code != http.StatusOK {
+		t.Fatalf("first delivery got %d %q, want 200", reply.code, reply.Message)
+	}
+
+	// put the refund back as if the first delivery never happened, so only the
+	// event id can stop the replay from crediting the wallet again
+	database.DB.Model(&refund).Updates(map[string]interface{}{
+		"status":      models.RefundStatusPending,
+		"destination": models.RefundDestinationSource,
+	})
+
+	reply := fake.deliver(t, "evt_"+suffix, testWebhookSecret, event)
+	if reply.code != http.StatusOK || reply.Message != "event already processed" {
+		t.Fatalf("replay got %d %q, want 200 event already processed", reply.code, reply.Message)
+	}
+
+	var credits int64
+	database.DB.Model(&models.UserWallet{}).Where("user_id = ?", user.ID).Count(&credits)
+	if credits != 1 {
+		t.Errorf("wallet credited %d times, want once", credits)
+	}
+
+	var events int64
+	database.DB.Model(&models.WebhookEvent{}).Where("provider = ? AND event_id = ?", models.Razorpay, "evt_"+suffix).Count(&events)
+	if events != 1 {
+		t.Errorf("%d webhook events stored, want 1", events)
+	}
+}
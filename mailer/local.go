@@ -0,0 +1,52 @@
+package mailer
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"regexp"
+	"time"
+)
+
+// LogMailer writes emails to the server log instead of sending them, for
+// local development.
+type LogMailer struct{}
+
+func (LogMailer) Name() string {
+	return DriverLog
+}
+
+func (LogMailer) Send(message Message) error {
+	log.Printf("email to %s: %s\n%s", message.To, message.Subject, message.Text)
+	return nil
+}
+
+// FileMailer saves every email as an .eml file in Dir, so it can be opened
+// with a mail client during development.
+type FileMailer struct {
+	Dir string
+}
+
+var unsafeFileChars = regexp.MustCompile(`[^a-zA-Z0-9._-]+`)
+
+func (FileMailer) Name() string {
+	return DriverFile
+}
+
+func (m FileMailer) Send(message Message) error {
+	if err := os.MkdirAll(m.Dir, 0o755); err != nil {
+		return fmt.Errorf("failed to create mail directory: %w", err)
+	}
+
+	body, err := buildMIME(defaultSMTPFrom, message)
+	if err != nil {
+		return err
+	}
+
+	name := fmt.Sprintf("%d_%s.eml", time.Now().UnixNano(), unsafeFileChars.ReplaceAllString(message.To, "_"))
+	if err := os.WriteFile(filepath.Join(m.Dir, name), body, 0o644); err != nil {
+		return fmt.Errorf("failed to write email: %w", err)
+	}
+	return nil
+}
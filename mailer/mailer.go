@@ -0,0 +1,47 @@
+package mailer
+
+import (
+	"fmt"
+	"os"
+	"strings"
+)
+
+const (
+	DriverSMTP = "smtp"
+	DriverLog  = "log"
+	DriverFile = "file"
+)
+
+// Mailer is implemented by every way the app can deliver an email. Send
+// either hands the message over for delivery or returns an error, in which
+// case the outbox retries it later.
+type Mailer interface {
+	Name() string
+	Send(message Message) error
+}
+
+type Message struct {
+	To      string
+	Subject string
+	Text    string
+	HTML    string
+}
+
+// New returns the mailer selected by MAIL_DRIVER, defaulting to SMTP when it
+// is unset.
+func New() (Mailer, error) {
+	switch strings.ToLower(os.Getenv("MAIL_DRIVER")) {
+	case "", DriverSMTP:
+		return NewSMTPMailer(), nil
+	case DriverLog:
+		return LogMailer{}, nil
+	case DriverFile:
+		dir := os.Getenv("MAIL_DIR")
+		if dir == "" {
+			dir = "mail"
+		}
+		return FileMailer{Dir: dir}, nil
+	default:
+		return nil, fmt.Errorf("unsupported mail driver %q", os.Getenv("MAIL_DRIVER"))
+	}
+}
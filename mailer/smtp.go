@@ -0,0 +1,113 @@
+package mailer
+
+import (
+	"bytes"
+	"fmt"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net/smtp"
+	"net/textproto"
+	"os"
+	"time"
+)
+
+const (
+	defaultSMTPHost = "smtp.gmail.com"
+	defaultSMTPPort = "587"
+	defaultSMTPFrom = "knowledgemartv01@gmail.com"
+)
+
+// SMTPMailer sends through an SMTP server with PLAIN auth, by default the
+// Gmail account the app has always sent from.
+type SMTPMailer struct {
+	Host     string
+	Port     string
+	From     string
+	Password string
+}
+
+// NewSMTPMailer reads the server from SMTP_HOST, SMTP_PORT and SMTP_FROM and
+// the app password from SMTPAPP.
+func NewSMTPMailer() SMTPMailer {
+	mailer := SMTPMailer{
+		Host:     os.Getenv("SMTP_HOST"),
+		Port:     os.Getenv("SMTP_PORT"),
+		From:     os.Getenv("SMTP_FROM"),
+		Password: os.Getenv("SMTPAPP"),
+	}
+	if mailer.Host == "" {
+		mailer.Host = defaultSMTPHost
+	}
+	if mailer.Port == "" {
+		mailer.Port = defaultSMTPPort
+	}
+	if mailer.From == "" {
+		mailer.From = defaultSMTPFrom
+	}
+	return mailer
+}
+
+func (m SMTPMailer) Name() string {
+	return DriverSMTP
+}
+
+func (m SMTPMailer) Send(message Message) error {
+	body, err := buildMIME(m.From, message)
+	if err != nil {
+		return err
+	}
+
+	auth := smtp.PlainAuth("", m.From, m.Password, m.Host)
+	if err := smtp.SendMail(m.Host+":"+m.Port, auth, m.From, []string{message.To}, body); err != nil {
+		return fmt.Errorf("failed to send email: %w", err)
+	}
+	return nil
+}
+
+// buildMIME renders the message as a multipart/alternative email carrying
+// both the text and the HTML body.
+func buildMIME(from string, message Message) ([]byte, error) {
+	var body bytes.Buffer
+	writer := multipart.NewWriter(&body)
+
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "From: %s\r\n", from)
+	fmt.Fprintf(&buf, "To: %s\r\n", message.To)
+	fmt.Fprintf(&buf, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", message.Subject))
+	fmt.Fprintf(&buf, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	fmt.Fprintf(&buf, "MIME-Version: 1.0\r\n")
+	fmt.Fprintf(&buf, "Content-Type: multipart/alternative; boundary=%s\r\n\r\n", writer.Boundary())
+
+	for _, part := range []struct {
+		contentType string
+		content     string
+	}{
+		{"text/plain; charset=utf-8", message.Text},
+		{"text/html; charset=utf-8", message.HTML},
+	} {
+		if part.content == "" {
+			continue
+		}
+		w, err := writer.CreatePart(textproto.MIMEHeader{
+			"Content-Type":              {part.contentType},
+			"Content-Transfer-Encoding": {"quoted-printable"},
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to build email: %w", err)
+		}
+		qp := quotedprintable.NewWriter(w)
+		if _, err := qp.Write([]byte(part.content)); err != nil {
+			return nil, fmt.Errorf("failed to build email: %w", err)
+		}
+		if err := qp.Close(); err != nil {
+			return nil, fmt.Errorf("failed to build email: %w", err)
+		}
+	}
+	if err := writer.Close(); err != nil {
+		return nil, fmt.Errorf("failed to build email: %w", err)
+	}
+
+	buf.Write(body.Bytes())
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,65 @@
+package mailer
+
+import (
+	"bytes"
+	"embed"
+	"fmt"
+	htmltemplate "html/template"
+	"strings"
+	texttemplate "text/template"
+)
+
+const (
+	EventVerifyEmail    = "verify_email"
+	EventPasswordReset  = "password_reset"
+	EventPaymentExpired = "payment_expired"
+	EventOrderPlaced    = "order_placed"
+	EventOrderShipped   = "order_shipped"
+	EventOrderRefunded  = "order_refunded"
+)
+
+//go:embed templates
+var templateFiles embed.FS
+
+var subjects = map[string]string{
+	EventVerifyEmail:    "Verify your email",
+	EventPasswordReset:  "Reset your password",
+	EventPaymentExpired: "Your order has been canceled",
+	EventOrderPlaced:    "Order placed successfully",
+	EventOrderShipped:   "Your order has shipped",
+	EventOrderRefunded:  "Refund issued for your order",
+}
+
+// Render builds the email for event from its text and HTML templates in
+// templates/, the HTML one wrapped in the shared layout.
+func Render(event, to string, data interface{}) (Message, error) {
+	subject, ok := subjects[event]
+	if !ok {
+		return Message{}, fmt.Errorf("unknown email event %q", event)
+	}
+
+	textTemplate, err := texttemplate.ParseFS(templateFiles, "templates/"+event+".txt")
+	if err != nil {
+		return Message{}, fmt.Errorf("failed to parse %s text template: %w", event, err)
+	}
+	var text bytes.Buffer
+	if err := textTemplate.Execute(&text, data); err != nil {
+		return Message{}, fmt.Errorf("failed to render %s text template: %w", event, err)
+	}
+
+	htmlTemplate, err := htmltemplate.ParseFS(templateFiles, "templates/layout.html", "templates/"+event+".html")
+	if err != nil {
+		return Message{}, fmt.Errorf("failed to parse %s html template: %w", event, err)
+	}
+	var html bytes.Buffer
+	if err := htmlTemplate.ExecuteTemplate(&html, "layout.html", data); err != nil {
+		return Message{}, fmt.Errorf("failed to render %s html template: %w", event, err)
+	}
+
+	return Message{
+		To:      to,
+		Subject: subject,
+		Text:    strings.TrimSpace(text.String()),
+		HTML:    html.String(),
+	}, nil
+}
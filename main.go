@@ -2,6 +2,7 @@ package main
 
 import (
 	database "knowledgeMart/config"
+	"knowledgeMart/controllers"
 	"knowledgeMart/routes"
 	"os"
 
@@ -10,6 +11,10 @@ import (
 
 func main() {
 	database.ConnectDB()
+	controllers.StartPaymentExpiryScheduler()
+	controllers.StartEscrowReleaseScheduler()
+	controllers.StartEmailOutboxScheduler()
+	controllers.StartRefundQueueScheduler()
 
 	router := gin.Default()
 
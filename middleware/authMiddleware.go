@@ -2,9 +2,12 @@ package middleware
 
 import (
 	"fmt"
+	database "knowledgeMart/config"
+	"knowledgeMart/models"
 	"knowledgeMart/utils"
 	"net/http"
 	"strings"
+	"time"
 
 	"github.com/gin-gonic/gin"
 )
@@ -41,12 +44,27 @@ func AuthRequired(c *gin.Context) {
 		return
 	}
 
+	// access tokens are only honoured while their session is open, so logging
+	// out, blocking or changing the password takes effect right away
+	var session models.AuthSession
+	if claims.SessionID == 0 ||
+		database.DB.Where("id = ?", claims.SessionID).First(&session).Error != nil ||
+		session.RevokedAt != nil || time.Now().After(session.ExpiresAt) ||
+		session.Role != claims.Role || session.OwnerID != claims.ID {
+		c.JSON(http.StatusUnauthorized, gin.H{
+			"status":  "failed",
+			"message": "session has expired, please log in again",
+		})
+		c.Abort()
+		return
+	}
+
 	switch claims.Role {
-	case "user":
+	case models.RoleUser:
 		c.Set("userID", claims.ID)
-	case "seller":
+	case models.RoleSeller:
 		c.Set("sellerID", claims.ID)
-	case "admin":
+	case models.RoleAdmin:
 		c.Set("adminID", claims.ID)
 	default:
 		c.JSON(http.StatusForbidden, gin.H{
@@ -55,6 +73,76 @@ func AuthRequired(c *gin.Context) {
 		c.Abort()
 		return
 	}
+	c.Set("role", claims.Role)
+	c.Set("sessionID", session.ID)
 
 	c.Next()
 }
+
+// RequireRole lets the request through only when AuthRequired accepted a token
+// of one of the given roles.
+func RequireRole(roles ...string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		role := c.GetString("role")
+		for _, allowed := range roles {
+			if role == allowed {
+				c.Next()
+				return
+			}
+		}
+
+		c.JSON(http.StatusForbidden, gin.H{
+			"status":  "failed",
+			"message": "you are not allowed to access this resource",
+		})
+		c.Abort()
+	}
+}
+
+// RequireAdminRole lets an admin through when their sub-role is one of the
+// given roles. Super admins may do everything. The sub-role is read from the
+// admin record so a change applies to tokens already issued.
+func RequireAdminRole(adminRoles ...string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		adminID, exists := c.Get("adminID")
+		if !exists || c.GetString("role") != models.RoleAdmin {
+			c.JSON(http.StatusForbidden, gin.H{
+				"status":  "failed",
+				"message": "you are not allowed to access this resource",
+			})
+			c.Abort()
+			return
+		}
+
+		var admin models.Admin
+		if err := database.DB.Select("id", "role").Where("id = ?", adminID).First(&admin).Error; err != nil {
+			c.JSON(http.StatusUnauthorized, gin.H{
+				"status":  "failed",
+				"message": "admin not found",
+			})
+			c.Abort()
+			return
+		}
+
+		if admin.Role != models.AdminRoleSuper {
+			allowed := false
+			for _, role := range adminRoles {
+				if admin.Role == role {
+					allowed = true
+					break
+				}
+			}
+			if !allowed {
+				c.JSON(http.StatusForbidden, gin.H{
+					"status":  "failed",
+					"message": fmt.Sprintf("admin role %s is not allowed to access this resource", admin.Role),
+				})
+				c.Abort()
+				return
+			}
+		}
+
+		c.Set("adminRole", admin.Role)
+		c.Next()
+	}
+}
@@ -1,13 +1,28 @@
 package models
 
 const (
-	OrderStatusPending        = "pending"
-	OrderStatusConfirmed      = "confirmed"
-	OrderStatusShipped        = "shipped"
-	OrderStatusOutForDelivery = "outForDelivery"
-	OrderStatusDelivered      = "delivered"
-	OrderStatusCanceled       = "canceled"
-	OrderStatusReturned       = "return"
+	OrderStatusPending         = "pending"
+	OrderStatusConfirmed       = "confirmed"
+	OrderStatusShipped         = "shipped"
+	OrderStatusOutForDelivery  = "outForDelivery"
+	OrderStatusDelivered       = "delivered"
+	OrderStatusCanceled        = "canceled"
+	OrderStatusReturned        = "return"
+	OrderStatusReturnRequested = "returnRequested"
+
+	ReturnStatusRequested = "requested"
+	ReturnStatusApproved  = "approved"
+	ReturnStatusRejected  = "rejected"
+	ReturnStatusPickedUp  = "pickedUp"
+	ReturnStatusReceived  = "received"
+
+	RefundDestinationSource = "source"
+	RefundDestinationWallet = "wallet"
+
+	RefundStatusQueued    = "queued"
+	RefundStatusPending   = "pending"
+	RefundStatusProcessed = "processed"
+	RefundStatusFailed    = "failed"
 
 	PaymentStatusPaid     = "Paid"
 	PaymentStatusCanceled = "Canceled"
@@ -18,9 +33,10 @@ const (
 	OnlinePaymentConfirmed = "Confirmed"
 	OnlinePaymentFailed    = "Failed"
 
-	Razorpay = "RAZORPAY"
-	Wallet   = "WALLET"
-	COD      = "COD"
+	Razorpay    = "RAZORPAY"
+	FakeGateway = "FAKE"
+	Wallet      = "WALLET"
+	COD         = "COD"
 
 	CODStatusPending   = "COD_PENDING"
 	CODStatusConfirmed = "COD_CONFIRMED"
@@ -28,4 +44,53 @@ const (
 
 	WalletIncoming = "INCOMING"
 	WalletOutgoing = "OUTGOING"
+
+	TopUpStatusPending   = "pending"
+	TopUpStatusCompleted = "completed"
+	TopUpStatusExpired   = "expired"
+
+	WalletEntryPending   = "pending"
+	WalletEntryAvailable = "available"
+
+	LedgerUserWallet      = "user_wallet"
+	LedgerSellerWallet    = "seller_wallet"
+	LedgerSellerEscrow    = "seller_escrow"
+	LedgerGatewayClearing = "gateway_clearing"
+	LedgerPromotions      = "promotions"
+	LedgerOpeningBalances = "opening_balances"
+	LedgerPayoutClearing  = "payout_clearing"
+	LedgerPayoutsSettled  = "payouts_settled"
+	LedgerCommission      = "platform_commission"
+	LedgerGatewayFees     = "gateway_fees"
+
+	CommissionScopeGlobal   = "global"
+	CommissionScopeCategory = "category"
+	CommissionScopeSeller   = "seller"
+
+	PayoutMethodBank = "bank"
+	PayoutMethodUPI  = "upi"
+
+	PayoutStatusRequested = "requested"
+	PayoutStatusApproved  = "approved"
+	PayoutStatusProcessed = "processed"
+	PayoutStatusFailed    = "failed"
+	PayoutStatusRejected  = "rejected"
+
+	RoleUser   = "user"
+	RoleSeller = "seller"
+	RoleAdmin  = "admin"
+
+	AdminRoleSuper          = "super"
+	AdminRoleCatalogManager = "catalog_manager"
+	AdminRoleFinance        = "finance"
+	AdminRoleSupport        = "support"
+
+	EmailStatusPending = "pending"
+	EmailStatusSent    = "sent"
+	EmailStatusFailed  = "failed"
+
+	ActorUser   = "user"
+	ActorSeller = "seller"
+	ActorAdmin  = "admin"
+	ActorSystem = "system"
 )
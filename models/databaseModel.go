@@ -12,6 +12,7 @@ type Admin struct {
 	ID       uint   `gorm:"primaryKey;autoIncrement" json:"id"`
 	Email    string `gorm:"type:varchar(255);unique" validate:"required,email" json:"email"`
 	Password string `gorm:"type:varchar(255)" validate:"required" json:"password"`
+	Role     string `gorm:"type:varchar(30);default:'super'" json:"role"`
 }
 
 type User struct {
@@ -29,6 +30,7 @@ type User struct {
 	OTPExpiry    time.Time
 	IsVerified   bool   `gorm:"type:bool" json:"verified"`
 	LoginMethod  string `gorm:"type:varchar(50)" json:"login_method"`
+	GoogleID     string `gorm:"type:varchar(64);uniqueIndex:idx_users_google_id,where:google_id <> ''" json:"-"`
 }
 
 type UserReferralHistory struct {
@@ -63,17 +65,21 @@ type Category struct {
 
 type Product struct {
 	gorm.Model
-	ID           uint           `gorm:"primaryKey;autoIncrement" json:"id"`
-	SellerID     uint           `gorm:"not null;constraint:OnDelete:CASCADE;" json:"sellerId"`
-	Seller       Seller         `gorm:"foreignKey:SellerID"`
-	Name         string         `gorm:"type:varchar(255)" validate:"required" json:"name"`
-	CategoryID   uint           `gorm:"constraint:OnDelete:CASCADE;" json:"categoryId"`
-	Category     Category       `gorm:"foreignKey:CategoryID"`
-	Description  string         `gorm:"type:varchar(255)" validate:"required" json:"description"`
-	Availability bool           `gorm:"type:bool;default:true" json:"availability"`
-	Price        float64        `gorm:"type:decimal(10,2);not null" validate:"required" json:"price"`
-	OfferAmount  float64        `gorm:"type:decimal(10,2);not null" validate:"required" json:"offer_amount"`
-	Image        pq.StringArray `gorm:"type:varchar(255)[]" validate:"required" json:"image_url"`
+	ID            uint           `gorm:"primaryKey;autoIncrement" json:"id"`
+	SellerID      uint           `gorm:"not null;constraint:OnDelete:CASCADE;" json:"sellerId"`
+	Seller        Seller         `gorm:"foreignKey:SellerID"`
+	Name          string         `gorm:"type:varchar(255)" validate:"required" json:"name"`
+	CategoryID    uint           `gorm:"constraint:OnDelete:CASCADE;" json:"categoryId"`
+	Category      Category       `gorm:"foreignKey:CategoryID"`
+	Description   string         `gorm:"type:varchar(255)" validate:"required" json:"description"`
+	Availability  bool           `gorm:"type:bool;default:true" json:"availability"`
+	SoldOut       bool           `gorm:"not null;default:false" json:"-"` // availability was switched off by the stock running out
+	StockQuantity uint           `gorm:"not null;default:1" json:"stock_quantity"`
+	Price         float64        `gorm:"type:decimal(10,2);not null" validate:"required" json:"price"`
+	OfferAmount   float64        `gorm:"type:decimal(10,2);not null" validate:"required" json:"offer_amount"`
+	Image         pq.StringArray `gorm:"type:varchar(255)[]" validate:"required" json:"image_url"`
+	AverageRating float64        `gorm:"type:decimal(10,2);default:0" json:"average_rating"`
+	ReviewCount   uint           `gorm:"not null;default:0" json:"review_count"`
 }
 
 type Address struct {
@@ -94,11 +100,29 @@ type Cart struct {
 	User      User    `gorm:"foreignKey:UserID"`
 	ProductID uint    `gorm:"not null" json:"productId"`
 	Product   Product `gorm:"foreignKey:ProductID"`
+	Quantity  uint    `gorm:"not null;default:1" json:"quantity"`
+}
+
+type Checkout struct {
+	CheckoutID             uint      `gorm:"primaryKey;autoIncrement" json:"id"`
+	UserID                 uint      `gorm:"not null" json:"user_id"`
+	CouponCode             string    `json:"coupon_code"`
+	CouponDiscountAmount   float64   `json:"coupon_discount_amount"`
+	CategoryDiscountAmount float64   `json:"category_discount_amount"`
+	ProductOfferAmount     float64   `json:"product_offer_amount"`
+	DeliveryCharge         float64   `json:"delivery_charge"`
+	TotalAmount            float64   `gorm:"type:decimal(10,2);not null" json:"total_amount"`
+	FinalAmount            float64   `json:"final_amount"`
+	PaymentMethod          string    `gorm:"type:varchar(100)" json:"payment_method"`
+	PaymentStatus          string    `gorm:"type:varchar(100)" json:"payment_status"`
+	FailedPaymentCount     int       `gorm:"default:0" json:"failed_Payment_count"`
+	CreatedAt              time.Time `gorm:"autoCreateTime" json:"created_at"`
 }
 
 type Order struct {
 	OrderID                uint            `gorm:"primaryKey;autoIncrement" json:"id"`
 	UserID                 uint            `gorm:"not null" json:"user_id"`
+	CheckoutID             uint            `gorm:"index" json:"checkout_id"`
 	CouponCode             string          `json:"coupon_code"`
 	CouponDiscountAmount   float64         `validate:"required,number" json:"coupon_discount_amount"`
 	CategoryDiscountAmount float64         `validate:"required,number" json:"category_discount_amount"`
@@ -113,6 +137,39 @@ type Order struct {
 	SellerID               uint            `gorm:"not null" json:"seller_id"`
 	Status                 string          `gorm:"type:varchar(100);default:'pending'" json:"status"`
 	FailedPaymentCount     int             `gorm:"default:0" json:"failed_Payment_count"`
+	CommissionAmount       float64         `gorm:"type:decimal(10,2);default:0" json:"commission_amount"`
+	CommissionRefunded     float64         `gorm:"type:decimal(10,2);default:0" json:"commission_refunded"`
+	GatewayFeeAmount       float64         `gorm:"type:decimal(10,2);default:0" json:"gateway_fee_amount"`
+	EscrowAmount           float64         `gorm:"type:decimal(10,2);default:0" json:"escrow_amount"`
+	EscrowReleasedAt       *time.Time      `json:"escrow_released_at,omitempty"`
+}
+
+type OrderStatusHistory struct {
+	ID            uint      `gorm:"primaryKey;autoIncrement" json:"id"`
+	OrderID       uint      `gorm:"not null;index" json:"orderId"`
+	OrderItemID   uint      `gorm:"index" json:"orderItemId,omitempty"`
+	FromStatus    string    `gorm:"type:varchar(100)" json:"from_status"`
+	ToStatus      string    `gorm:"type:varchar(100);not null" json:"to_status"`
+	ChangedByRole string    `gorm:"type:varchar(20)" json:"changed_by_role"`
+	ChangedByID   uint      `json:"changed_by_id"`
+	Reason        string    `gorm:"type:varchar(255)" json:"reason"`
+	ChangedAt     time.Time `gorm:"autoCreateTime" json:"changed_at"`
+}
+
+type ReturnRequest struct {
+	ReturnRequestID uint           `gorm:"primaryKey;autoIncrement" json:"return_request_id"`
+	OrderID         uint           `gorm:"not null;index" json:"order_id"`
+	OrderItemID     uint           `gorm:"not null;index" json:"order_item_id"`
+	UserID          uint           `gorm:"not null;index" json:"user_id"`
+	SellerID        uint           `gorm:"not null;index" json:"seller_id"`
+	Reason          string         `gorm:"type:varchar(500);not null" json:"reason"`
+	Images          pq.StringArray `gorm:"type:varchar(255)[]" json:"image_url"`
+	Status          string         `gorm:"type:varchar(50);not null" json:"status"`
+	SellerNote      string         `gorm:"type:varchar(500)" json:"seller_note"`
+	RefundAmount    float64        `gorm:"type:decimal(10,2)" json:"refund_amount"`
+	RefundTo        string         `gorm:"type:varchar(20);default:'wallet'" json:"refund_to"`
+	RequestedAt     time.Time      `gorm:"autoCreateTime" json:"requested_at"`
+	UpdatedAt       time.Time      `gorm:"autoUpdateTime" json:"updated_at"`
 }
 
 type ShippingAddress struct {
@@ -134,6 +191,7 @@ type OrderItem struct {
 	Product             Product `gorm:"foreignKey:ProductID"`
 	SellerID            uint    `gorm:"not null" json:"sellerId"`
 	Seller              Seller  `gorm:"foreignKey:SellerID"`
+	Quantity            uint    `gorm:"not null;default:1" json:"quantity"`
 	Price               float64 `gorm:"type:decimal(10,2);not null" json:"price"`
 	ProductOfferAmount  float64 `json:"product_offer_amount"`
 	CategoryOfferAmount float64 `json:"category_offer_amount"`
@@ -143,10 +201,42 @@ type OrderItem struct {
 }
 
 type SellerRating struct {
-	ID       uint    `gorm:"primaryKey;autoIncrement" json:"id"`
-	UserID   uint    `gorm:"not null" json:"userId"`
-	SellerID uint    `gorm:"not null" json:"sellerId"`
-	Rating   float64 `gorm:"not null" json:"rating"`
+	ID        uint      `gorm:"primaryKey;autoIncrement" json:"id"`
+	UserID    uint      `gorm:"not null;uniqueIndex:idx_seller_rating_user_order,where:order_id > 0" json:"userId"`
+	SellerID  uint      `gorm:"not null;index" json:"sellerId"`
+	OrderID   uint      `gorm:"uniqueIndex:idx_seller_rating_user_order,where:order_id > 0" json:"orderId"`
+	Rating    float64   `gorm:"not null" json:"rating"`
+	CreatedAt time.Time `gorm:"autoCreateTime" json:"created_at"`
+	UpdatedAt time.Time `gorm:"autoUpdateTime" json:"updated_at"`
+}
+
+type SellerRatingHistory struct {
+	ID             uint      `gorm:"primaryKey;autoIncrement" json:"id"`
+	SellerRatingID uint      `gorm:"not null;index" json:"sellerRatingId"`
+	UserID         uint      `gorm:"not null" json:"userId"`
+	SellerID       uint      `gorm:"not null" json:"sellerId"`
+	OrderID        uint      `gorm:"not null" json:"orderId"`
+	OldRating      float64   `json:"old_rating"`
+	NewRating      float64   `gorm:"not null" json:"new_rating"`
+	ChangedAt      time.Time `gorm:"autoCreateTime" json:"changed_at"`
+}
+
+type ProductReview struct {
+	ID               uint           `gorm:"primaryKey;autoIncrement" json:"id"`
+	ProductID        uint           `gorm:"not null;uniqueIndex:idx_product_review_user" json:"productId"`
+	Product          Product        `gorm:"foreignKey:ProductID" json:"-"`
+	UserID           uint           `gorm:"not null;uniqueIndex:idx_product_review_user" json:"userId"`
+	User             User           `gorm:"foreignKey:UserID" json:"-"`
+	OrderItemID      uint           `gorm:"not null" json:"orderItemId"`
+	Rating           uint           `gorm:"not null" json:"rating"`
+	Title            string         `gorm:"type:varchar(255)" json:"title"`
+	Body             string         `gorm:"type:text" json:"body"`
+	Images           pq.StringArray `gorm:"type:varchar(255)[]" json:"image_url"`
+	VerifiedPurchase bool           `gorm:"type:bool;default:false" json:"verified_purchase"`
+	SellerReply      string         `gorm:"type:text" json:"seller_reply"`
+	SellerRepliedAt  *time.Time     `json:"seller_replied_at"`
+	CreatedAt        time.Time      `gorm:"autoCreateTime" json:"created_at"`
+	UpdatedAt        time.Time      `gorm:"autoUpdateTime" json:"updated_at"`
 }
 
 type WhishList struct {
@@ -160,33 +250,191 @@ type WhishList struct {
 type Payment struct {
 	ID                uint   `gorm:"primaryKey"`
 	OrderID           string `gorm:"not null"`
+	CheckoutID        uint   `gorm:"index"`
 	WalletPaymentID   string `json:"wallet_payment_id" gorm:"column:wallet_payment_id"`
-	RazorpayOrderID   string `gorm:"not null"`
+	RazorpayOrderID   string `gorm:"not null;index"`
 	RazorpayPaymentID string `gorm:"default:null"`
 	RazorpaySignature string `gorm:"default:null"`
 	PaymentGateway    string `gorm:"default:'Razorpay'"`
 	PaymentStatus     string `gorm:"not null"`
 	AmountPaid        float64
+	// GatewayAmount is the amount, in paise, the gateway order was created
+	// for. It is only set on the checkout's gateway order record.
+	GatewayAmount int64
+	CreatedAt     time.Time `gorm:"autoCreateTime"`
+}
+
+type Refund struct {
+	ID               uint      `gorm:"primaryKey;autoIncrement" json:"id"`
+	OrderID          uint      `gorm:"not null;index" json:"order_id"`
+	UserID           uint      `gorm:"not null;index" json:"user_id"`
+	PaymentID        uint      `gorm:"index" json:"payment_id,omitempty"`
+	Amount           float64   `gorm:"type:decimal(10,2);not null" json:"amount"`
+	Destination      string    `gorm:"type:varchar(20);not null" json:"destination"`
+	Gateway          string    `gorm:"type:varchar(50)" json:"gateway,omitempty"`
+	GatewayPaymentID string    `gorm:"type:varchar(100)" json:"-"`
+	GatewayRefundID  string    `gorm:"type:varchar(100);index" json:"gateway_refund_id,omitempty"`
+	Status           string    `gorm:"type:varchar(20);not null;index:idx_refund_due" json:"status"`
+	Reason           string    `gorm:"type:varchar(255)" json:"reason"`
+	FailureReason    string    `gorm:"type:varchar(500)" json:"failure_reason,omitempty"`
+	Attempts         int       `gorm:"not null;default:0" json:"-"`
+	NextAttemptAt    time.Time `gorm:"index:idx_refund_due" json:"-"`
+	CreatedAt        time.Time `gorm:"autoCreateTime" json:"created_at"`
+	UpdatedAt        time.Time `gorm:"autoUpdateTime" json:"updated_at"`
+}
+
+type WebhookEvent struct {
+	ID         uint      `gorm:"primaryKey;autoIncrement" json:"id"`
+	Provider   string    `gorm:"type:varchar(50);not null;uniqueIndex:idx_webhook_event" json:"provider"`
+	EventID    string    `gorm:"type:varchar(100);not null;uniqueIndex:idx_webhook_event" json:"event_id"`
+	Event      string    `gorm:"type:varchar(100)" json:"event"`
+	ReceivedAt time.Time `gorm:"autoCreateTime" json:"received_at"`
 }
 
 type UserWallet struct {
+	ID              uint      `gorm:"primaryKey;autoIncrement" json:"id"`
 	TransactionTime time.Time `gorm:"autoCreateTime" json:"transaction_time"`
 	WalletPaymentID string    `gorm:"column:wallet_payment_id" json:"wallet_payment_id"`
 	UserID          uint      `gorm:"column:user_id" json:"user_id"`
-	Type            string    `gorm:"column:type" json:"type"` //incoming //outgoing
+	Type            string    `gorm:"column:type" json:"type"` //INCOMING //OUTGOING
 	OrderID         string    `gorm:"column:order_id" json:"order_id"`
 	Amount          float64   `gorm:"column:amount" json:"amount"`
 	CurrentBalance  float64   `gorm:"column:current_balance" json:"current_balance"`
 	Reason          string    `gorm:"column:reason" json:"reason"`
 }
 
+type AuthSession struct {
+	ID                uint       `gorm:"primaryKey;autoIncrement" json:"id"`
+	Role              string     `gorm:"type:varchar(20);not null;index:idx_auth_session_owner" json:"role"`
+	OwnerID           uint       `gorm:"not null;index:idx_auth_session_owner" json:"owner_id"`
+	RefreshTokenHash  string     `gorm:"type:varchar(64);not null;uniqueIndex" json:"-"`
+	PreviousTokenHash string     `gorm:"type:varchar(64);index" json:"-"`
+	ExpiresAt         time.Time  `gorm:"not null" json:"expires_at"`
+	LastUsedAt        time.Time  `json:"last_used_at"`
+	RevokedAt         *time.Time `json:"revoked_at,omitempty"`
+	RevokeReason      string     `gorm:"type:varchar(100)" json:"revoke_reason,omitempty"`
+	CreatedAt         time.Time  `gorm:"autoCreateTime" json:"created_at"`
+}
+
+type PasswordReset struct {
+	ID        uint       `gorm:"primaryKey;autoIncrement" json:"id"`
+	Role      string     `gorm:"type:varchar(20);not null;index:idx_password_reset_owner" json:"role"`
+	OwnerID   uint       `gorm:"not null;index:idx_password_reset_owner" json:"owner_id"`
+	CodeHash  string     `gorm:"type:varchar(64);not null" json:"-"`
+	Attempts  int        `gorm:"not null;default:0" json:"attempts"`
+	ExpiresAt time.Time  `gorm:"not null" json:"expires_at"`
+	UsedAt    *time.Time `json:"used_at,omitempty"`
+	CreatedAt time.Time  `gorm:"autoCreateTime" json:"created_at"`
+}
+
+type EmailOutbox struct {
+	ID            uint       `gorm:"primaryKey;autoIncrement" json:"id"`
+	Event         string     `gorm:"type:varchar(50);not null" json:"event"`
+	To            string     `gorm:"column:recipient;type:varchar(255);not null" json:"to"`
+	Subject       string     `gorm:"type:varchar(255);not null" json:"subject"`
+	TextBody      string     `gorm:"type:text" json:"-"`
+	HTMLBody      string     `gorm:"type:text" json:"-"`
+	Status        string     `gorm:"type:varchar(20);not null;default:'pending';index:idx_email_outbox_due" json:"status"`
+	Attempts      int        `gorm:"not null;default:0" json:"attempts"`
+	NextAttemptAt time.Time  `gorm:"not null;index:idx_email_outbox_due" json:"next_attempt_at"`
+	LastError     string     `gorm:"type:text" json:"last_error,omitempty"`
+	SentAt        *time.Time `json:"sent_at,omitempty"`
+	CreatedAt     time.Time  `gorm:"autoCreateTime" json:"created_at"`
+}
+
+type WalletTopUp struct {
+	ID               uint      `gorm:"primaryKey;autoIncrement" json:"id"`
+	UserID           uint      `gorm:"not null;index" json:"user_id"`
+	Amount           float64   `gorm:"type:decimal(10,2);not null" json:"amount"`
+	GatewayAmount    int64     `gorm:"not null" json:"gateway_amount"`
+	Gateway          string    `gorm:"type:varchar(20);not null" json:"gateway"`
+	GatewayOrderID   string    `gorm:"type:varchar(100);uniqueIndex" json:"gateway_order_id"`
+	GatewayPaymentID string    `gorm:"type:varchar(100)" json:"gateway_payment_id,omitempty"`
+	Status           string    `gorm:"type:varchar(20);not null;index" json:"status"`
+	CreatedAt        time.Time `gorm:"autoCreateTime" json:"created_at"`
+	UpdatedAt        time.Time `gorm:"autoUpdateTime" json:"updated_at"`
+}
+
+type CommissionRule struct {
+	ID         uint      `gorm:"primaryKey;autoIncrement" json:"id"`
+	Scope      string    `gorm:"type:varchar(20);not null;uniqueIndex:idx_commission_rule" json:"scope"`
+	CategoryID uint      `gorm:"uniqueIndex:idx_commission_rule" json:"category_id,omitempty"`
+	SellerID   uint      `gorm:"uniqueIndex:idx_commission_rule" json:"seller_id,omitempty"`
+	Percentage float64   `gorm:"type:decimal(5,2);not null" json:"percentage"`
+	CreatedAt  time.Time `gorm:"autoCreateTime" json:"created_at"`
+	UpdatedAt  time.Time `gorm:"autoUpdateTime" json:"updated_at"`
+}
+
+type PayoutAccount struct {
+	ID                uint      `gorm:"primaryKey;autoIncrement" json:"id"`
+	SellerID          uint      `gorm:"not null;uniqueIndex" json:"seller_id"`
+	Method            string    `gorm:"type:varchar(20);not null" json:"method"`
+	AccountHolderName string    `gorm:"type:varchar(255)" json:"account_holder_name"`
+	AccountNumber     string    `gorm:"type:varchar(50)" json:"account_number,omitempty"`
+	IFSC              string    `gorm:"type:varchar(20)" json:"ifsc,omitempty"`
+	UPIID             string    `gorm:"type:varchar(100)" json:"upi_id,omitempty"`
+	CreatedAt         time.Time `gorm:"autoCreateTime" json:"created_at"`
+	UpdatedAt         time.Time `gorm:"autoUpdateTime" json:"updated_at"`
+}
+
+type Payout struct {
+	ID            uint       `gorm:"primaryKey;autoIncrement" json:"id"`
+	SellerID      uint       `gorm:"not null;index" json:"seller_id"`
+	Amount        float64    `gorm:"type:decimal(10,2);not null" json:"amount"`
+	Status        string     `gorm:"type:varchar(20);not null;index" json:"status"`
+	Method        string     `gorm:"type:varchar(20);not null" json:"method"`
+	Destination   string     `gorm:"type:varchar(150);not null" json:"destination"`
+	BatchID       uint       `gorm:"index" json:"batch_id,omitempty"`
+	Reference     string     `gorm:"type:varchar(100)" json:"reference,omitempty"`
+	FailureReason string     `gorm:"type:varchar(500)" json:"failure_reason,omitempty"`
+	ProcessedAt   *time.Time `json:"processed_at,omitempty"`
+	RequestedAt   time.Time  `gorm:"autoCreateTime" json:"requested_at"`
+	UpdatedAt     time.Time  `gorm:"autoUpdateTime" json:"updated_at"`
+}
+
+type PayoutBatch struct {
+	ID          uint      `gorm:"primaryKey;autoIncrement" json:"id"`
+	AdminID     uint      `gorm:"not null" json:"admin_id"`
+	PayoutCount int       `gorm:"not null" json:"payout_count"`
+	TotalAmount float64   `gorm:"type:decimal(12,2);not null" json:"total_amount"`
+	CreatedAt   time.Time `gorm:"autoCreateTime" json:"created_at"`
+}
+
+type LedgerAccount struct {
+	ID        uint      `gorm:"primaryKey;autoIncrement" json:"id"`
+	Type      string    `gorm:"type:varchar(50);not null;uniqueIndex:idx_ledger_account_owner" json:"type"`
+	OwnerID   uint      `gorm:"not null;uniqueIndex:idx_ledger_account_owner" json:"owner_id"`
+	Balance   float64   `gorm:"type:decimal(14,2);not null;default:0" json:"balance"`
+	CreatedAt time.Time `gorm:"autoCreateTime" json:"created_at"`
+	UpdatedAt time.Time `gorm:"autoUpdateTime" json:"updated_at"`
+}
+
+type JournalEntry struct {
+	ID          uint            `gorm:"primaryKey;autoIncrement" json:"id"`
+	Reference   string          `gorm:"type:varchar(100);index" json:"reference"`
+	Description string          `gorm:"type:varchar(255)" json:"description"`
+	Postings    []LedgerPosting `gorm:"foreignKey:JournalEntryID" json:"postings,omitempty"`
+	CreatedAt   time.Time       `gorm:"autoCreateTime" json:"created_at"`
+}
+
+type LedgerPosting struct {
+	ID             uint      `gorm:"primaryKey;autoIncrement" json:"id"`
+	JournalEntryID uint      `gorm:"not null;index" json:"journal_entry_id"`
+	AccountID      uint      `gorm:"not null;index" json:"account_id"`
+	Amount         float64   `gorm:"type:decimal(14,2);not null" json:"amount"`
+	CreatedAt      time.Time `gorm:"autoCreateTime" json:"created_at"`
+}
+
 type SellerWallet struct {
+	ID              uint      `gorm:"primaryKey;autoIncrement" json:"id"`
 	TransactionTime time.Time `gorm:"autoCreateTime" json:"transaction_time"`
-	Type            string    `gorm:"column:type" json:"type"` //incoming //outgoing
+	Type            string    `gorm:"column:type" json:"type"` //INCOMING //OUTGOING
 	OrderID         uint      `gorm:"column:order_id" json:"order_id"`
 	SellerID        uint      `gorm:"column:seller_id" json:"seller_id"`
 	Amount          float64   `gorm:"column:amount" json:"amount"`
 	CurrentBalance  float64   `gorm:"column:current_balance" json:"current_balance"`
+	PendingBalance  float64   `gorm:"column:pending_balance" json:"pending_balance"`
+	Status          string    `gorm:"column:status;type:varchar(20);default:'available'" json:"status"` //pending //available
 	Reason          string    `gorm:"column:reason" json:"reason"`
 }
 
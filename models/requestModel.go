@@ -8,7 +8,7 @@ type EmailSignupRequest struct {
 	Name            string `validate:"required" json:"name"`
 	Email           string `validate:"required,email" json:"email"`
 	PhoneNumber     string `validate:"required,number,len=10,numeric" json:"phone_number"`
-	Password        string `validate:"required" json:"password"`
+	Password        string `validate:"required,min=8,max=72" json:"password"`
 	ConfirmPassword string `validate:"required" json:"confirmpassword"`
 }
 
@@ -19,7 +19,7 @@ type EmailLoginRequest struct {
 
 type SellerRegisterRequest struct {
 	UserName    string `validate:"required" json:"name"`
-	Password    string `validate:"required" json:"password"`
+	Password    string `validate:"required,min=8,max=72" json:"password"`
 	Description string `validate:"required" json:"description"`
 }
 
@@ -30,23 +30,25 @@ type SellerLoginRequest struct {
 }
 
 type AddProductRequest struct {
-	CategoryID  uint           `validate:"required,number" json:"categoryId"`
-	Name        string         `validate:"required" json:"name"`
-	Description string         `validate:"required" json:"description"`
-	Price       float64        `validate:"required,number" json:"price"`
-	OfferAmount float64        `validate:"required,number" json:"offer_amount"`
-	Image       pq.StringArray `validate:"required,dive,url" json:"image_url"`
+	CategoryID    uint           `validate:"required,number" json:"categoryId"`
+	Name          string         `validate:"required" json:"name"`
+	Description   string         `validate:"required" json:"description"`
+	Price         float64        `validate:"required,number" json:"price"`
+	OfferAmount   float64        `validate:"required,number" json:"offer_amount"`
+	Image         pq.StringArray `validate:"required,dive,url" json:"image_url"`
+	StockQuantity uint           `json:"stock_quantity"`
 }
 
 type EditProductRequest struct {
-	ProductID    uint           `validate:"required" json:"productId"`
-	Name         string         `json:"name"`
-	Description  string         `json:"description"`
-	Price        float64        `json:"price"`
-	OfferAmount  float64        `json:"offer_amount"`
-	Image        pq.StringArray `json:"image_url"`
-	Availability *bool          `json:"availability"`
-	CategoryID   uint           `json:"categoryid"`
+	ProductID     uint           `validate:"required" json:"productId"`
+	Name          string         `json:"name"`
+	Description   string         `json:"description"`
+	Price         float64        `json:"price"`
+	OfferAmount   float64        `json:"offer_amount"`
+	Image         pq.StringArray `json:"image_url"`
+	Availability  *bool          `json:"availability"`
+	StockQuantity *uint          `json:"stock_quantity"`
+	CategoryID    uint           `json:"categoryid"`
 }
 
 type AddCategoryRequest struct {
@@ -92,12 +94,18 @@ type EditUserProfileRequest struct {
 
 type EditPasswordRequest struct {
 	CurrentPassword string `validate:"required" json:"currentpassword"`
-	NewPassword     string `validate:"required" json:"newpassword"`
+	NewPassword     string `validate:"required,min=8,max=72" json:"newpassword"`
 	ConfirmPassword string `validate:"required" json:"confirmpassword"`
 }
 
 type AddToCartRequest struct {
 	ProductID uint `validate:"required,number" json:"productId"`
+	Quantity  uint `validate:"omitempty,min=1" json:"quantity"`
+}
+
+type UpdateCartQuantityRequest struct {
+	CartID   uint `validate:"required,number" json:"cartId"`
+	Quantity uint `validate:"required,min=1" json:"quantity"`
 }
 
 type EditSellerProfileRequest struct {
@@ -111,8 +119,110 @@ type ChangeOrderStatusRequest struct {
 }
 
 type RatingRequest struct {
-	SellerID uint    `json:"seller_id" binding:"required"`
-	Rating   float64 `json:"rating" binding:"required,min=1,max=5"`
+	OrderID uint    `json:"order_id" binding:"required"`
+	Rating  float64 `json:"rating" binding:"required,min=1,max=5"`
+}
+
+type AddProductReviewRequest struct {
+	ProductID uint     `validate:"required,number" json:"product_id"`
+	Rating    uint     `validate:"required,min=1,max=5" json:"rating"`
+	Title     string   `validate:"required,max=255" json:"title"`
+	Body      string   `validate:"max=5000" json:"body"`
+	Images    []string `validate:"max=5,dive,url" json:"image_url"`
+}
+
+type ReplyProductReviewRequest struct {
+	ReviewID uint   `validate:"required,number" json:"review_id"`
+	Reply    string `validate:"required,max=2000" json:"reply"`
+}
+
+type ReturnOrderRequest struct {
+	OrderID     uint     `validate:"required,number" json:"order_id"`
+	OrderItemID uint     `json:"order_item_id"`
+	Reason      string   `validate:"required,max=500" json:"reason"`
+	Images      []string `validate:"max=5,dive,url" json:"image_url"`
+	RefundTo    string   `validate:"omitempty,oneof=source wallet" json:"refund_to"`
+}
+
+type UpdateReturnRequest struct {
+	ReturnRequestID uint   `validate:"required,number" json:"return_request_id"`
+	Action          string `validate:"required,oneof=approve reject pickup receive" json:"action"`
+	Note            string `validate:"max=500" json:"note"`
+}
+
+type RefreshTokenRequest struct {
+	RefreshToken string `validate:"required" json:"refresh_token"`
+}
+
+type LogoutRequest struct {
+	AllDevices bool `json:"all_devices"`
+}
+
+type ForgotPasswordRequest struct {
+	Email string `validate:"required,email" json:"email"`
+}
+
+type ResetPasswordRequest struct {
+	Email           string `validate:"required,email" json:"email"`
+	OTP             string `validate:"required,len=6,numeric" json:"otp"`
+	NewPassword     string `validate:"required,min=8,max=72" json:"newpassword"`
+	ConfirmPassword string `validate:"required" json:"confirmpassword"`
+}
+
+type SellerForgotPasswordRequest struct {
+	UserName string `validate:"required" json:"username"`
+}
+
+type SellerResetPasswordRequest struct {
+	UserName        string `validate:"required" json:"username"`
+	OTP             string `validate:"required,len=6,numeric" json:"otp"`
+	NewPassword     string `validate:"required,min=8,max=72" json:"newpassword"`
+	ConfirmPassword string `validate:"required" json:"confirmpassword"`
+}
+
+type UpdateAdminRoleRequest struct {
+	AdminID uint   `validate:"required,number" json:"admin_id"`
+	Role    string `validate:"required,oneof=super catalog_manager finance support" json:"role"`
+}
+
+type WalletTopUpRequest struct {
+	Amount float64 `validate:"required,gte=1" json:"amount"`
+}
+
+type VerifyWalletTopUpRequest struct {
+	PaymentID string `validate:"required" json:"razorpay_payment_id"`
+	OrderID   string `validate:"required" json:"razorpay_order_id"`
+	Signature string `validate:"required" json:"razorpay_signature"`
+}
+
+type CommissionRuleRequest struct {
+	Scope      string  `validate:"required,oneof=global category seller" json:"scope"`
+	CategoryID uint    `validate:"required_if=Scope category" json:"category_id"`
+	SellerID   uint    `validate:"required_if=Scope seller" json:"seller_id"`
+	Percentage float64 `validate:"gte=0,lte=100" json:"percentage"`
+}
+
+type PayoutAccountRequest struct {
+	Method            string `validate:"required,oneof=bank upi" json:"method"`
+	AccountHolderName string `validate:"required,max=255" json:"account_holder_name"`
+	AccountNumber     string `validate:"required_if=Method bank,omitempty,numeric,min=6,max=20" json:"account_number"`
+	IFSC              string `validate:"required_if=Method bank,omitempty,len=11,alphanum" json:"ifsc"`
+	UPIID             string `validate:"required_if=Method upi,omitempty,max=100,contains=@" json:"upi_id"`
+}
+
+type WithdrawalRequest struct {
+	Amount float64 `validate:"required,gt=0" json:"amount"`
+}
+
+type ApprovePayoutsRequest struct {
+	PayoutIDs []uint `validate:"required,min=1,dive,required" json:"payout_ids"`
+}
+
+type UpdatePayoutRequest struct {
+	PayoutID  uint   `validate:"required,number" json:"payout_id"`
+	Action    string `validate:"required,oneof=processed failed reject" json:"action"`
+	Reference string `validate:"required_if=Action processed,max=100" json:"reference"`
+	Reason    string `validate:"max=500" json:"reason"`
 }
 
 type PlaceOrder struct {
@@ -14,11 +14,67 @@ type ProductResponse struct {
 	Price       float64 `json:"price"`
 	OfferAmount float64 `json:"offer_amount"`
 	//FinalAmount  float64        `json:"final_amount"`
-	Image        pq.StringArray `json:"image_url"`
-	Availability bool           `json:"availability"`
-	SellerID     uint           `json:"sellerid"`
-	CategoryID   uint           `json:"categoryid"`
-	SellerRating float64        `json:"sellerRating"`
+	Image         pq.StringArray `json:"image_url"`
+	Availability  bool           `json:"availability"`
+	StockQuantity uint           `json:"stock_quantity"`
+	SellerID      uint           `json:"sellerid"`
+	CategoryID    uint           `json:"categoryid"`
+	SellerRating  float64        `json:"sellerRating"`
+	Relevance     float64        `json:"relevance,omitempty"`
+	Snippet       string         `json:"snippet,omitempty"`
+	ReviewSummary
+}
+
+type ReviewSummary struct {
+	AverageRating   float64         `json:"average_rating"`
+	ReviewCount     uint            `json:"review_count"`
+	RatingHistogram map[uint]uint64 `json:"rating_histogram"`
+}
+
+type ProductReviewResponse struct {
+	ID               uint           `json:"id"`
+	ProductID        uint           `json:"product_id"`
+	UserID           uint           `json:"user_id"`
+	UserName         string         `json:"user_name"`
+	Rating           uint           `json:"rating"`
+	Title            string         `json:"title"`
+	Body             string         `json:"body"`
+	Images           pq.StringArray `json:"image_url"`
+	VerifiedPurchase bool           `json:"verified_purchase"`
+	SellerReply      string         `json:"seller_reply,omitempty"`
+	SellerRepliedAt  *time.Time     `json:"seller_replied_at,omitempty"`
+	CreatedAt        time.Time      `json:"created_at"`
+}
+
+type ProductSearchFacets struct {
+	Categories   []CategoryFacet   `json:"categories"`
+	PriceBands   []PriceBandFacet  `json:"price_bands"`
+	Ratings      []RatingFacet     `json:"ratings"`
+	Availability AvailabilityFacet `json:"availability"`
+}
+
+type CategoryFacet struct {
+	CategoryID   uint   `json:"category_id"`
+	CategoryName string `json:"category_name"`
+	Count        int64  `json:"count"`
+}
+
+type PriceBandFacet struct {
+	Label    string  `json:"label"`
+	MinPrice float64 `json:"min_price"`
+	MaxPrice float64 `json:"max_price,omitempty"`
+	Count    int64   `json:"count"`
+}
+
+type RatingFacet struct {
+	Label     string  `json:"label"`
+	MinRating float64 `json:"min_rating"`
+	Count     int64   `json:"count"`
+}
+
+type AvailabilityFacet struct {
+	Available   int64 `json:"available"`
+	Unavailable int64 `json:"unavailable"`
 }
 
 type ProductCategoryResponse struct {
@@ -107,6 +163,7 @@ type CartResponse struct {
 	Image        pq.StringArray `json:"image_url"`
 	ID           uint           `json:"Id"`
 	SellerRating float64        `json:"sellerRating"`
+	Quantity     uint           `json:"quantity,omitempty"`
 }
 
 type GetSellerOrdersResponse struct {
@@ -132,17 +189,18 @@ type GetSellerOrderStatusResponse struct {
 }
 
 type UserOrderResponse struct {
-	OrderID         uint                `json:"orderId"`
-	OrderedAt       time.Time           `json:"orderedAt"`
-	TotalAmount     float64             `json:"total_amount"`
-	DeliveryCharge  float64             `json:"delivery_charge"`
-	FinalAmount     float64             `json:"final_amount"`
-	ShippingAddress ShippingAddress     `json:"shippingAddress"`
-	Status          string              `json:"orderStatus"`
-	PaymentStatus   string              `json:"paymentStatus"`
-	PaymentMethod   string              `json:"paymentMethod"`
-	Items           []OrderItemResponse `json:"items"`
-	ItemCounts      gin.H               `json:"item_counts"`
+	OrderID         uint                 `json:"orderId"`
+	OrderedAt       time.Time            `json:"orderedAt"`
+	TotalAmount     float64              `json:"total_amount"`
+	DeliveryCharge  float64              `json:"delivery_charge"`
+	FinalAmount     float64              `json:"final_amount"`
+	ShippingAddress ShippingAddress      `json:"shippingAddress"`
+	Status          string               `json:"orderStatus"`
+	PaymentStatus   string               `json:"paymentStatus"`
+	PaymentMethod   string               `json:"paymentMethod"`
+	Items           []OrderItemResponse  `json:"items"`
+	ItemCounts      gin.H                `json:"item_counts"`
+	Timeline        []OrderStatusHistory `json:"timeline"`
 }
 
 type OrderItemResponse struct {
@@ -151,6 +209,7 @@ type OrderItemResponse struct {
 	Image       pq.StringArray `json:"image_url"`
 	CategoryID  uint           `json:"categoryId"`
 	Description string         `json:"description"`
+	Quantity    uint           `json:"quantity"`
 	Price       float64        `json:"price"`
 	FinalAmount float64        `json:"finalAmount"`
 	OrderStatus string         `json:"orderStatus"`
@@ -180,6 +239,9 @@ type AmountInformation struct {
 	TotalProuctOfferDeduction   float64 `json:"total_product_offer_deduction"`
 	TotalDeliveryCharges        float64 `json:"total_delivery_charge"`
 	TotalAmountAfterDeduction   float64 `json:"total_amount_after_deduction"`
+	TotalCommission             float64 `json:"total_commission"`
+	TotalGatewayFees            float64 `json:"total_gateway_fees"`
+	TotalSellerEarnings         float64 `json:"total_seller_earnings"`
 }
 
 type NoteResponse struct {
@@ -191,3 +253,26 @@ type NoteResponse struct {
 	Description    string `json:"description"`
 	FileURL        string `json:"file_url"`
 }
+
+type LedgerConsistencyReport struct {
+	Consistent        bool                     `json:"consistent"`
+	CheckedAt         time.Time                `json:"checked_at"`
+	PostingTotal      float64                  `json:"posting_total"`
+	UnbalancedEntries []UnbalancedJournalEntry `json:"unbalanced_entries"`
+	AccountMismatches []LedgerBalanceMismatch  `json:"account_mismatches"`
+	UserMismatches    []LedgerBalanceMismatch  `json:"user_mismatches"`
+	SellerMismatches  []LedgerBalanceMismatch  `json:"seller_mismatches"`
+}
+
+type UnbalancedJournalEntry struct {
+	JournalEntryID uint    `json:"journal_entry_id"`
+	Total          float64 `json:"total"`
+}
+
+type LedgerBalanceMismatch struct {
+	AccountID     uint    `json:"account_id,omitempty"`
+	OwnerID       uint    `json:"owner_id"`
+	Type          string  `json:"type"`
+	StoredBalance float64 `json:"stored_balance"`
+	LedgerBalance float64 `json:"ledger_balance"`
+}
@@ -0,0 +1,149 @@
+package payments
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"knowledgeMart/models"
+	"strings"
+	"sync"
+	"time"
+)
+
+const fakeSigningSecret = "knowledgemart-fake-gateway"
+
+// FakeProvider is an in-memory gateway for local development. Intents,
+// payments and refunds live only as long as the process. Each intent comes
+// with a payment ID and signature in its client data, so a checkout can be
+// completed by posting them straight to the verify endpoint.
+type FakeProvider struct {
+	mu       sync.Mutex
+	sequence int64
+	intents  map[string]Intent
+	payments map[string]PaymentStatus
+	refunds  map[string]RefundResult
+}
+
+var fakeProvider = NewFakeProvider()
+
+func NewFakeProvider() *FakeProvider {
+	return &FakeProvider{
+		intents:  make(map[string]Intent),
+		payments: make(map[string]PaymentStatus),
+		refunds:  make(map[string]RefundResult),
+	}
+}
+
+func (p *FakeProvider) Name() string {
+	return models.FakeGateway
+}
+
+func (p *FakeProvider) CreateIntent(request IntentRequest) (Intent, error) {
+	if request.Amount <= 0 {
+		return Intent{}, fmt.Errorf("amount must be greater than zero")
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	intentID := p.nextID("order_fake")
+	intent := Intent{
+		ID:         intentID,
+		Amount:     request.Amount,
+		Currency:   request.Currency,
+		Receipt:    request.Receipt,
+		Status:     "created",
+		ClientData: p.ClientData(intentID),
+	}
+	p.intents[intent.ID] = intent
+	return intent, nil
+}
+
+func (p *FakeProvider) ClientData(intentID string) map[string]string {
+	paymentID := "pay_fake_" + strings.TrimPrefix(intentID, "order_fake_")
+	return map[string]string{
+		"payment_id": paymentID,
+		"signature":  FakeSignature(intentID, paymentID),
+	}
+}
+
+func (p *FakeProvider) VerifyPayment(verification Verification) error {
+	if !hmac.Equal([]byte(FakeSignature(verification.IntentID, verification.PaymentID)), []byte(verification.Signature)) {
+		return ErrInvalidSignature
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	intent, ok := p.intents[verification.IntentID]
+	if !ok {
+		return fmt.Errorf("unknown payment intent %s", verification.IntentID)
+	}
+
+	intent.Status = "paid"
+	p.intents[intent.ID] = intent
+	p.payments[verification.PaymentID] = PaymentStatus{
+		PaymentID: verification.PaymentID,
+		IntentID:  intent.ID,
+		Amount:    intent.Amount,
+		Status:    PaymentCaptured,
+	}
+	return nil
+}
+
+func (p *FakeProvider) Refund(request RefundRequest) (RefundResult, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if refund, ok := p.refunds[request.IdempotencyKey]; ok && request.IdempotencyKey != "" {
+		return refund, nil
+	}
+
+	payment, ok := p.payments[request.PaymentID]
+	if !ok {
+		return RefundResult{}, fmt.Errorf("unknown payment %s", request.PaymentID)
+	}
+	if request.Amount <= 0 || request.Amount > payment.Amount {
+		return RefundResult{}, fmt.Errorf("refund amount exceeds the captured amount")
+	}
+
+	payment.Amount -= request.Amount
+	if payment.Amount == 0 {
+		payment.Status = "refunded"
+	}
+	p.payments[payment.PaymentID] = payment
+
+	refund := RefundResult{
+		ID:        p.nextID("rfnd_fake"),
+		PaymentID: payment.PaymentID,
+		Amount:    request.Amount,
+		Status:    "processed",
+	}
+	if request.IdempotencyKey != "" {
+		p.refunds[request.IdempotencyKey] = refund
+	}
+	return refund, nil
+}
+
+func (p *FakeProvider) FetchStatus(paymentID string) (PaymentStatus, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	payment, ok := p.payments[paymentID]
+	if !ok {
+		return PaymentStatus{}, fmt.Errorf("unknown payment %s", paymentID)
+	}
+	return payment, nil
+}
+
+func (p *FakeProvider) nextID(prefix string) string {
+	p.sequence++
+	return fmt.Sprintf("%s_%d%d", prefix, time.Now().Unix(), p.sequence)
+}
+
+func FakeSignature(intentID, paymentID string) string {
+	h := hmac.New(sha256.New, []byte(fakeSigningSecret))
+	h.Write([]byte(intentID + "|" + paymentID))
+	return hex.EncodeToString(h.Sum(nil))
+}
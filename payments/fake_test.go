@@ -0,0 +1,111 @@
+package payments
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestFakeProviderPaymentFlow(t *testing.T) {
+	provider := NewFakeProvider()
+
+	intent, err := provider.CreateIntent(IntentRequest{Amount: 25000, Currency: "INR", Receipt: "checkout_1"})
+	if err != nil {
+		t.Fatalf("CreateIntent() error = %v", err)
+	}
+	if intent.Amount != 25000 || intent.Status != "created" {
+		t.Fatalf("CreateIntent() = %+v, want a created intent for 25000", intent)
+	}
+
+	paymentID := intent.ClientData["payment_id"]
+	signature := intent.ClientData["signature"]
+
+	if _, err := provider.FetchStatus(paymentID); err == nil {
+		t.Errorf("FetchStatus() before payment succeeded, want an error")
+	}
+
+	if err := provider.VerifyPayment(Verification{IntentID: intent.ID, PaymentID: paymentID, Signature: "bad"}); !errors.Is(err, ErrInvalidSignature) {
+		t.Errorf("VerifyPayment() with a bad signature error = %v, want %v", err, ErrInvalidSignature)
+	}
+	if err := provider.VerifyPayment(Verification{IntentID: intent.ID, PaymentID: paymentID, Signature: signature}); err != nil {
+		t.Fatalf("VerifyPayment() error = %v", err)
+	}
+
+	status, err := provider.FetchStatus(paymentID)
+	if err != nil {
+		t.Fatalf("FetchStatus() error = %v", err)
+	}
+	if status.Status != PaymentCaptured || status.Amount != 25000 || status.IntentID != intent.ID {
+		t.Errorf("FetchStatus() = %+v, want captured 25000 for %s", status, intent.ID)
+	}
+
+	if _, err := provider.Refund(RefundRequest{PaymentID: paymentID, Amount: 30000}); err == nil {
+		t.Errorf("Refund() above the captured amount succeeded, want an error")
+	}
+
+	refund, err := provider.Refund(RefundRequest{PaymentID: paymentID, Amount: 10000})
+	if err != nil {
+		t.Fatalf("Refund() error = %v", err)
+	}
+	if refund.Amount != 10000 || refund.Status != "processed" || refund.PaymentID != paymentID {
+		t.Errorf("Refund() = %+v, want 10000 processed for %s", refund, paymentID)
+	}
+	if status, _ := provider.FetchStatus(paymentID); status.Status != PaymentCaptured || status.Amount != 15000 {
+		t.Errorf("FetchStatus() after a partial refund = %+v, want captured 15000", status)
+	}
+
+	first, err := provider.Refund(RefundRequest{PaymentID: paymentID, Amount: 15000, IdempotencyKey: "refund_1"})
+	if err != nil {
+		t.Fatalf("Refund() of the rest error = %v", err)
+	}
+	again, err := provider.Refund(RefundRequest{PaymentID: paymentID, Amount: 15000, IdempotencyKey: "refund_1"})
+	if err != nil || again.ID != first.ID {
+		t.Errorf("Refund() repeated with the same key = %+v, %v, want %s again", again, err, first.ID)
+	}
+	if status, _ := provider.FetchStatus(paymentID); status.Status != "refunded" || status.Amount != 0 {
+		t.Errorf("FetchStatus() after a full refund = %+v, want refunded", status)
+	}
+}
+
+func TestFakeProviderRejects(t *testing.T) {
+	provider := NewFakeProvider()
+
+	tests := []struct {
+		name string
+		call func() error
+	}{
+		{"intent without amount", func() error {
+			_, err := provider.CreateIntent(IntentRequest{Currency: "INR"})
+			return err
+		}},
+		{"payment for an unknown intent", func() error {
+			return provider.VerifyPayment(Verification{
+				IntentID:  "order_fake_missing",
+				PaymentID: "pay_fake_missing",
+				Signature: FakeSignature("order_fake_missing", "pay_fake_missing"),
+			})
+		}},
+		{"refund of an unknown payment", func() error {
+			_, err := provider.Refund(RefundRequest{PaymentID: "pay_fake_missing", Amount: 100})
+			return err
+		}},
+		{"status of an unknown payment", func() error {
+			_, err := provider.FetchStatus("pay_fake_missing")
+			return err
+		}},
+	}
+
+	for _, test := range tests {
+		if err := test.call(); err == nil {
+			t.Errorf("%s: succeeded, want an error", test.name)
+		}
+	}
+}
+
+func TestFakeProviderSignatureDependsOnIntentAndPayment(t *testing.T) {
+	if FakeSignature("order_1", "pay_1") == FakeSignature("order_1", "pay_2") {
+		t.Errorf("FakeSignature() is the same for different payments")
+	}
+	if FakeSignature("order_1", "pay_1") == FakeSignature("order_2", "pay_1") {
+		t.Errorf("FakeSignature() is the same for different intents")
+	}
+}
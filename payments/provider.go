@@ -0,0 +1,97 @@
+package payments
+
+import (
+	"errors"
+	"fmt"
+	"knowledgeMart/models"
+	"os"
+	"strings"
+)
+
+var ErrInvalidSignature = errors.New("invalid payment signature")
+
+// PaymentCaptured is the status of a payment whose money the gateway has
+// taken. Anything else, such as authorized or failed, must not be fulfilled.
+const PaymentCaptured = "captured"
+
+// PaymentProvider is implemented by every payment gateway the checkout can
+// use. Amounts are in the smallest currency unit (paise for INR).
+type PaymentProvider interface {
+	Name() string
+	CreateIntent(request IntentRequest) (Intent, error)
+	ClientData(intentID string) map[string]string
+	VerifyPayment(verification Verification) error
+	Refund(request RefundRequest) (RefundResult, error)
+	FetchStatus(paymentID string) (PaymentStatus, error)
+}
+
+type IntentRequest struct {
+	Amount   int64
+	Currency string
+	Receipt  string
+	Notes    map[string]string
+}
+
+type Intent struct {
+	ID       string
+	Amount   int64
+	Currency string
+	Receipt  string
+	Status   string
+	// ClientData is handed to the checkout page as-is, e.g. the public key
+	// the gateway's browser SDK needs.
+	ClientData map[string]string
+}
+
+type Verification struct {
+	IntentID  string
+	PaymentID string
+	Signature string
+}
+
+type RefundRequest struct {
+	PaymentID string
+	Amount    int64
+	Receipt   string
+	Notes     map[string]string
+	// IdempotencyKey identifies the refund on our side. Asking again with
+	// the same key returns the refund already made instead of a second one.
+	IdempotencyKey string
+}
+
+type RefundResult struct {
+	ID        string
+	PaymentID string
+	Amount    int64
+	Status    string
+}
+
+type PaymentStatus struct {
+	PaymentID string
+	IntentID  string
+	Amount    int64
+	Status    string
+}
+
+// NewProvider returns the gateway selected by PAYMENT_PROVIDER, defaulting to
+// Razorpay when it is unset.
+func NewProvider() (PaymentProvider, error) {
+	name := os.Getenv("PAYMENT_PROVIDER")
+	if name == "" {
+		name = models.Razorpay
+	}
+	return ProviderFor(name)
+}
+
+// ProviderFor returns the gateway with the given name, used to act on a
+// payment that was taken through that gateway.
+func ProviderFor(name string) (PaymentProvider, error) {
+	switch strings.ToUpper(name) {
+	case models.Razorpay:
+		return NewRazorpayProvider(os.Getenv("RAZORPAY_KEY_ID"), os.Getenv("RAZORPAY_KEY_SECRET")), nil
+	case models.FakeGateway:
+		return fakeProvider, nil
+	default:
+		return nil, fmt.Errorf("unsupported payment provider %q", name)
+	}
+}
@@ -0,0 +1,162 @@
+package payments
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"knowledgeMart/models"
+	"os"
+
+	"github.com/razorpay/razorpay-go"
+)
+
+type RazorpayProvider struct {
+	client    *razorpay.Client
+	keyID     string
+	keySecret string
+}
+
+func NewRazorpayProvider(keyID, keySecret string) *RazorpayProvider {
+	client := razorpay.NewClient(keyID, keySecret)
+	// RAZORPAY_API_URL points the client at another API host, such as a local
+	// stand-in during tests
+	if apiURL := os.Getenv("RAZORPAY_API_URL"); apiURL != "" {
+		client.Payment.Request.BaseURL = apiURL
+	}
+
+	return &RazorpayProvider{
+		client:    client,
+		keyID:     keyID,
+		keySecret: keySecret,
+	}
+}
+
+func (p *RazorpayProvider) Name() string {
+	return models.Razorpay
+}
+
+func (p *RazorpayProvider) CreateIntent(request IntentRequest) (Intent, error) {
+	notes := make(map[string]interface{}, len(request.Notes))
+	for key, value := range request.Notes {
+		notes[key] = value
+	}
+
+	order, err := p.client.Order.Create(map[string]interface{}{
+		"amount":   request.Amount,
+		"currency": request.Currency,
+		"receipt":  request.Receipt,
+		"notes":    notes,
+	}, nil)
+	if err != nil {
+		return Intent{}, fmt.Errorf("failed to create razorpay order: %w", err)
+	}
+
+	return Intent{
+		ID:         stringField(order, "id"),
+		Amount:     int64Field(order, "amount"),
+		Currency:   stringField(order, "currency"),
+		Receipt:    stringField(order, "receipt"),
+		Status:     stringField(order, "status"),
+		ClientData: p.ClientData(stringField(order, "id")),
+	}, nil
+}
+
+func (p *RazorpayProvider) ClientData(intentID string) map[string]string {
+	return map[string]string{
+		"key_id": p.keyID,
+	}
+}
+
+func (p *RazorpayProvider) VerifyPayment(verification Verification) error {
+	h := hmac.New(sha256.New, []byte(p.keySecret))
+	h.Write([]byte(verification.IntentID + "|" + verification.PaymentID))
+	expectedSignature := hex.EncodeToString(h.Sum(nil))
+
+	if !hmac.Equal([]byte(expectedSignature), []byte(verification.Signature)) {
+		return ErrInvalidSignature
+	}
+	return nil
+}
+
+// Refund sends the idempotency key as the refund receipt and, when a refund
+// with that receipt already exists on the payment, returns it instead of
+// refunding again.
+func (p *RazorpayProvider) Refund(request RefundRequest) (RefundResult, error) {
+	if request.IdempotencyKey != "" {
+		request.Receipt = request.IdempotencyKey
+
+		existing, err := p.client.Payment.FetchMultipleRefund(request.PaymentID, map[string]interface{}{"count": 100}, nil)
+		if err != nil {
+			return RefundResult{}, fmt.Errorf("failed to fetch razorpay refunds: %w", err)
+		}
+		items, _ := existing["items"].([]interface{})
+		for _, item := range items {
+			refund, ok := item.(map[string]interface{})
+			if ok && stringField(refund, "receipt") == request.IdempotencyKey {
+				return razorpayRefundResult(refund), nil
+			}
+		}
+	}
+
+	data := map[string]interface{}{}
+	if request.Receipt != "" {
+		data["receipt"] = request.Receipt
+	}
+	if len(request.Notes) > 0 {
+		notes := make(map[string]interface{}, len(request.Notes))
+		for key, value := range request.Notes {
+			notes[key] = value
+		}
+		data["notes"] = notes
+	}
+
+	refund, err := p.client.Payment.Refund(request.PaymentID, int(request.Amount), data, nil)
+	if err != nil {
+		return RefundResult{}, fmt.Errorf("failed to create razorpay refund: %w", err)
+	}
+
+	return razorpayRefundResult(refund), nil
+}
+
+func razorpayRefundResult(refund map[string]interface{}) RefundResult {
+	return RefundResult{
+		ID:        stringField(refund, "id"),
+		PaymentID: stringField(refund, "payment_id"),
+		Amount:    int64Field(refund, "amount"),
+		Status:    stringField(refund, "status"),
+	}
+}
+
+func (p *RazorpayProvider) FetchStatus(paymentID string) (PaymentStatus, error) {
+	payment, err := p.client.Payment.Fetch(paymentID, nil, nil)
+	if err != nil {
+		return PaymentStatus{}, fmt.Errorf("failed to fetch razorpay payment: %w", err)
+	}
+
+	return PaymentStatus{
+		PaymentID: stringField(payment, "id"),
+		IntentID:  stringField(payment, "order_id"),
+		Amount:    int64Field(payment, "amount"),
+		Status:    stringField(payment, "status"),
+	}, nil
+}
+
+func stringField(values map[string]interface{}, key string) string {
+	value, _ := values[key].(string)
+	return value
+}
+
+// int64Field reads a numeric field from a decoded Razorpay response, where
+// JSON numbers arrive as float64.
+func int64Field(values map[string]interface{}, key string) int64 {
+	switch value := values[key].(type) {
+	case float64:
+		return int64(value)
+	case int64:
+		return value
+	case int:
+		return int64(value)
+	}
+	return 0
+}
@@ -3,6 +3,7 @@ package routes
 import (
 	"knowledgeMart/controllers"
 	"knowledgeMart/middleware"
+	"knowledgeMart/models"
 
 	"github.com/gin-gonic/gin"
 )
@@ -23,6 +24,8 @@ func RegisterRoutes(router *gin.Engine) {
 	//user auth
 	router.POST("/api/v1/user/signup", controllers.EmailSignup)
 	router.POST("/api/v1/user/login", controllers.EmailLogin)
+	router.POST("/api/v1/user/password/forgot", controllers.ForgotPassword)
+	router.POST("/api/v1/user/password/reset", controllers.ResetPassword)
 
 	//user google auth
 	router.GET("/api/v1/googlelogin", controllers.GoogleHandleLogin)
@@ -34,10 +37,17 @@ func RegisterRoutes(router *gin.Engine) {
 
 	//seller auth
 	router.POST("/api/v1/seller/login", controllers.SellerLogin)
+	router.POST("/api/v1/seller/password/forgot", controllers.SellerForgotPassword)
+	router.POST("/api/v1/seller/password/reset", controllers.SellerResetPassword)
+
+	//session
+	router.POST("/api/v1/auth/refresh", controllers.RefreshSession)
+	router.POST("/api/v1/auth/logout", middleware.AuthRequired, controllers.Logout)
 
 	//products search
 	router.GET("/api/v1/public/product/search", controllers.SearchProducts)
 	router.GET("/api/v1/public/category/all", controllers.ListAllCategory)
+	router.GET("/api/v1/public/product/reviews", controllers.GetProductReviews)
 
 	//coupon
 	router.GET("/api/v1/public/coupon/all", controllers.GetAllCoupons)
@@ -47,7 +57,7 @@ func RegisterRoutes(router *gin.Engine) {
 	router.GET("/api/v1/public/notes/all", controllers.GetAllNotes)
 
 	userRoutes := router.Group("/api/v1/user")
-	userRoutes.Use(middleware.AuthRequired)
+	userRoutes.Use(middleware.AuthRequired, middleware.RequireRole(models.RoleUser))
 	{
 		userRoutes.POST("/seller/registration", controllers.SellerRegister)
 
@@ -60,11 +70,14 @@ func RegisterRoutes(router *gin.Engine) {
 		//profile
 		userRoutes.GET("/profile", controllers.GetUserProfile)
 		userRoutes.PUT("/profile/edit", controllers.EditUserProfile)
+		userRoutes.GET("/profile/google/link", controllers.LinkGoogleAccount)
+		userRoutes.DELETE("/profile/google/unlink", controllers.UnlinkGoogleAccount)
 		userRoutes.PATCH("/password/edit", controllers.EditPassword)
 
 		//cart
 		userRoutes.POST("/cart/add", controllers.AddToCart)
 		userRoutes.GET("/cart/view", controllers.ListAllCart)
+		userRoutes.PATCH("/cart/update", controllers.UpdateCartQuantity)
 		userRoutes.DELETE("/cart/remove", controllers.RemoveItemFromCart)
 		userRoutes.GET("/coupon/cart", controllers.ApplyCouponOnCart)
 
@@ -72,7 +85,9 @@ func RegisterRoutes(router *gin.Engine) {
 		userRoutes.POST("/order/create", controllers.PlaceOrder)
 		userRoutes.GET("/order/check", controllers.UserCheckOrderStatus)
 		userRoutes.PATCH("/order/cancel", controllers.CancelOrder)
-		userRoutes.PATCH("/order/return", controllers.ReturnOrder)
+		userRoutes.POST("/order/return", controllers.ReturnOrder)
+		userRoutes.GET("/order/returns", controllers.GetUserReturnRequests)
+		userRoutes.GET("/order/refunds", controllers.GetUserRefunds)
 		userRoutes.GET("/order/invoice", controllers.OrderInvoice)
 
 		//note sharing
@@ -84,6 +99,7 @@ func RegisterRoutes(router *gin.Engine) {
 
 		//rating
 		userRoutes.POST("/seller-rating", controllers.SellerRating)
+		userRoutes.POST("/product/review", controllers.AddProductReview)
 
 		//whishlist
 		userRoutes.POST("/whishlist/add", controllers.AddToWhishList)
@@ -92,23 +108,32 @@ func RegisterRoutes(router *gin.Engine) {
 
 		//wallet history
 		userRoutes.GET("/wallet/history", controllers.GetUserWalletHistory)
+		userRoutes.POST("/wallet/topup", controllers.CreateWalletTopUp)
+		userRoutes.POST("/wallet/topup/verify", controllers.VerifyWalletTopUp)
 
 	}
 	//razorpay
-	router.POST("/verify-payment/:orderID", controllers.VerifyPayment)
-	router.POST("/payment-failed/:orderID", controllers.HandleFailedPayment)
 	router.GET("/payment-method", controllers.RenderRazorpay)
-	router.POST("/create-order/:orderID", controllers.CreateOrder)
-	router.GET("/check-failed-attempts/:orderID", controllers.CheckFailedAttempts)
+	router.POST("/webhooks/razorpay", controllers.RazorpayWebhook)
+
+	paymentRoutes := router.Group("")
+	paymentRoutes.Use(middleware.AuthRequired, middleware.RequireRole(models.RoleUser))
+	{
+		paymentRoutes.POST("/create-order/:checkoutID", controllers.CreateOrder)
+		paymentRoutes.POST("/verify-payment/:checkoutID", controllers.VerifyPayment)
+		paymentRoutes.POST("/payment-failed/:checkoutID", controllers.HandleFailedPayment)
+		paymentRoutes.GET("/check-failed-attempts/:checkoutID", controllers.CheckFailedAttempts)
+	}
 
 	sellerRoutes := router.Group("/api/v1/seller")
-	sellerRoutes.Use(middleware.AuthRequired)
+	sellerRoutes.Use(middleware.AuthRequired, middleware.RequireRole(models.RoleSeller))
 	{
 		//products
 		sellerRoutes.POST("/product/add", controllers.AddProduct)
 		sellerRoutes.PUT("/product/edit", controllers.EditProduct)
 		sellerRoutes.DELETE("/product/delete", controllers.DeleteProduct)
 		sellerRoutes.GET("/product/view", controllers.ListProductBySeller)
+		sellerRoutes.POST("/product/review/reply", controllers.ReplyToProductReview)
 
 		//profile
 		sellerRoutes.GET("/profile", controllers.GetSellerProfile)
@@ -119,6 +144,8 @@ func RegisterRoutes(router *gin.Engine) {
 		sellerRoutes.GET("/order/view", controllers.GetUserOrders)
 		sellerRoutes.PATCH("/order/status/update", controllers.SellerUpdateOrderStatus)
 		sellerRoutes.PATCH("/order/status/cancel", controllers.CancelOrder)
+		sellerRoutes.GET("/order/returns", controllers.GetSellerReturnRequests)
+		sellerRoutes.PATCH("/order/return/update", controllers.SellerUpdateReturnRequest)
 
 		//sales report
 		sellerRoutes.GET("/report/all", controllers.SellerOverAllSalesReport)
@@ -128,6 +155,12 @@ func RegisterRoutes(router *gin.Engine) {
 		//wallet history
 		sellerRoutes.GET("/wallet/history", controllers.GetSellerWalletHistory)
 
+		//payouts
+		sellerRoutes.POST("/payout/account", controllers.SavePayoutAccount)
+		sellerRoutes.GET("/payout/account", controllers.GetPayoutAccount)
+		sellerRoutes.POST("/payout/withdraw", controllers.RequestWithdrawal)
+		sellerRoutes.GET("/payouts", controllers.GetSellerPayouts)
+
 		//top selling
 		sellerRoutes.GET("/product/top-selling", controllers.TopSellingProduct)
 		sellerRoutes.GET("/category/top-selling", controllers.TopSellingCategory)
@@ -135,43 +168,65 @@ func RegisterRoutes(router *gin.Engine) {
 	}
 
 	adminRoutes := router.Group("/api/v1/admin")
-	adminRoutes.Use(middleware.AuthRequired)
+	adminRoutes.Use(middleware.AuthRequired, middleware.RequireRole(models.RoleAdmin))
+
+	//admin sub-roles, super admins pass every check
+	catalog := middleware.RequireAdminRole(models.AdminRoleCatalogManager)
+	finance := middleware.RequireAdminRole(models.AdminRoleFinance)
+	support := middleware.RequireAdminRole(models.AdminRoleSupport)
+	superAdmin := middleware.RequireAdminRole()
 	{
 		//category
-		adminRoutes.POST("/category/add", controllers.AddCatogory)
-		adminRoutes.PUT("/category/edit", controllers.EditCategory)
-		adminRoutes.DELETE("/category/delete", controllers.DeleteCategory)
+		adminRoutes.POST("/category/add", catalog, controllers.AddCatogory)
+		adminRoutes.PUT("/category/edit", catalog, controllers.EditCategory)
+		adminRoutes.DELETE("/category/delete", catalog, controllers.DeleteCategory)
 
 		//user management
-		adminRoutes.GET("/view/users", controllers.ListAllUsers)
-		adminRoutes.GET("/view/blocked-users", controllers.ListBlockedUsers)
-		adminRoutes.PATCH("/block/user", controllers.BlockUser)
-		adminRoutes.PATCH("/unblock/user", controllers.UnBlockUser)
+		adminRoutes.GET("/view/users", support, controllers.ListAllUsers)
+		adminRoutes.GET("/view/blocked-users", support, controllers.ListBlockedUsers)
+		adminRoutes.PATCH("/block/user", support, controllers.BlockUser)
+		adminRoutes.PATCH("/unblock/user", support, controllers.UnBlockUser)
 
 		//seller management
-		adminRoutes.GET("/view/sellers", controllers.ListAllSellers)
-		adminRoutes.PATCH("/verify/seller", controllers.VerifySeller)
-		adminRoutes.PATCH("/un-verify/seller", controllers.NotVerifySeller)
+		adminRoutes.GET("/view/sellers", support, controllers.ListAllSellers)
+		adminRoutes.PATCH("/verify/seller", support, controllers.VerifySeller)
+		adminRoutes.PATCH("/un-verify/seller", support, controllers.NotVerifySeller)
 
 		//Coupon management
-		adminRoutes.POST("/coupon/create", controllers.CreateCoupen)
-		adminRoutes.PATCH("/coupon/update", controllers.UpdateCoupon)
-		adminRoutes.DELETE("/coupon/delete", controllers.DeleteCoupon)
+		adminRoutes.POST("/coupon/create", catalog, controllers.CreateCoupen)
+		adminRoutes.PATCH("/coupon/update", catalog, controllers.UpdateCoupon)
+		adminRoutes.DELETE("/coupon/delete", catalog, controllers.DeleteCoupon)
 
 		//course management
-		adminRoutes.POST("/course/create", controllers.CreateCourse)
-		adminRoutes.PATCH("/course/edit", controllers.EditCourse)
-		adminRoutes.DELETE("/course/delete", controllers.DeleteCourse)
+		adminRoutes.POST("/course/create", catalog, controllers.CreateCourse)
+		adminRoutes.PATCH("/course/edit", catalog, controllers.EditCourse)
+		adminRoutes.DELETE("/course/delete", catalog, controllers.DeleteCourse)
 
 		//semester management
-		adminRoutes.POST("/semester/create", controllers.CreateSemester)
-		adminRoutes.PATCH("/semester/edit", controllers.EditSemester)
-		adminRoutes.DELETE("/semester/delete", controllers.DeleteSemester)
+		adminRoutes.POST("/semester/create", catalog, controllers.CreateSemester)
+		adminRoutes.PATCH("/semester/edit", catalog, controllers.EditSemester)
+		adminRoutes.DELETE("/semester/delete", catalog, controllers.DeleteSemester)
 
 		//subject management
-		adminRoutes.POST("/subject/create", controllers.CreateSubject)
-		adminRoutes.PATCH("/subject/edit", controllers.EditSubject)
-		adminRoutes.DELETE("/subject/delete", controllers.DeleteSubject)
+		adminRoutes.POST("/subject/create", catalog, controllers.CreateSubject)
+		adminRoutes.PATCH("/subject/edit", catalog, controllers.EditSubject)
+		adminRoutes.DELETE("/subject/delete", catalog, controllers.DeleteSubject)
+
+		//ledger
+		adminRoutes.GET("/ledger/consistency", finance, controllers.CheckLedgerConsistency)
+
+		//commission
+		adminRoutes.POST("/commission/rule", finance, controllers.SaveCommissionRule)
+		adminRoutes.GET("/commission/rules", finance, controllers.ListCommissionRules)
+		adminRoutes.DELETE("/commission/rule", finance, controllers.DeleteCommissionRule)
+
+		//payouts
+		adminRoutes.GET("/payouts", finance, controllers.AdminListPayouts)
+		adminRoutes.POST("/payout/approve", finance, controllers.ApprovePayouts)
+		adminRoutes.PATCH("/payout/update", finance, controllers.UpdatePayout)
+
+		//admin roles
+		adminRoutes.PATCH("/role/update", superAdmin, controllers.UpdateAdminRole)
 
 	}
 
@@ -1,10 +1,14 @@
 package utils
 
 import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
 	"errors"
-	"fmt"
+	"io/fs"
 	"log"
 	"os"
+	"strconv"
 	"time"
 
 	//"github.com/gin-gonic/gin"
@@ -12,29 +16,43 @@ import (
 	"github.com/joho/godotenv"
 )
 
+// init loads .env when there is one. Without it the settings are taken from
+// the environment as is, which is how tests and containers run.
 func init() {
 	err := godotenv.Load(".env")
-	if err != nil {
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
 		log.Fatal("Error loading .env file")
 	}
 }
 
+const defaultAccessTokenMinutes = 15
+
 type JWTClaims struct {
-	ID   uint   `json:"userId"`
-	Role string `json:"role"`
+	ID        uint   `json:"userId"`
+	Role      string `json:"role"`
+	SessionID uint   `json:"sid"`
 	jwt.RegisteredClaims
 }
 
-func GenerateJWT(userID uint, role string) (string, error) {
-	secret := os.Getenv("JWTSECRET")
+// AccessTokenTTL is how long an access token is valid, configured in minutes
+// through ACCESS_TOKEN_TTL_MINUTES. Sessions outlive it through refresh tokens.
+func AccessTokenTTL() time.Duration {
+	minutes, err := strconv.Atoi(os.Getenv("ACCESS_TOKEN_TTL_MINUTES"))
+	if err != nil || minutes <= 0 {
+		minutes = defaultAccessTokenMinutes
+	}
+	return time.Duration(minutes) * time.Minute
+}
 
-	expirationTime := time.Now().Add(150 * time.Hour)
+func GenerateJWT(userID uint, role string, sessionID uint) (string, error) {
+	secret := os.Getenv("JWTSECRET")
 
-	fmt.Println("user id :", userID)
+	expirationTime := time.Now().Add(AccessTokenTTL())
 
 	claims := &JWTClaims{
-		ID:   userID,
-		Role: role,
+		ID:        userID,
+		Role:      role,
+		SessionID: sessionID,
 		RegisteredClaims: jwt.RegisteredClaims{
 			ExpiresAt: jwt.NewNumericDate(expirationTime),
 			IssuedAt:  jwt.NewNumericDate(time.Now()),
@@ -71,3 +89,17 @@ func ValidateJWT(tokenString string) (*JWTClaims, error) {
 	return nil, errors.New("invalid token")
 
 }
+
+// GenerateRefreshToken returns a random opaque token. Only its hash is stored.
+func GenerateRefreshToken() (string, error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(buf), nil
+}
+
+func HashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
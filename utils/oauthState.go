@@ -0,0 +1,83 @@
+package utils
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+)
+
+const OAuthStateTTL = 10 * time.Minute
+
+var ErrInvalidOAuthState = errors.New("invalid or expired oauth state")
+
+// OAuthState is carried through the provider's redirect in the state
+// parameter. Nonce is also kept in a cookie on the browser that started the
+// flow, so a callback started by someone else is rejected.
+type OAuthState struct {
+	Nonce     string `json:"n"`
+	Purpose   string `json:"p"`
+	UserID    uint   `json:"u,omitempty"`
+	ExpiresAt int64  `json:"e"`
+}
+
+// NewOAuthState creates a state for purpose, signed with JWTSECRET, and
+// returns it together with its nonce.
+func NewOAuthState(purpose string, userID uint) (state string, nonce string, err error) {
+	raw := make([]byte, 16)
+	if _, err := rand.Read(raw); err != nil {
+		return "", "", fmt.Errorf("failed to generate oauth state: %w", err)
+	}
+	nonce = hex.EncodeToString(raw)
+
+	payload, err := json.Marshal(OAuthState{
+		Nonce:     nonce,
+		Purpose:   purpose,
+		UserID:    userID,
+		ExpiresAt: time.Now().Add(OAuthStateTTL).Unix(),
+	})
+	if err != nil {
+		return "", "", fmt.Errorf("failed to generate oauth state: %w", err)
+	}
+
+	encoded := base64.RawURLEncoding.EncodeToString(payload)
+	return encoded + "." + signOAuthState(encoded), nonce, nil
+}
+
+// ParseOAuthState checks the signature and expiry of state and that it was
+// issued to the browser holding nonce.
+func ParseOAuthState(state, nonce string) (OAuthState, error) {
+	encoded, signature, found := strings.Cut(state, ".")
+	if !found || !hmac.Equal([]byte(signature), []byte(signOAuthState(encoded))) {
+		return OAuthState{}, ErrInvalidOAuthState
+	}
+
+	payload, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil {
+		return OAuthState{}, ErrInvalidOAuthState
+	}
+
+	var parsed OAuthState
+	if err := json.Unmarshal(payload, &parsed); err != nil {
+		return OAuthState{}, ErrInvalidOAuthState
+	}
+
+	if time.Now().Unix() > parsed.ExpiresAt ||
+		nonce == "" || !hmac.Equal([]byte(parsed.Nonce), []byte(nonce)) {
+		return OAuthState{}, ErrInvalidOAuthState
+	}
+	return parsed, nil
+}
+
+func signOAuthState(encoded string) string {
+	mac := hmac.New(sha256.New, []byte(os.Getenv("JWTSECRET")))
+	mac.Write([]byte("oauth-state:" + encoded))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
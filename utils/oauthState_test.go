@@ -0,0 +1,87 @@
+package utils
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseOAuthState(t *testing.T) {
+	t.Setenv("JWTSECRET", "test-secret")
+
+	state, nonce, err := NewOAuthState("link", 7)
+	if err != nil {
+		t.Fatalf("NewOAuthState() error = %v", err)
+	}
+
+	encoded, signature, _ := strings.Cut(state, ".")
+	expired := func() string {
+		payload, _ := json.Marshal(OAuthState{
+			Nonce:     nonce,
+			Purpose:   "link",
+			ExpiresAt: time.Now().Add(-time.Minute).Unix(),
+		})
+		encoded := base64.RawURLEncoding.EncodeToString(payload)
+		return encoded + "." + signOAuthState(encoded)
+	}()
+	tampered := func() string {
+		payload, _ := json.Marshal(OAuthState{
+			Nonce:     nonce,
+			Purpose:   "link",
+			UserID:    8,
+			ExpiresAt: time.Now().Add(time.Minute).Unix(),
+		})
+		return base64.RawURLEncoding.EncodeToString(payload) + "." + signature
+	}()
+
+	tests := []struct {
+		name    string
+		state   string
+		nonce   string
+		wantErr bool
+	}{
+		{"valid", state, nonce, false},
+		{"wrong nonce", state, strings.Repeat("0", len(nonce)), true},
+		{"missing nonce", state, "", true},
+		{"missing signature", encoded, nonce, true},
+		{"wrong signature", encoded + ".c2lnbmF0dXJl", nonce, true},
+		{"payload changed", tampered, nonce, true},
+		{"payload not base64", "%%%." + signOAuthState("%%%"), nonce, true},
+		{"payload not json", "bm90LWpzb24." + signOAuthState("bm90LWpzb24"), nonce, true},
+		{"expired", expired, nonce, true},
+		{"empty", "", nonce, true},
+	}
+
+	for _, test := range tests {
+		parsed, err := ParseOAuthState(test.state, test.nonce)
+		if test.wantErr {
+			if !errors.Is(err, ErrInvalidOAuthState) {
+				t.Errorf("%s: ParseOAuthState() error = %v, want %v", test.name, err, ErrInvalidOAuthState)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: ParseOAuthState() error = %v", test.name, err)
+			continue
+		}
+		if parsed.Purpose != "link" || parsed.UserID != 7 || parsed.Nonce != nonce {
+			t.Errorf("%s: ParseOAuthState() = %+v, want purpose link for user 7", test.name, parsed)
+		}
+	}
+}
+
+func TestParseOAuthStateSecretChanged(t *testing.T) {
+	t.Setenv("JWTSECRET", "old-secret")
+	state, nonce, err := NewOAuthState("login", 0)
+	if err != nil {
+		t.Fatalf("NewOAuthState() error = %v", err)
+	}
+
+	t.Setenv("JWTSECRET", "new-secret")
+	if _, err := ParseOAuthState(state, nonce); !errors.Is(err, ErrInvalidOAuthState) {
+		t.Errorf("ParseOAuthState() error = %v, want %v", err, ErrInvalidOAuthState)
+	}
+}
@@ -0,0 +1,158 @@
+package utils
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+const (
+	DefaultPageLimit = 20
+	MaxPageLimit     = 100
+)
+
+type PageRequest struct {
+	Page       int
+	Limit      int
+	Cursor     string
+	CursorMode bool
+}
+
+type PageInfo struct {
+	Page       int    `json:"page,omitempty"`
+	Limit      int    `json:"limit"`
+	TotalCount int64  `json:"total_count"`
+	TotalPages int64  `json:"total_pages"`
+	HasMore    bool   `json:"has_more"`
+	NextCursor string `json:"next_cursor,omitempty"`
+	Next       string `json:"next,omitempty"`
+}
+
+// ParsePageRequest reads page/limit, or cursor when the "cursor" query key is
+// present (an empty cursor starts cursor mode from the first row).
+func ParsePageRequest(c *gin.Context) (PageRequest, error) {
+	request := PageRequest{Page: 1, Limit: DefaultPageLimit}
+
+	if limitStr := c.Query("limit"); limitStr != "" {
+		limit, err := strconv.Atoi(limitStr)
+		if err != nil || limit < 1 {
+			return request, errors.New("limit must be a positive number")
+		}
+		if limit > MaxPageLimit {
+			limit = MaxPageLimit
+		}
+		request.Limit = limit
+	}
+
+	if cursor, ok := c.GetQuery("cursor"); ok {
+		request.CursorMode = true
+		request.Cursor = cursor
+		return request, nil
+	}
+
+	if pageStr := c.Query("page"); pageStr != "" {
+		page, err := strconv.Atoi(pageStr)
+		if err != nil || page < 1 {
+			return request, errors.New("page must be a positive number")
+		}
+		request.Page = page
+	}
+
+	return request, nil
+}
+
+func (p PageRequest) Offset() int {
+	return (p.Page - 1) * p.Limit
+}
+
+func (p PageRequest) Count(query *gorm.DB) (int64, error) {
+	var total int64
+	err := query.Session(&gorm.Session{}).Count(&total).Error
+	return total, err
+}
+
+// Apply orders the query by column and limits it to one page. In cursor mode
+// the cursor is decoded into cursorValue and one extra row is fetched so that
+// HasMore can tell whether another page exists.
+func (p PageRequest) Apply(query *gorm.DB, column string, desc bool, cursorValue interface{}) (*gorm.DB, error) {
+	direction, operator := "ASC", ">"
+	if desc {
+		direction, operator = "DESC", "<"
+	}
+
+	if !p.CursorMode {
+		return query.Order(column + " " + direction).Offset(p.Offset()).Limit(p.Limit), nil
+	}
+
+	if p.Cursor != "" {
+		if err := DecodeCursor(p.Cursor, cursorValue); err != nil {
+			return nil, err
+		}
+		query = query.Where(column+" "+operator+" ?", reflect.Indirect(reflect.ValueOf(cursorValue)).Interface())
+	}
+
+	return query.Order(column + " " + direction).Limit(p.Limit + 1), nil
+}
+
+func (p PageRequest) HasMore(fetched int, total int64) bool {
+	if p.CursorMode {
+		return fetched > p.Limit
+	}
+	return int64(p.Page*p.Limit) < total
+}
+
+func EncodeCursor(value interface{}) string {
+	raw, err := json.Marshal(value)
+	if err != nil {
+		return ""
+	}
+	return base64.RawURLEncoding.EncodeToString(raw)
+}
+
+func DecodeCursor(cursor string, value interface{}) error {
+	raw, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return errors.New("invalid cursor")
+	}
+	if err := json.Unmarshal(raw, value); err != nil {
+		return errors.New("invalid cursor")
+	}
+	return nil
+}
+
+func NewPageInfo(c *gin.Context, p PageRequest, total int64, hasMore bool, nextCursor string) PageInfo {
+	info := PageInfo{
+		Limit:      p.Limit,
+		TotalCount: total,
+		TotalPages: (total + int64(p.Limit) - 1) / int64(p.Limit),
+		HasMore:    hasMore,
+	}
+
+	if p.CursorMode {
+		if hasMore {
+			info.NextCursor = nextCursor
+			info.Next = nextLink(c, "cursor", nextCursor)
+		}
+		return info
+	}
+
+	info.Page = p.Page
+	if hasMore {
+		info.Next = nextLink(c, "page", fmt.Sprintf("%d", p.Page+1))
+	}
+	return info
+}
+
+func nextLink(c *gin.Context, key, value string) string {
+	next := *c.Request.URL
+	query := next.Query()
+	query.Set(key, value)
+	next.RawQuery = query.Encode()
+	return next.RequestURI()
+}
@@ -0,0 +1,73 @@
+package utils
+
+import (
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestParsePageRequest(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	tests := []struct {
+		name    string
+		query   string
+		want    PageRequest
+		wantErr bool
+	}{
+		{"defaults", "", PageRequest{Page: 1, Limit: DefaultPageLimit}, false},
+		{"page and limit", "?page=3&limit=5", PageRequest{Page: 3, Limit: 5}, false},
+		{"limit capped", "?limit=500", PageRequest{Page: 1, Limit: MaxPageLimit}, false},
+		{"zero limit", "?limit=0", PageRequest{}, true},
+		{"limit not a number", "?limit=ten", PageRequest{}, true},
+		{"zero page", "?page=0", PageRequest{}, true},
+		{"page not a number", "?page=two", PageRequest{}, true},
+		{"empty cursor starts cursor mode", "?cursor=", PageRequest{Page: 1, Limit: DefaultPageLimit, CursorMode: true}, false},
+		{"cursor ignores page", "?cursor=NDI&page=4&limit=10", PageRequest{Page: 1, Limit: 10, Cursor: "NDI", CursorMode: true}, false},
+	}
+
+	for _, test := range tests {
+		c, _ := gin.CreateTestContext(httptest.NewRecorder())
+		c.Request = httptest.NewRequest("GET", "/items"+test.query, nil)
+
+		got, err := ParsePageRequest(c)
+		if test.wantErr {
+			if err == nil {
+				t.Errorf("%s: ParsePageRequest() = %+v, want an error", test.name, got)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: ParsePageRequest() error = %v", test.name, err)
+			continue
+		}
+		if got != test.want {
+			t.Errorf("%s: ParsePageRequest() = %+v, want %+v", test.name, got, test.want)
+		}
+	}
+}
+
+func TestDecodeCursor(t *testing.T) {
+	var id uint
+	if err := DecodeCursor(EncodeCursor(uint(42)), &id); err != nil || id != 42 {
+		t.Errorf("DecodeCursor(EncodeCursor(42)) = %d, %v, want 42", id, err)
+	}
+
+	tests := []struct {
+		name   string
+		cursor string
+	}{
+		{"not base64", "!!!"},
+		{"not json", "bm90LWpzb24"},
+		{"wrong type", EncodeCursor("forty-two")},
+		{"empty", ""},
+	}
+
+	for _, test := range tests {
+		var value uint
+		if err := DecodeCursor(test.cursor, &value); err == nil {
+			t.Errorf("%s: DecodeCursor(%q) = %d, want an error", test.name, test.cursor, value)
+		}
+	}
+}